@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const sampleAliases = `# ~/.bash_aliases
+alias ll='ls -alF'
+alias g=git
+alias gs="git status"
+  alias k='kubectl'
+alias deploy='curl -H "Authorization: Bearer abc123" https://ci.example.com/deploy'
+alias broken
+alias two words='x'
+export PATH=$PATH:~/bin
+`
+
+func TestParseAliases(t *testing.T) {
+	want := map[string]string{
+		"ll":     "ls -alF",
+		"g":      "git",
+		"gs":     "git status",
+		"k":      "kubectl",
+		"deploy": `curl -H "Authorization: Bearer abc123" https://ci.example.com/deploy`,
+	}
+	if got := parseAliases(sampleAliases); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAliases = %v, want %v", got, want)
+	}
+}
+
+func TestAliasesInPrompt(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		e := newTestEnv(t, "ls")
+		if err := os.WriteFile(filepath.Join(e.home, ".bash_aliases"), []byte(sampleAliases), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if enabled {
+			e.writeConfig(`{"share_aliases": true}`)
+		}
+		e.run("n\n", "list files")
+		text := requestText(t, e.api.requests[0])
+		if enabled {
+			assertContains(t, text, "ll='ls -alF'", "g='git'", "gs='git status'")
+		} else {
+			assertNotContains(t, text, "ll=")
+		}
+		// Aliases holding secrets are never shared
+		assertNotContains(t, text, "abc123", "deploy=")
+	}
+}
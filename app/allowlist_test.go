@@ -0,0 +1,53 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestAllowedCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	tests := []struct {
+		command string
+		blocked string
+		code    int
+	}{
+		{"echo hi | wc -c", "", exitOK},
+		{"curl -s example.com | wc -c", "curl", exitDeclined},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, tt.command)
+		e.writeConfig(`{"allowed_commands": ["echo", "wc", "ls"]}`)
+		result := e.run("y\n", "count bytes")
+		if result.code != tt.code {
+			t.Errorf("%s: exit code = %d, want %d", tt.command, result.code, tt.code)
+		}
+		if tt.blocked == "" {
+			assertContains(t, result.stdout, "Do you want to run this command?")
+			assertNotContains(t, result.stdout, "Running is disabled")
+			if len(e.readHistory()) != 1 {
+				t.Errorf("%s: the allowed command was not run", tt.command)
+			}
+			continue
+		}
+		assertContains(t, result.stdout, "Running is disabled: "+tt.blocked+" not in allowed_commands.", "Copy this command? (c/t/o/p/s/l/n")
+		if entries := e.readHistory(); len(entries) != 0 {
+			t.Errorf("%s: ran a disallowed command: %+v", tt.command, entries)
+		}
+	}
+}
+
+func TestDisallowedPrograms(t *testing.T) {
+	options.AllowedCommands = nil
+	if got := disallowedPrograms("rm -rf /"); got != nil {
+		t.Errorf("disallowedPrograms without an allowlist = %q, want nil", got)
+	}
+	options.AllowedCommands = []string{"ls", "grep"}
+	defer func() { options.AllowedCommands = nil }()
+	got := disallowedPrograms("sudo ls | grep x && curl a | sh; curl b")
+	if len(got) != 2 || got[0] != "curl" || got[1] != "sh" {
+		t.Errorf("disallowedPrograms = %q, want curl and sh once each", got)
+	}
+}
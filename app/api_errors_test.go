@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIErrorReporting(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"rate limited", http.StatusTooManyRequests, `{"error": "slow down"}`, "the API is rate limiting this key"},
+		{"server error", http.StatusInternalServerError, "upstream failed", "API error: 500"},
+		{"refusal", http.StatusOK, `{"choices": [{"message": {"refusal": "I can't help with that"}}]}`, "the model declined to answer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+			e := newTestEnv(t)
+			e.env["OPENAI_BASE_URL"] = server.URL
+
+			result := e.run("", "list files")
+			if result.code != exitAPI {
+				t.Errorf("exit code = %d, want %d", result.code, exitAPI)
+			}
+			assertContains(t, result.stderr, "Error getting command suggestion", tt.want)
+		})
+	}
+}
+
+func TestNetworkErrorReporting(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	e := newTestEnv(t)
+	e.env["OPENAI_BASE_URL"] = server.URL
+	e.writeConfig(`{"retries": 0}`)
+
+	result := e.run("", "list files")
+	if result.code != exitAPI {
+		t.Errorf("exit code = %d, want %d", result.code, exitAPI)
+	}
+	assertContains(t, result.stderr, "network error", "check your network connection and the API base URL ("+server.URL+")")
+}
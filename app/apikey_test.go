@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRejectedKeyReentry(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.env["OPENAI_API_KEY"] = ""
+	e.api.badKey = "sk-revoked"
+	e.writeConfig(`{"keys": {"openai": "sk-revoked"}}`)
+
+	result := e.run("sk-replacement\nn\n", "list files")
+	if result.code != exitDeclined {
+		t.Fatalf("exit code = %d, want %d:\n%s", result.code, exitDeclined, result.stderr)
+	}
+	assertContains(t, result.stdout, "Your OpenAI API key was rejected (401 Unauthorized).", "API key saved.", "ls")
+	if len(e.api.requests) != 2 {
+		t.Errorf("made %d API requests, want the query retried once", len(e.api.requests))
+	}
+	config, err := os.ReadFile(e.configPath("config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, string(config), "sk-replacement")
+	assertNotContains(t, string(config), "sk-revoked")
+
+	// A key known to be bad is replaced before the next request is made
+	e.writeConfig(`{"keys": {"openai": "sk-revoked"}}`)
+	result = e.run("sk-replacement\nn\n", "list files")
+	assertContains(t, result.stdout, "Your saved OpenAI API key was rejected previously.")
+	if len(e.api.requests) != 3 {
+		t.Errorf("made %d API requests in total, want no request with the bad key", len(e.api.requests))
+	}
+}
+
+func TestRejectedKeyNotReplaced(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.env["OPENAI_API_KEY"] = ""
+	e.api.badKey = "sk-revoked"
+	e.writeConfig(`{"keys": {"openai": "sk-revoked"}}`)
+
+	result := e.run("\n", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, "no API key entered")
+}
+
+func TestRejectedEnvironmentKey(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.api.badKey = e.env["OPENAI_API_KEY"]
+
+	result := e.run("", "list files")
+	if result.code != exitAPI {
+		t.Errorf("exit code = %d, want %d", result.code, exitAPI)
+	}
+	assertContains(t, result.stderr, "OPENAI_API_KEY from your environment or .env file was rejected")
+	if _, err := os.Stat(e.configPath("config.json")); !os.IsNotExist(err) {
+		t.Errorf("config written for an environment key (%v)", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendToCommand(t *testing.T) {
+	tests := []struct{ command, suffix, want string }{
+		{"ls", " | wc -l\n", "ls | wc -l"},
+		{"ls", "\n", "ls"},
+		{"echo a", "&& echo b", "echo a && echo b"},
+	}
+	for _, tt := range tests {
+		if got := appendToCommand(tt.command, tt.suffix); got != tt.want {
+			t.Errorf("appendToCommand(%q, %q) = %q, want %q", tt.command, tt.suffix, got, tt.want)
+		}
+	}
+}
+
+func TestAppendRunsCombinedCommand(t *testing.T) {
+	e := newTestEnv(t, "printf 'a\\nb\\nc\\n'")
+	result := e.run("a\n| wc -l\n", "print three lines")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, `Command: printf 'a\nb\nc\n' | wc -l`)
+	history := e.readHistory()
+	if len(history) != 1 || history[0].Command != `printf 'a\nb\nc\n' | wc -l` || strings.TrimSpace(history[0].Output) != "3" {
+		t.Errorf("history = %+v, want the combined command and its output", history)
+	}
+}
+
+func TestAppendDestructiveSuffix(t *testing.T) {
+	e := newTestEnv(t, "echo data")
+	result := e.run("a\n> out.txt\nn\n", "print data")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+	}
+	assertContains(t, result.stdout, "Warning: the appended text looks destructive.", "Command not executed.")
+	if _, err := os.Stat(filepath.Join(e.dir, "out.txt")); !os.IsNotExist(err) {
+		t.Errorf("the command ran (%v)", err)
+	}
+
+	result = e.run("a\n> out.txt\ny\n", "print data")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(e.dir, "out.txt")); err != nil || string(data) != "data\n" {
+		t.Errorf("out.txt = %q (%v), want the command run after confirming", data, err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAutoFix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	e := newTestEnv(t, "ls missing-dir", "echo fixed")
+	result := e.run("y\ny\n", "--auto-fix", "list the directory")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+	}
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want a suggestion and a fix", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[1], "ls missing-dir", "No such file or directory")
+	assertContains(t, result.stdout, fmt.Sprintf("Suggested fix (1/%d): echo fixed", maxFixAttempts), "Fix cost:", "fixed\n")
+	assertNotContains(t, result.stdout, "Ask for a corrected command?")
+
+	entries := e.readHistory()
+	if len(entries) != 2 || entries[1].Command != "echo fixed" {
+		t.Errorf("history = %+v, want the failure and the fix", entries)
+	}
+}
+
+func TestAutoFixGivesUp(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	e := newTestEnv(t, "exit 7")
+	result := e.run(strings.Repeat("y\n", 10), "--auto-fix", "fail")
+	if result.code != 7 {
+		t.Errorf("exit code = %d, want the command's 7", result.code)
+	}
+	if len(e.api.requests) != 1+maxFixAttempts {
+		t.Errorf("made %d API requests, want %d fixes at most", len(e.api.requests), maxFixAttempts)
+	}
+}
+
+func TestFixOnRequest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	e := newTestEnv(t, "exit 3", "true")
+	result := e.run("y\nn\n", "fail")
+	assertContains(t, result.stdout, "Ask for a corrected command? (y/n)")
+	if len(e.api.requests) != 1 {
+		t.Errorf("made %d API requests, want no fix after declining", len(e.api.requests))
+	}
+	if result.code != 3 {
+		t.Errorf("exit code = %d, want 3", result.code)
+	}
+}
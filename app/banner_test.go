@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+const testBanner = "Commands are AI-generated; review them before running."
+
+func TestBannerFirstRun(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"banner": "` + testBanner + `"}`)
+
+	result := e.run("no\n", "list files")
+	assertContains(t, result.stdout, testBanner, "Type 'yes' to acknowledge and continue:",
+		"The banner must be acknowledged before using dingus-copilot.")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+	}
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests before the banner was acknowledged", len(e.api.requests))
+	}
+
+	result = e.run("yes\nn\n", "list files")
+	assertContains(t, result.stdout, testBanner, "Suggested command: ls")
+	data, err := os.ReadFile(e.configPath("config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, string(data), `"acknowledged": true`, testBanner)
+}
+
+func TestBannerAcknowledged(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"banner": "` + testBanner + `", "acknowledged": true}`)
+	result := e.run("n\n", "list files")
+	assertNotContains(t, result.stdout, testBanner, "acknowledge")
+	assertContains(t, result.stdout, "Suggested command: ls")
+}
+
+func TestResetAck(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"banner": "` + testBanner + `", "acknowledged": true}`)
+	result := e.run("", "--reset-ack")
+	assertContains(t, result.stdout, "The banner will be shown again on the next run.")
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests", len(e.api.requests))
+	}
+
+	result = e.run("no\n", "list files")
+	assertContains(t, result.stdout, testBanner)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	e := newTestEnv(t, "ls -la", "du -sh .")
+	e.writeConfig(`{"cost_format": "raw"}`)
+	queries := filepath.Join(e.dir, "queries.txt")
+	if err := os.WriteFile(queries, []byte("list files\n\n# a comment\nshow disk usage\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := e.run("", "batch", queries)
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want one per query", len(e.api.requests))
+	}
+	assertContains(t, result.stdout, "[1] list files", "ls -la", "[2] show disk usage", "du -sh .")
+	assertContains(t, result.stdout, "Total cost for 2 queries: "+formatCost(2*calculateCost(100, 10)))
+	assertNotContains(t, result.stdout, "Do you want to run")
+
+	// Later queries see earlier suggestions, but nothing is saved
+	assertContains(t, requestText(t, e.api.requests[1]), "ls -la")
+	if entries := e.readHistory(); len(entries) != 0 {
+		t.Errorf("history = %+v, want nothing saved", entries)
+	}
+}
+
+func TestBatchMissingFile(t *testing.T) {
+	result := newTestEnv(t).run("", "batch", "missing.txt")
+	if result.code != exitFailure {
+		t.Errorf("exit code = %d, want %d", result.code, exitFailure)
+	}
+	assertContains(t, result.stderr, "Error running batch")
+}
+
+func TestBatchQuery(t *testing.T) {
+	e := newTestEnv(t, "exiftool '-FileName<DateTimeOriginal' .")
+	e.run("n\n", "batch", "rename", "photos", "by", "date")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want the query sent", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[0], "batch rename photos by date")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"unicode/utf8"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestBinaryOutputOmitted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	e := newTestEnv(t, `printf '\377\376\000'`, "ls")
+	if result := e.run("y\n", "print some bytes"); result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	entries := e.readHistory()
+	if len(entries) != 1 || entries[0].Output != aid.BinaryOutputPlaceholder {
+		t.Fatalf("history = %+v, want the output replaced", entries)
+	}
+
+	e.run("n\n", "list files")
+	prompt := e.api.prompts()[1]
+	if !utf8.ValidString(prompt) {
+		t.Errorf("prompt is not valid UTF-8: %q", prompt)
+	}
+	assertContains(t, prompt, aid.BinaryOutputPlaceholder)
+}
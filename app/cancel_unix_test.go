@@ -0,0 +1,41 @@
+//go:build !windows
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInteractiveCancel(t *testing.T) {
+	// The command interrupts the test process itself once it has started,
+	// as Ctrl+C in the terminal would
+	e := newTestEnv(t, "echo partial-output; kill -INT $PPID; sleep 30", "echo alternative-ran")
+	result := e.run("wait for the build\ny\ny\ny\n", "--interactive")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+	}
+	assertContains(t, result.stdout, "partial-output\n", "Interrupted, stopping command...",
+		"Command cancelled. Ask for a different command? (y/n)", "alternative-ran\n")
+	assertNotContains(t, result.stdout, "Ask for a corrected command?")
+
+	prompts := e.api.prompts()
+	if len(prompts) != 2 {
+		t.Fatalf("made %d API requests, want the suggestion and an alternative", len(prompts))
+	}
+	assertContains(t, prompts[1], "wait for the build", "was cancelled by the user", "partial-output")
+}
+
+func TestInteractiveCancelDeclined(t *testing.T) {
+	e := newTestEnv(t, "echo partial-output; kill -INT $PPID; sleep 30", "echo next-ran")
+	result := e.run("wait for the build\ny\nn\nsomething else\ny\n", "--interactive")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+	}
+	// The session carries on with the next query
+	assertContains(t, result.stdout, "Command cancelled.", "next-ran\n")
+	prompts := e.api.prompts()
+	if len(prompts) != 2 || strings.Contains(prompts[1], "cancelled") {
+		t.Errorf("prompts = %q, want the next query alone", prompts)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestIsStandaloneCd(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"cd ~/projects", true},
+		{"  cd ..", true},
+		{"cd", true},
+		{"cd build && make", false},
+		{"cd /tmp; ls", false},
+		{"cdrecord dev=1", false},
+		{"ls", false},
+	}
+	for _, tt := range tests {
+		if got := isStandaloneCd(tt.command); got != tt.want {
+			t.Errorf("isStandaloneCd(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestCdNotice(t *testing.T) {
+	result := newTestEnv(t, "cd ~/projects").run("n\n", "go to my projects")
+	assertContains(t, result.stdout, cdNotice)
+
+	result = newTestEnv(t, "cd build && make").run("n\n", "build the project")
+	assertNotContains(t, result.stdout, cdNotice)
+}
+
+func TestEvalCd(t *testing.T) {
+	result := newTestEnv(t, "cd ~/projects").run("", "--eval", "go to my projects")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	if result.stdout != "cd ~/projects\n" {
+		t.Errorf("stdout = %q, want only the command", result.stdout)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Make the clipboard hold text, or fail to read with err
+func stubClipboard(t *testing.T, text string, err error) {
+	saved := readClipboard
+	t.Cleanup(func() { readClipboard = saved })
+	readClipboard = func() (string, error) { return text, err }
+}
+
+func TestFromClipboard(t *testing.T) {
+	stubClipboard(t, "npm ERR! code EACCES\nDB_PASSWORD=hunter22 in .env\n", nil)
+	e := newTestEnv(t, "sudo chown -R $USER ~/.npm")
+	e.run("n\n", "--from-clipboard", "how do I fix this")
+
+	prompt := e.api.prompts()[0]
+	assertContains(t, prompt, "how do I fix this", "<CLIPBOARD> npm ERR! code EACCES")
+	assertNotContains(t, prompt, "hunter22")
+
+	// The pasted text is context for this query only
+	if entries := e.readHistory(); len(entries) != 0 {
+		t.Errorf("history = %+v, want nothing recorded after declining", entries)
+	}
+}
+
+func TestFromClipboardTrimmed(t *testing.T) {
+	stubClipboard(t, strings.Repeat("a", maxClipboardBytes)+"the end of the error", nil)
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "--from-clipboard", "what went wrong")
+	prompt := e.api.prompts()[0]
+	assertContains(t, prompt, "<CLIPBOARD> ...", "the end of the error </CLIPBOARD>")
+	_, pasted, _ := strings.Cut(prompt, "<CLIPBOARD> ")
+	pasted, _, _ = strings.Cut(pasted, " </CLIPBOARD>")
+	if len(pasted) != len("...")+maxClipboardBytes {
+		t.Errorf("pasted %d bytes, want the last %d", len(pasted), maxClipboardBytes)
+	}
+}
+
+func TestFromClipboardErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		err  error
+		want string
+	}{
+		{"empty", "  \n", nil, "the clipboard is empty"},
+		{"unreadable", "", errors.New("xclip not found"), "xclip not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubClipboard(t, tt.text, tt.err)
+			e := newTestEnv(t, "ls")
+			result := e.run("", "--from-clipboard", "fix this")
+			if result.code != exitFailure {
+				t.Errorf("exit code = %d, want %d", result.code, exitFailure)
+			}
+			assertContains(t, result.stderr, "Error reading clipboard: "+tt.want)
+			if len(e.api.requests) != 0 {
+				t.Errorf("made %d API requests, want none", len(e.api.requests))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestConfidenceHint(t *testing.T) {
+	tests := []struct {
+		confidence float64
+		want       string
+	}{
+		{0, ""},
+		{0.2, "Low confidence (20%): the model was unsure about this suggestion, review it carefully."},
+		{0.49, "Low confidence (49%): the model was unsure about this suggestion, review it carefully."},
+		{lowConfidenceThreshold, ""},
+		{0.95, ""},
+	}
+	for _, tt := range tests {
+		if got := confidenceHint(tt.confidence); got != tt.want {
+			t.Errorf("confidenceHint(%v) = %q, want %q", tt.confidence, got, tt.want)
+		}
+	}
+}
+
+func TestStepsConfidenceHint(t *testing.T) {
+	tests := []struct {
+		probability float64
+		hint        bool
+	}{
+		{0.3, true},
+		{0.9, false},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "1. mkdir out\n2. ls out")
+		e.api.logprob = math.Log(tt.probability)
+		result := e.run("n\n", "--steps", "make a directory and list it")
+		if e.api.requests[0]["logprobs"] != true {
+			t.Errorf("request = %v, want logprobs requested", e.api.requests[0])
+		}
+		if got := strings.Contains(result.stdout, "Low confidence"); got != tt.hint {
+			t.Errorf("probability %v: hint shown = %v, want %v:\n%s", tt.probability, got, tt.hint, result.stdout)
+		}
+	}
+}
+
+func TestSuggestionConfidenceHint(t *testing.T) {
+	tests := []struct {
+		probability float64
+		hint        bool
+	}{
+		{0.3, true},
+		{0.9, false},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "ls -la")
+		e.api.logprob = math.Log(tt.probability)
+		result := e.run("n\n", "list files")
+		if e.api.requests[0]["logprobs"] != true {
+			t.Errorf("request = %v, want logprobs requested", e.api.requests[0])
+		}
+		if got := strings.Contains(result.stdout, "Low confidence (30%)"); got != tt.hint {
+			t.Errorf("probability %v: hint shown = %v, want %v:\n%s", tt.probability, got, tt.hint, result.stdout)
+		}
+		// The rating still comes with the command
+		assertContains(t, result.stdout, "Suggested command: ls -la", "Risk: safe.")
+	}
+}
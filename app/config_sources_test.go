@@ -0,0 +1,65 @@
+package main
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+// Fail unless out has a line showing key set to value by source
+func assertSource(t *testing.T, out, key, value, source string) {
+	t.Helper()
+	line := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(key) + ` +` + regexp.QuoteMeta(value) + ` +` + regexp.QuoteMeta(source) + `$`)
+	if !line.MatchString(out) {
+		t.Errorf("no line for %s = %s from %s:\n%s", key, value, source, out)
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	e := newTestEnv(t)
+	e.writeConfig(`{"model": "gpt-4o", "temperature": 0.5, "show_summary": true}`)
+	result := e.run("", "--temperature", "0.1", "config", "sources")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	user := "user " + e.configPath("config.json")
+	assertSource(t, result.stdout, "model", "gpt-4o", user)
+	assertSource(t, result.stdout, "show_summary", "true", user)
+	assertSource(t, result.stdout, "temperature", "0.1", "flag --temperature")
+	assertSource(t, result.stdout, "base_url", e.env["OPENAI_BASE_URL"], "environment OPENAI_BASE_URL")
+	assertSource(t, result.stdout, "OPENAI_API_KEY", "(set)", "environment OPENAI_API_KEY")
+	assertNotContains(t, result.stdout, e.env["OPENAI_API_KEY"])
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests", len(e.api.requests))
+	}
+}
+
+func TestConfigSourcesLayers(t *testing.T) {
+	savedConfigFile := configFile
+	t.Cleanup(func() {
+		configFile = savedConfigFile
+		resetGlobals()
+	})
+	resetGlobals()
+	configFile = "/home/me/.dingus-copilot/config.json"
+	configSources = map[string]string{"model": "user", "banner": "system"}
+
+	var out strings.Builder
+	config := aid.Config{Model: "gpt-4.1", Banner: "Managed"}
+	if err := showConfigSources(&out, config, map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	assertSource(t, out.String(), "model", "gpt-4.1", "user "+configFile)
+	assertSource(t, out.String(), "banner", "Managed", "system "+systemConfigPath(runtime.GOOS))
+}
+
+func TestConfigSourcesEmpty(t *testing.T) {
+	e := newTestEnv(t)
+	e.env["OPENAI_API_KEY"] = ""
+	e.env["OPENAI_BASE_URL"] = ""
+	result := e.run("", "config", "sources")
+	assertContains(t, result.stdout, "No settings are configured; defaults are in use.")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestMalformedConfig(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig("{\n  \"model\": \"gpt-4o\",\n}")
+	result := e.run("n\n", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, "not valid JSON (line 3)")
+	if len(e.api.requests) != 0 {
+		t.Error("the API was called with a broken config")
+	}
+}
+
+func TestWrongTypeConfig(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"rate_limit_rpm": "ten", "model": "gpt-4o"}`)
+	result := e.run("n\n", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, `config key "rate_limit_rpm" must be a number`, "--repair-config")
+}
+
+func TestValidConfig(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"model": "gpt-4o", "show_typo": true}`)
+	result := e.run("n\n", "list files")
+	if result.code != exitDeclined {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stderr, `Warning: ignoring unknown config key "show_typo"`)
+	if got := e.api.requests[0]["model"]; got != "gpt-4o" {
+		t.Errorf("model = %v, want gpt-4o from the config", got)
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	if got := e.api.requests[0]["model"]; got != aid.DefaultModel {
+		t.Errorf("model = %v, want the default %s", got, aid.DefaultModel)
+	}
+	if _, ok := e.api.requests[0]["temperature"]; ok {
+		t.Errorf("temperature = %v, want it left to the API", e.api.requests[0]["temperature"])
+	}
+}
+
+func TestRepairConfig(t *testing.T) {
+	e := newTestEnv(t)
+	e.writeConfig(`{"model": "gpt-4o", "rate_limit_rpm": "ten", "show_typo": true}`)
+	result := e.run("", "--repair-config")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, `dropping unknown config key "show_typo"`,
+		`dropping invalid value: config key "rate_limit_rpm" must be a number`, "Configuration repaired successfully!")
+
+	data, err := os.ReadFile(e.configPath("config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "{\n  \"model\": \"gpt-4o\"\n}"; got != want {
+		t.Errorf("repaired config = %q, want %q", got, want)
+	}
+}
+
+func TestRepairMalformedConfig(t *testing.T) {
+	e := newTestEnv(t)
+	e.writeConfig(`{"model": `)
+	result := e.run("", "--repair-config")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, "fix it by hand or run cleanup")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSetConfigValueConcurrent(t *testing.T) {
+	saved := configFile
+	configFile = filepath.Join(t.TempDir(), "config.json")
+	defer func() { configFile = saved }()
+	if err := os.WriteFile(configFile, []byte(`{"model": "gpt-4o"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each write reads the file and rewrites it with one more key, so
+	// writes that are not serialised lose each other's keys
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := setConfigValue(fmt.Sprintf("key_%d", i), i); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("config is corrupt: %v\n%s", err, data)
+	}
+	if len(raw) != writers+1 {
+		t.Errorf("config has %d keys, want %d", len(raw), writers+1)
+	}
+}
+
+func TestSaveKeyKeepsOtherSettings(t *testing.T) {
+	saved := configFile
+	configFile = filepath.Join(t.TempDir(), "config.json")
+	defer func() { configFile = saved }()
+	if err := os.WriteFile(configFile, []byte(`{"OPENAI_API_KEY": "sk-old", "future_key": 1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saveKey("openai", "sk-new"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"future_key\": 1,\n  \"keys\": {\n    \"openai\": \"sk-new\"\n  }\n}"
+	if string(data) != want {
+		t.Errorf("config = %s, want %s", data, want)
+	}
+	entries, err := os.ReadDir(filepath.Dir(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != "config.json" && name != "config.json.lock" {
+			t.Errorf("left %s behind", name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestContextTurns(t *testing.T) {
+	var entries []aid.HistoryEntry
+	for i := 1; i <= 5; i++ {
+		entries = append(entries, aid.HistoryEntry{Command: fmt.Sprintf("echo turn-%d", i)})
+	}
+	tests := []struct {
+		args []string
+		want []int // Turns expected in the prompt
+	}{
+		{[]string{"--context", "0"}, nil},
+		{[]string{"--context", "1"}, []int{5}},
+		{[]string{"--context", "3"}, []int{3, 4, 5}},
+		{[]string{"--context", "10"}, []int{1, 2, 3, 4, 5}},
+		{nil, []int{1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "ls")
+		e.writeHistory(entries...)
+		e.run("n\n", append(tt.args, "list files")...)
+		prompt := e.api.prompts()[0]
+
+		var got []int
+		for i := 1; i <= 5; i++ {
+			if strings.Contains(prompt, "echo turn-"+strconv.Itoa(i)) {
+				got = append(got, i)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%v: prompt has turns %v, want %v", tt.args, got, tt.want)
+		}
+		if len(tt.want) == 0 {
+			assertNotContains(t, prompt, "Recent command history")
+		}
+		if stored := len(e.readHistory()); stored != 5 {
+			t.Errorf("%v: history has %d entries, want all 5 kept", tt.args, stored)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import "testing"
+
+func TestCostLine(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"paid provider", nil, true},
+		{"free provider", []string{"--provider", "ollama"}, false},
+		{"model without known prices", []string{"--model", "ft:gpt-4o-mini:acme"}, false},
+		{"--no-cost", []string{"--no-cost"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := newTestEnv(t, "ls").run("n\n", append(tt.args, "list files")...)
+			if tt.want {
+				assertContains(t, result.stdout, "Query cost:")
+			} else {
+				assertNotContains(t, result.stdout, "Query cost:", "$0.00")
+			}
+		})
+	}
+}
+
+// Each fake API call costs $0.000021 at OpenAI's rates
+func TestCostFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+		want   string
+	}{
+		{"human by default", "", nil, "Query cost: < $0.0001"},
+		{"raw flag", "", []string{"--cost-format", "raw"}, "Query cost: $0.000021"},
+		{"raw config", `{"cost_format": "raw"}`, nil, "Query cost: $0.000021"},
+		{"flag over config", `{"cost_format": "raw"}`, []string{"--cost-format", "human"}, "Query cost: < $0.0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, "ls")
+			if tt.config != "" {
+				e.writeConfig(tt.config)
+			}
+			result := e.run("n\n", append(tt.args, "list files")...)
+			assertContains(t, result.stdout, tt.want)
+		})
+	}
+}
+
+// The fake API's 100 prompt and 10 completion tokens at each model's rates
+func TestCostPerModel(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"default model", nil, "Query cost: $0.000021"},
+		{"--model", []string{"--model", "gpt-4o"}, "Query cost: $0.000350"},
+		{"inline model", []string{"@gpt-4.1"}, "Query cost: $0.000280"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--cost-format", "raw"}, tt.args...)
+			result := newTestEnv(t, "ls").run("n\n", append(args, "list files")...)
+			assertContains(t, result.stdout, tt.want)
+		})
+	}
+}
+
+func TestCostFormatInvalid(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	result := e.run("n\n", "--cost-format", "cents", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, `unknown cost format "cents" (use human or raw)`)
+}
+
+func TestSessionCost(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	result := e.run("list files\nn\nlist again\nn\n", "--interactive", "--session-cost", "--cost-format", "raw")
+	assertContains(t, result.stdout, "Query cost: $0.000021 (session $0.000021)", "Query cost: $0.000021 (session $0.000042)")
+
+	e = newTestEnv(t, "ls")
+	result = e.run("list files\nn\n", "--interactive")
+	assertContains(t, result.stdout, "Query cost: < $0.0001\n")
+	assertNotContains(t, result.stdout, "(session")
+}
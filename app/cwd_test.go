@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCwd(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestEnv(t, "pwd")
+	result := e.run("y\n", "--cwd", dir, "where am I")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, dir+"\n")
+	assertContains(t, requestText(t, e.api.requests[0]), "The command will run in the directory "+dir)
+	if entries := e.readHistory(); len(entries) != 1 || strings.TrimSpace(entries[0].Output) != dir {
+		t.Errorf("history = %+v, want the output of pwd in %s", entries, dir)
+	}
+}
+
+func TestCwdRelative(t *testing.T) {
+	e := newTestEnv(t, "pwd")
+	if err := os.Mkdir(filepath.Join(e.dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	result := e.run("y\n", "--cwd", "sub", "where am I")
+	assertContains(t, result.stdout, filepath.Join(e.dir, "sub")+"\n")
+}
+
+func TestCwdInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(t.TempDir(), "missing"), file} {
+		e := newTestEnv(t, "pwd")
+		result := e.run("y\n", "--cwd", path, "where am I")
+		if result.code != exitConfig {
+			t.Errorf("%s: exit code = %d, want %d", path, result.code, exitConfig)
+		}
+		assertContains(t, result.stderr, "--cwd: ")
+		if len(e.api.requests) != 0 {
+			t.Errorf("%s: made %d API requests", path, len(e.api.requests))
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestDedupHistory(t *testing.T) {
+	tests := []struct {
+		config string
+		want   []string
+	}{
+		{`{"dedup_history": true}`, []string{"echo status", "echo other", "echo status"}},
+		{`{}`, []string{"echo status", "echo status", "echo other", "echo status"}},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t)
+		e.writeConfig(tt.config)
+		e.writeHistory(aid.HistoryEntry{Command: "echo status", Output: "old"})
+		for _, command := range []string{"echo status", "echo other", "echo status"} {
+			e.api.replies = []string{command}
+			e.run("y\n", "check the status")
+		}
+
+		entries := e.readHistory()
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Command)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: history = %v, want %v", tt.config, got, tt.want)
+		}
+		if len(entries) == 3 && strings.TrimSpace(entries[0].Output) == "old" {
+			t.Errorf("%s: collapsed entry kept its old output", tt.config)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestDeterministicCache(t *testing.T) {
+	e := newTestEnv(t, "ls", "ls -la")
+	e.writeHistory(aid.HistoryEntry{Command: "cd /srv"})
+
+	e.run("n\n", "--deterministic", "list files")
+	result := e.run("n\n", "--deterministic", "list files")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want the replay cached", len(e.api.requests))
+	}
+	if temperature := e.api.requests[0]["temperature"]; temperature != 0.0 {
+		t.Errorf("temperature = %v, want 0", temperature)
+	}
+	assertContains(t, result.stdout, "Using cached suggestion.", "Suggested command: ls")
+
+	// The same query after different history is asked afresh
+	e.writeHistory(aid.HistoryEntry{Command: "cd /tmp"})
+	result = e.run("n\n", "--deterministic", "list files")
+	if len(e.api.requests) != 2 {
+		t.Errorf("made %d API requests, want a miss after history changed", len(e.api.requests))
+	}
+	assertNotContains(t, result.stdout, "Using cached suggestion.")
+}
+
+func TestCacheOnlyWhenDeterministic(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	e.run("n\n", "list files")
+	if len(e.api.requests) != 2 {
+		t.Errorf("made %d API requests, want no caching", len(e.api.requests))
+	}
+}
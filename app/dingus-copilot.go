@@ -3,60 +3,211 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"app/dingus-copilot/pkg/aid"
 )
 
 // Config files stored in user's home directory
 var (
-	configDir     string
-	configFile    string
-	openaiAPIKey  string
+	configDir      string
+	configFile     string
+	historyFile    string
+	lastFile       string
+	rateLimitFile  string
+	cacheFile      string
+	invalidKeyFile string
+	activeAPIKey   string
 )
 
-// Command history tracking (in-memory)
-type CommandHistory struct {
-	Entries  []HistoryEntry
-	MaxSize  int
-	MaxWords int
-}
+// Limits API requests to rate_limit_rpm; every call through chatCompletion
+// takes a token, including fixes, refinements and retries
+var rateLimiter *aid.RateLimiter
 
-type HistoryEntry struct {
-	Command string
-	Output  string
-}
+// The real stdout in --eval mode, where os.Stdout is pointed at stderr
+var evalStdout io.Writer = os.Stdout
+
+// Shared reader so buffered stdin input isn't lost between prompts
+var stdin = bufio.NewReader(os.Stdin)
 
-// Create a global history tracker
-var history = CommandHistory{
-	Entries:  []HistoryEntry{},
-	MaxSize:  8,  // Store the last 5 commands
-	MaxWords: 160, // Limit to last 100 words per entry
+// Per-invocation settings resolved from flags and config
+type Options struct {
+	Provider         string
+	BaseURL          string
+	OrgID            string
+	ProjectID        string
+	KeyCommand       string
+	Model            string
+	Temperature      *float64
+	NoWait           bool
+	NoCost           bool
+	CostFormat       string
+	SessionCost      bool
+	NoColor          bool
+	Version          bool
+	MaxPromptTokens  int
+	Retries          int
+	ShareAliases     bool
+	Standalone       bool
+	RedactQuery      bool
+	SandboxNetwork   bool
+	ExpandEnv        bool
+	RedactEnv        []string
+	AllowedCommands  []string
+	HistoryFile      string
+	Portable         bool
+	Trace            bool
+	Debug            bool
+	KeepTrailingText bool
+	RepairConfig     bool
+	ResetAck         bool
+	NoHistory        bool
+	Fresh            bool
+	Context          int
+	MetricsFile      string
+	SavePrompt       string
+	FromClipboard    bool
+	Clipboard        string
+	Head             int
+	DisplayMaxBytes  int
+	Pager            string
+	PagerLines       int
+	Tail             int
+	OutputFile       string
+	SplitStreams     bool
+	Cwd              string
+	Steps            bool
+	Short            bool
+	Long             bool
+	MaxTokens        int
+	Learn            bool
+	Interactive      bool
+	Stats            bool
+	Explain          bool
+	Persona          string
+	ConfirmRisky     bool
+	RawPrompt        bool
+	Deterministic    bool
+	KeepGoing        bool
+	RetryOnFail      int
+	Tool             string
+	Eval             bool
+	Yes              bool
+	MaxCommandLength int
+	AutoFix          bool
+	ReplaceRun       bool
+	Args             map[string]string
+	ShareCWD         bool
 }
 
-// ANSI color codes
-const (
+var options Options
+
+// Create a global history tracker with the default limits
+var history = *aid.NewCommandHistory()
+
+// ANSI color codes, emptied by --no-color
+var (
 	colorReset  = "\033[0m"
 	colorGreen  = "\033[32m"
+	colorRed    = "\033[31m"
 	colorYellow = "\033[33m"
 	colorCyan   = "\033[36m"
 	colorPurple = "\033[35m"
 	colorBold   = "\033[1m"
 )
 
-// API cost rates per million tokens
+// Turn off colours for --no-color or the NO_COLOR convention
+func disableColor() {
+	colorReset, colorGreen, colorRed, colorYellow = "", "", "", ""
+	colorCyan, colorPurple, colorBold = "", "", ""
+}
+
+// Sampling temperature range accepted by the API
 const (
-	inputTokenCost  = 0.15  // $0.15 per million tokens
-	outputTokenCost = 0.60  // $0.60 per million tokens
+	minTemperature = 0.0
+	maxTemperature = 2.0
 )
 
+// Timing breakdown of each phase, printed with --trace
+type Tracer struct {
+	Phases []TracePhase
+}
+
+type TracePhase struct {
+	Label    string
+	Duration time.Duration
+}
+
+var tracer Tracer
+
+// Record the time spent in a phase that began at start
+func (t *Tracer) Track(label string, start time.Time) {
+	t.Phases = append(t.Phases, TracePhase{Label: label, Duration: time.Since(start)})
+}
+
+// Write the timing breakdown
+func (t *Tracer) Report(w io.Writer) {
+	var total time.Duration
+	fmt.Fprintln(w, "Timing breakdown:")
+	for _, phase := range t.Phases {
+		fmt.Fprintf(w, "  %-24s %s\n", phase.Label, phase.Duration.Round(time.Microsecond))
+		total += phase.Duration
+	}
+	fmt.Fprintf(w, "  %-24s %s\n", "total", total.Round(time.Microsecond))
+}
+
+// One line of the --metrics-file JSONL output, one per API call
+type MetricsRecord struct {
+	Timestamp        time.Time `json:"timestamp"`
+	Call             string    `json:"call"`
+	Model            string    `json:"model"`
+	LatencyMS        int64     `json:"latency_ms"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+	CacheHit         bool      `json:"cache_hit"`
+	Retries          int       `json:"retries"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// Append a record as a single write so concurrent appenders don't interleave
+func appendMetrics(path string, record MetricsRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 // Initialize config directory and files
 func initConfigFiles() error {
 	// Get user's home directory
@@ -74,324 +225,4656 @@ func initConfigFiles() error {
 	
 	// Set global file paths
 	configFile = filepath.Join(configDir, "config.json")
+	historyFile = filepath.Join(configDir, "history.json")
+	rateLimitFile = filepath.Join(configDir, "ratelimit.json")
+	cacheFile = filepath.Join(configDir, "cache.json")
+	invalidKeyFile = filepath.Join(configDir, "invalid-key")
+	lastFile = filepath.Join(configDir, "last.json")
 	
 	return nil
 }
 
-// Add command and its output to history
-func (h *CommandHistory) Add(command, output string) {
-	// Trim output to max words
-	words := strings.Fields(output)
-	if len(words) > h.MaxWords {
-		words = words[len(words)-h.MaxWords:]
-		output = strings.Join(words, " ")
+// Save a provider's API key to the configuration file, keeping any other
+// settings, including keys this version doesn't know
+func saveKey(provider, apiKey string) error {
+	return aid.WithFileLock(configFile, func() error {
+		raw := map[string]json.RawMessage{}
+		var config aid.Config
+		if data, err := os.ReadFile(configFile); err == nil {
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("failed to parse config file: %v", err)
+			}
+			// Invalid values elsewhere shouldn't stop a key being saved
+			config, _, _ = aid.ParseConfig(data)
+		}
+		config.SetKey(provider, apiKey)
+
+		keys, err := json.Marshal(config.Keys)
+		if err != nil {
+			return err
+		}
+		raw["keys"] = keys
+		if config.APIKey == "" {
+			delete(raw, "OPENAI_API_KEY")
+		}
+
+		configJSON, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return err
+		}
+		return aid.WriteFileAtomic(configFile, configJSON, 0600)
+	})
+}
+
+// Set one key in the configuration file, keeping every other setting.
+// A nil value removes the key.
+func setConfigValue(key string, value interface{}) error {
+	return aid.WithFileLock(configFile, func() error {
+		raw := map[string]json.RawMessage{}
+		if data, err := os.ReadFile(configFile); err == nil {
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return fmt.Errorf("failed to parse config file: %v", err)
+			}
+		}
+		if value == nil {
+			delete(raw, key)
+		} else {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			raw[key] = data
+		}
+
+		configJSON, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return err
+		}
+		return aid.WriteFileAtomic(configFile, configJSON, 0600)
+	})
+}
+
+// Show the configured banner and ask the user to acknowledge it, saving
+// the answer so later runs skip it. Reports whether it was acknowledged.
+func acknowledgeBanner(reader *bufio.Reader, banner string) (bool, error) {
+	fmt.Printf("%s%s%s\n\n", colorBold, strings.TrimSpace(banner), colorReset)
+	fmt.Print("Type 'yes' to acknowledge and continue: ")
+	answer, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(strings.ToLower(answer)) != "yes" {
+		return false, nil
 	}
-	
-	// Create new entry
-	entry := HistoryEntry{
-		Command: command,
-		Output:  output,
+	fmt.Println()
+	return true, setConfigValue("acknowledged", true)
+}
+
+// What a key printed by key_command must look like: one line of printable
+// characters without spaces, long enough not to be an error message word
+var keyPattern = regexp.MustCompile(`^[!-~]{16,}$`)
+
+// Run key_command and return the key it prints. The output is never
+// included in errors, since it may be a secret.
+func fetchKey(command string) (string, error) {
+	cmd := aid.SelectShell(runtime.GOOS).Command(command)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: key_command failed: %v", aid.ErrAPIKeyMissing, err)
 	}
-	
-	// Add to history, keeping only the most recent MaxSize entries
-	h.Entries = append(h.Entries, entry)
-	if len(h.Entries) > h.MaxSize {
-		h.Entries = h.Entries[len(h.Entries)-h.MaxSize:]
+	key := strings.TrimSpace(string(output))
+	if !keyPattern.MatchString(key) {
+		return "", fmt.Errorf("%w: key_command output does not look like an API key (expected one line of at least 16 characters without spaces)", aid.ErrAPIKeyMissing)
 	}
+	return key, nil
 }
 
-// Get history context as formatted string for the prompt
-func (h *CommandHistory) GetContext() string {
-	if len(h.Entries) == 0 {
-		return ""
+// Load a provider's API key from the configuration file
+func loadKey(provider string) (string, error) {
+	data, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return "", aid.ErrAPIKeyMissing
 	}
-	
-	var context strings.Builder
-	context.WriteString("\n\nRecent command history (for context):\n")
-	
-	for i, entry := range h.Entries {
-		context.WriteString(fmt.Sprintf("\nCOMMAND %d: %s\nOUTPUT %d: %s\n", 
-			i+1, entry.Command, i+1, entry.Output))
+	if err != nil {
+		return "", err
+	}
+	config, _, err := aid.ParseConfig(data)
+	if _, invalid := err.(*aid.ConfigError); err != nil && !invalid {
+		return "", err
+	}
+	if apiKey := config.Key(provider); apiKey != "" {
+		return apiKey, nil
+	}
+	return "", aid.ErrAPIKeyMissing
+}
+
+// Load optional settings from the configuration file
+func loadConfig() (aid.Config, error) {
+	config, sources, warnings, err := aid.LoadLayeredConfig(configLayers())
+	configSources = sources
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "%sWarning: %s%s\n", colorYellow, warning, colorReset)
+	}
+	if _, ok := err.(*aid.ConfigError); ok {
+		return config, fmt.Errorf("%v (run with --repair-config to drop invalid keys)", err)
+	}
+	return config, err
+}
+
+// Layer that set each key of the loaded config, for config sources
+var configSources map[string]string
+
+// Config files in order of precedence, lowest first
+func configLayers() []aid.ConfigLayer {
+	return []aid.ConfigLayer{
+		{Name: "system", Path: systemConfigPath(runtime.GOOS)},
+		{Name: "user", Path: configFile},
 	}
-	
-	return context.String()
 }
 
-// Save API key to a configuration file
-func saveAPIKey(apiKey string) error {
-	configData := map[string]string{
-		"OPENAI_API_KEY": apiKey,
+// Machine-wide defaults that the user's config.json overrides
+func systemConfigPath(goos string) string {
+	if goos == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "dingus-copilot", "config.json")
 	}
-	configJSON, err := json.MarshalIndent(configData, "", "  ")
+	return "/etc/dingus-copilot/config.json"
+}
+
+// Settings that flags or environment variables can override, with the
+// effective value after resolveOptions
+var settingOverrides = []struct {
+	Key   string
+	Flag  string
+	Env   string
+	Value func() string
+}{
+	{"OPENAI_API_KEY", "", "OPENAI_API_KEY", func() string { return "(set)" }},
+	{"provider", "provider", "", func() string { return options.Provider }},
+	{"model", "model", "DINGUS_MODEL", func() string { return options.Model }},
+	{"temperature", "temperature", "", func() string {
+		if options.Temperature == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*options.Temperature, 'g', -1, 64)
+	}},
+	{"base_url", "", "OPENAI_BASE_URL", func() string { return options.BaseURL }},
+	{"org_id", "", "OPENAI_ORG_ID", func() string { return options.OrgID }},
+	{"project_id", "", "OPENAI_PROJECT_ID", func() string { return options.ProjectID }},
+	{"history_file", "history-file", "DINGUS_HISTORY_FILE", func() string { return historyFile }},
+	{"persona", "persona", "", func() string { return options.Persona }},
+}
+
+// Print each effective setting and the layer, environment variable or
+// flag that set it. Flags win over the environment, which wins over the
+// user config, which wins over the system config.
+func showConfigSources(w io.Writer, config aid.Config, env map[string]string) error {
+	data, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(configFile, configJSON, 0600)
+	values := map[string]string{}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		var text string
+		if json.Unmarshal(value, &text) != nil {
+			text = string(value)
+		}
+		values[key] = text
+	}
+	// Keys are never printed
+	for _, key := range []string{"OPENAI_API_KEY", "keys"} {
+		if _, ok := values[key]; ok {
+			values[key] = "(set)"
+		}
+	}
+
+	sources := map[string]string{}
+	for key := range values {
+		layer := configSources[key]
+		if layer == "system" {
+			layer += " " + systemConfigPath(runtime.GOOS)
+		} else if layer == "user" {
+			layer += " " + configFile
+		}
+		sources[key] = layer
+	}
+	for _, override := range settingOverrides {
+		switch {
+		case override.Flag != "" && flagsSet[override.Flag]:
+			sources[override.Key] = "flag --" + override.Flag
+		case override.Env != "" && env[override.Env] != "":
+			sources[override.Key] = "environment " + override.Env
+		default:
+			continue
+		}
+		values[override.Key] = override.Value()
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		fmt.Fprintln(w, "No settings are configured; defaults are in use.")
+	}
+	for _, key := range keys {
+		fmt.Fprintf(w, "%-24s %s %s\n", key, padRight(values[key], 30), sources[key])
+	}
+	return nil
 }
 
-// Load API key from configuration file
-func loadAPIKey() (string, error) {
-	if _, err := os.Stat(configFile); err == nil {
+// Rewrite the config file keeping only known keys with valid values
+func repairConfig() error {
+	return aid.WithFileLock(configFile, func() error {
 		data, err := os.ReadFile(configFile)
 		if err != nil {
-			return "", err
+			return err
 		}
-		var configData map[string]string
-		err = json.Unmarshal(data, &configData)
-		if err != nil {
-			return "", err
+		// Malformed JSON cannot be salvaged key by key
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("%v; fix it by hand or run cleanup", aid.DescribeJSONError(data, err))
+		}
+
+		config, warnings, err := aid.ParseConfig(data)
+		for _, warning := range warnings {
+			fmt.Println(strings.Replace(warning, "ignoring", "dropping", 1))
+		}
+		if configErr, ok := err.(*aid.ConfigError); ok {
+			for _, problem := range configErr.Problems {
+				fmt.Printf("dropping invalid value: %s\n", problem)
+			}
 		}
-		if apiKey, exists := configData["OPENAI_API_KEY"]; exists {
-			return apiKey, nil
+
+		configJSON, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
 		}
+		return aid.WriteFileAtomic(configFile, configJSON, 0600)
+	})
+}
+
+// Check the temperature is within the range the API accepts
+func validateTemperature(temperature float64) error {
+	if temperature < minTemperature || temperature > maxTemperature {
+		return fmt.Errorf("temperature must be between %.0f and %.0f, got %g", minTemperature, maxTemperature, temperature)
 	}
-	return "", fmt.Errorf("API key not found")
+	return nil
 }
 
-// Remove all configuration files
-func cleanupConfigFiles() error {
-	// Remove the entire config directory
-	err := os.RemoveAll(configDir)
+// Float flag that is left nil unless set, so config values can fill it
+type optionalFloat struct {
+	target **float64
+}
+
+func (f optionalFloat) String() string {
+	if f.target == nil || *f.target == nil {
+		return ""
+	}
+	return strconv.FormatFloat(**f.target, 'g', -1, 64)
+}
+
+func (f optionalFloat) Set(value string) error {
+	parsed, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return fmt.Errorf("failed to remove config files: %v", err)
+		return err
 	}
+	*f.target = &parsed
 	return nil
 }
 
-// Get command suggestion from OpenAI API and return token usage
-func getCommandSuggestion(query string) (string, int, int, error) {
-	// Add command history context to the prompt
-	historyContext := history.GetContext()
-	
-	prompt := fmt.Sprintf(`
-Always adhere to these rules when suggesting the command:
-- The command must be a valid terminal command.
-- It should be relevant to the user's query.
-- Continue the conversation by giving useful commands.
-- Consider the chat history and make the command more useful than before based on the user's follow up questions.
-- Use information from the chat history to help generate the command.
-- The command should not require user input.
-- It must not be destructive or modify the system in any harmful way.
-- The command should not require additional software, configuration, or access to external resources, the internet, or sensitive information.
-
-Format your response as follows:
-- Only respond with the suggested command.
-- Ensure the command is executable in the current session.
-- Do not include any additional information or context.
-- Do not include any formattings.
-- Do not include 'dingus-copilot' in the command.
+// Repeatable name=value flag used for query template variables
+type keyValueFlag map[string]string
 
-The command line history is as follows:
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
 
-<COMMAND_HISTORY> %s </COMMAND_HISTORY>
+func (f keyValueFlag) Set(value string) error {
+	key, val, found := strings.Cut(value, "=")
+	if !found || key == "" {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	f[key] = val
+	return nil
+}
 
-The user query is as follows:
+// Register every flag; this is also the source for the help text
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("dingus-copilot", flag.ContinueOnError)
+	fs.StringVar(&options.Provider, "provider", "", "API `provider` whose key and endpoint to use (default "+aid.DefaultProvider+")")
+	fs.StringVar(&options.Model, "model", "", "OpenAI `model` to use (default "+aid.DefaultModel+")")
+	fs.Var(optionalFloat{&options.Temperature}, "temperature", "Sampling temperature `value` between 0 and 2")
+	options.Args = map[string]string{}
+	fs.Var(keyValueFlag(options.Args), "arg", "Set a `name=value` used by {{.name}} placeholders in the query (repeatable)")
+	fs.BoolVar(&options.AutoFix, "auto-fix", false, fmt.Sprintf("Ask for a corrected command when one fails, up to %d times", maxFixAttempts))
+	fs.BoolVar(&options.ReplaceRun, "replace-run", false, "Ask for a value for each placeholder such as <filename> or FILE before running")
+	fs.BoolVar(&options.Yes, "yes", false, "Run the suggestion without asking, unless it is risky, destructive, too long or not allowed")
+	fs.BoolVar(&options.Eval, "eval", false, "Print only the command to stdout, for use with eval in your shell")
+	fs.StringVar(&options.Tool, "tool", "", "Only suggest commands for this `tool`, e.g. git or docker")
+	fs.BoolVar(&options.Deterministic, "deterministic", false, "Use temperature 0 and reuse cached suggestions for the same query and history")
+	fs.BoolVar(&options.RawPrompt, "raw-prompt", false, "Send the query as the only message, without rules or history, and print the reply")
+	fs.BoolVar(&options.Explain, "explain", false, "Explain the suggested command before asking to run it")
+	fs.StringVar(&options.Persona, "persona", "", "Preset `name` for prompt and defaults: concise, teacher or cautious")
+	fs.BoolVar(&options.Interactive, "interactive", false, "Ask for queries in a loop until exit or Ctrl+D")
+	fs.BoolVar(&options.Stats, "stats", false, "With --interactive, summarise queries, commands run, tokens, cost and time on exit")
+	fs.BoolVar(&options.Learn, "learn", false, "Guess what the suggested command does before the model explains it")
+	fs.IntVar(&options.RetryOnFail, "retry-on-fail", 0, "Run a command that exits non-zero up to `N` more times")
+	fs.BoolVar(&options.SplitStreams, "split-streams", false, "Capture stdout and stderr separately, labelling stderr")
+	fs.BoolVar(&options.Steps, "steps", false, "Suggest a sequence of commands and confirm each one")
+	fs.BoolVar(&options.Short, "short", false, "Ask for a short one-line command")
+	fs.BoolVar(&options.Long, "long", false, "Allow a long pipeline or multi-line command")
+	fs.IntVar(&options.MaxTokens, "max-tokens", 0, "Most tokens the model may reply with, overriding --short and --long")
+	fs.BoolVar(&options.KeepGoing, "keep-going", false, "In --steps mode, continue after a step fails")
+	fs.IntVar(&options.Head, "head", 0, "Show and store only the first `N` lines of command output")
+	fs.IntVar(&options.Tail, "tail", 0, "Show and store only the last `N` lines of command output")
+	fs.StringVar(&options.HistoryFile, "history-file", "", "Keep history in this `file` instead of the default (or set DINGUS_HISTORY_FILE)")
+	fs.StringVar(&options.Cwd, "cwd", "", "Run the suggested command in this `directory`")
+	fs.StringVar(&options.OutputFile, "output-file", "", "Write the full command output to this `file`")
+	fs.StringVar(&options.MetricsFile, "metrics-file", "", "Append a JSON metrics record per API call to this `file`")
+	fs.StringVar(&options.SavePrompt, "save-prompt", "", "Write the system and user prompt sent for the query to this `file`")
+	fs.BoolVar(&options.ExpandEnv, "expand-env", false, "Replace $VAR in the query with its value before sending it, except secrets")
+	fs.BoolVar(&options.FromClipboard, "from-clipboard", false, "Include the clipboard contents, such as an error message, as context")
+	fs.IntVar(&options.Context, "context", -1, "Send only the last `N` history entries with this query (0 sends none)")
+	fs.BoolVar(&options.Fresh, "fresh", false, "Ignore existing history context for this query")
+	fs.BoolVar(&options.NoHistory, "no-history", false, "Do not record this query, command or output in history")
+	fs.BoolVar(&options.ResetAck, "reset-ack", false, "Show the configured banner again on the next run")
+	fs.BoolVar(&options.RepairConfig, "repair-config", false, "Rewrite config.json without unknown or invalid keys")
+	fs.BoolVar(&options.Trace, "trace", false, "Print a timing breakdown to stderr")
+	fs.BoolVar(&options.Debug, "debug", false, "Print text discarded from the model's reply to stderr")
+	fs.BoolVar(&options.Version, "version", false, "Print version and build information")
+	fs.BoolVar(&options.NoCost, "no-cost", false, "Hide the query cost line")
+	fs.StringVar(&options.CostFormat, "cost-format", "", "How costs are shown: human (rounded, the default) or raw (six decimal places)")
+	fs.BoolVar(&options.SessionCost, "session-cost", false, "In interactive mode, show the session's running cost after each query's cost")
+	fs.BoolVar(&options.NoColor, "no-color", false, "Print without colours or other ANSI styling")
+	fs.BoolVar(&options.NoWait, "no-wait", false, "Fail instead of waiting when the rate limit is reached")
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	return fs
+}
 
-<USER_QUESTION> %s </USER_QUESTION>
+// Parse command line flags, returning the remaining positional arguments
+func parseFlags(args []string) ([]string, error) {
+	fs := newFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		flagsSet[f.Name] = true
+	})
+	rest := fs.Args()
+	queryAfterDashes = len(rest) > 0 && len(args) > len(rest) && args[len(args)-len(rest)-1] == "--"
+	return rest, nil
+}
 
-Suggested command:`, historyContext, query)
+// Whether the query followed --, so it is taken literally
+var queryAfterDashes bool
 
-	reqBody := map[string]interface{}{
-		"model": "gpt-4o-mini",
-		"messages": []interface{}{
-			map[string]interface{}{"role": "system", "content": "You are a helpful assistant designed to suggest valid, safe, and relevant terminal commands based on user input."},
-			map[string]interface{}{"role": "user", "content": prompt},
-		},
-		"max_tokens": 100,
+// Split a leading @model token from the query words, as in
+// "dingus-copilot @gpt-4o explain this", returning "" when there is none
+func inlineModel(args []string) (string, []string) {
+	if len(args) == 0 || queryAfterDashes || !strings.HasPrefix(args[0], "@") {
+		return "", args
 	}
-	reqData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", 0, 0, err
+	// The token may be the start of a quoted query such as "@gpt-4o list files"
+	fields := strings.SplitN(args[0], " ", 2)
+	model := strings.TrimPrefix(fields[0], "@")
+	if model == "" {
+		return "", args
 	}
-
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(reqData))
-	if err != nil {
-		return "", 0, 0, err
+	rest := args[1:]
+	if len(fields) == 2 {
+		rest = append([]string{fields[1]}, rest...)
 	}
+	return model, rest
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+openaiAPIKey)
+// Names of the flags given on the command line
+var flagsSet = map[string]bool{}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", 0, 0, err
-	}
-	defer resp.Body.Close()
+// Subcommands shown in the help text
+var subcommands = []struct {
+	Usage       string
+	Description string
+}{
+	{"[flags] <query>", "Get a command suggestion"},
+	{"[flags] -- <query>", "Get a suggestion for a query starting with a dash"},
+	{"batch <file>", "Suggest a command for each line of a file without running them"},
+	{"export [--format sh|md] [-o file]", "Export accepted commands from history"},
+	{"version", "Print version and build information"},
+	{"update [--check]", "Check whether a newer release is available and where to get it"},
+	{"last", "Show the most recently accepted command and its output"},
+	{"fix", "Suggest a correction for the last command that failed in your shell"},
+	{"history [--fzf]", "Pick a past command to run again, copy or pin, with fzf if installed"},
+	{"history pin|unpin <n>", "Always include history entry n in the prompt, or stop doing so"},
+	{"config sources", "Show each effective setting and where it was set"},
+	{"doctor [--check-key]", "Check the config directory, API key, tools and network"},
+	{"completion bash|zsh", "Print shell completion and the dingus-eval function"},
+	{"cleanup", "Remove all configuration files"},
+	{"help", "Show this help"},
+}
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", 0, 0, fmt.Errorf("error from OpenAI API: %s - %s", resp.Status, string(bodyBytes))
+// Example invocations shown in the help text
+var helpExamples = []string{
+	"dingus-copilot how do I list files by size",
+	"dingus-copilot --temperature 0 find log files larger than 10MB",
+	"dingus-copilot --steps create a go module called demo",
+	"dingus-copilot --model gpt-4o -- -rf flag of rm explained as a safe dry run",
+	"dingus-copilot @gpt-4o rewrite this pipeline to handle spaces in file names",
+	"dingus-copilot --tail 20 show the system log",
+	"dingus-copilot --tool git undo my last commit but keep the changes",
+	"dingus-copilot --arg days=7 --arg dir=logs find files modified in the last {{.days}} days in {{.dir}}",
+	"dingus-copilot export --format md -o commands.md",
+}
+
+// Words offered by shell completion: subcommands and every registered flag
+func completionWords() []string {
+	var words []string
+	for _, sub := range subcommands {
+		if name := strings.Fields(sub.Usage)[0]; !strings.HasPrefix(name, "[") {
+			words = append(words, name)
+		}
 	}
+	newFlagSet().VisitAll(func(f *flag.Flag) {
+		words = append(words, "--"+f.Name)
+	})
+	return words
+}
 
-	var result map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return "", 0, 0, err
+// Wrapper that runs a suggestion in the calling shell after confirmation,
+// so cd, export and alias take effect. Works in both bash and zsh.
+const evalFunction = `# Run a suggestion in the current shell so cd, export and alias take effect
+dingus-eval() {
+    local cmd answer
+    cmd="$(dingus-copilot --eval "$@")" || return
+    [ -n "$cmd" ] || return
+    printf 'Command: %s\nRun it in this shell? (y/n): ' "$cmd" >&2
+    read -r answer
+    [ "$answer" = "y" ] && eval "$cmd"
+}
+`
+
+// Hooks that record each command typed at the prompt and its exit status
+// in the environment, where the fix subcommand reads them
+const bashLastCommandHook = `
+# Record the last command and its exit status for 'dingus-copilot fix'
+_dingus_record_last() {
+    local code=$?
+    export DINGUS_LAST_STATUS=$code
+    export DINGUS_LAST_COMMAND="$(HISTTIMEFORMAT= history 1 | sed 's/^ *[0-9]* *//')"
+    return $code
+}
+[[ "$PROMPT_COMMAND" == *_dingus_record_last* ]] || PROMPT_COMMAND="_dingus_record_last${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+`
+
+const zshLastCommandHook = `
+# Record the last command and its exit status for 'dingus-copilot fix'
+_dingus_record_command() { export DINGUS_LAST_COMMAND="$1" }
+_dingus_record_status() { export DINGUS_LAST_STATUS=$? }
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec _dingus_record_command
+add-zsh-hook precmd _dingus_record_status
+`
+
+// Build the shell integration script for bash or zsh
+func completionScript(shell string) (string, error) {
+	words := strings.Join(completionWords(), " ")
+	header := fmt.Sprintf("# dingus-copilot shell integration. Add this to your shell rc file:\n#   eval \"$(dingus-copilot completion %s)\"\n\n", shell)
+	switch shell {
+	case "bash":
+		return header + evalFunction + bashLastCommandHook + fmt.Sprintf(`
+_dingus_copilot() {
+    COMPREPLY=($(compgen -W "%s" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -F _dingus_copilot dingus-copilot dingus-eval
+`, words), nil
+	case "zsh":
+		return header + evalFunction + zshLastCommandHook + fmt.Sprintf(`
+_dingus_copilot() {
+    compadd -- %s
+}
+(( $+functions[compdef] )) && compdef _dingus_copilot dingus-copilot dingus-eval
+`, words), nil
 	}
+	return "", fmt.Errorf("unsupported shell %q (use bash or zsh)", shell)
+}
 
-	// Extract token usage
-	promptTokens, completionTokens := 0, 0
-	if usage, ok := result["usage"].(map[string]interface{}); ok {
-		if pt, ok := usage["prompt_tokens"].(float64); ok {
-			promptTokens = int(pt)
-		}
-		if ct, ok := usage["completion_tokens"].(float64); ok {
-			completionTokens = int(ct)
-		}
+// Print usage for every subcommand and registered flag
+func printHelp(w io.Writer) {
+	fmt.Fprintln(w, "dingus-copilot suggests terminal commands for a plain English query and can run them for you.")
+	fmt.Fprintln(w, "\nUsage:")
+	for _, sub := range subcommands {
+		fmt.Fprintf(w, "  dingus-copilot %-36s %s\n", sub.Usage, sub.Description)
 	}
 
-	if choices, ok := result["choices"].([]interface{}); ok && len(choices) > 0 {
-		if choice, ok := choices[0].(map[string]interface{}); ok {
-			if message, ok := choice["message"].(map[string]interface{}); ok {
-				if text, ok := message["content"].(string); ok {
-					return strings.TrimSpace(text), promptTokens, completionTokens, nil
-				}
-			}
-		}
+	fmt.Fprintln(w, "\nFlags:")
+	newFlagSet().VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(w, "  %-36s %s\n", strings.TrimSpace("--"+f.Name+" "+name), usage)
+	})
+	fmt.Fprintf(w, "  %-36s %s\n", "-h, --help", "Show this help")
+
+	fmt.Fprintln(w, "\nExit codes:")
+	for _, e := range exitCodeHelp {
+		fmt.Fprintf(w, "  %-36d %s\n", e.Code, e.Description)
 	}
 
-	return "", promptTokens, completionTokens, fmt.Errorf("no valid response from OpenAI API")
+	fmt.Fprintln(w, "\nExamples:")
+	for _, example := range helpExamples {
+		fmt.Fprintf(w, "  %s\n", example)
+	}
 }
 
-// Calculate API call cost
-func calculateCost(promptTokens, completionTokens int) float64 {
-	promptCost := float64(promptTokens) * inputTokenCost / 1_000_000
-	completionCost := float64(completionTokens) * outputTokenCost / 1_000_000
-	return promptCost + completionCost
+// Exit codes, so scripts can tell failures apart. A command that was run
+// exits with its own code.
+const (
+	exitOK       = 0
+	exitFailure  = 1 // Any other error
+	exitUsage    = 2
+	exitAPI      = 3
+	exitConfig   = 4
+	exitDeclined = 5 // The user chose not to run the command
+)
+
+// Exit codes shown in the help text
+var exitCodeHelp = []struct {
+	Code        int
+	Description string
+}{
+	{exitOK, "Success, or the suggested command ran and succeeded"},
+	{exitFailure, "Other errors"},
+	{exitUsage, "Usage error, such as an unknown flag or missing query"},
+	{exitAPI, "API error, such as a rejected key, rate limit or network failure"},
+	{exitConfig, "Configuration error"},
+	{exitDeclined, "The command was not run"},
 }
 
-// Run the suggested command
-func runCommand(command string) (string, error) {
-	cmd := exec.Command("bash", "-c", command)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+// Ends the process, replaceable for testing
+var exit = os.Exit
+
+// Log an error and exit with the given code
+func fail(code int, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	exit(code)
 }
 
-// Copy text to clipboard based on OS
-func copyToClipboard(text string) error {
-	var cmd *exec.Cmd
-	
-	switch runtime.GOOS {
-	case "darwin": // macOS
-		cmd = exec.Command("pbcopy")
-	case "linux":
-		cmd = exec.Command("xclip", "-selection", "clipboard")
-	case "windows":
-		cmd = exec.Command("cmd", "/c", "echo", text, "|", "clip")
-		return cmd.Run()
-	default:
-		return fmt.Errorf("unsupported platform")
+// Pick the exit code for an error returned from an API call or config load
+func errorExitCode(err error) int {
+	var apiErr *aid.APIError
+	var configErr *aid.ConfigError
+	switch {
+	case errors.As(err, &apiErr), errors.Is(err, aid.ErrAPIKeyMissing), errors.Is(err, aid.ErrAPIKeyInvalid),
+		errors.Is(err, aid.ErrRateLimited), errors.Is(err, aid.ErrLimitReached):
+		return exitAPI
+	case errors.As(err, &configErr):
+		return exitConfig
 	}
-	
-	// For non-Windows platforms
-	cmd.Stdin = strings.NewReader(text)
-	return cmd.Run()
+	return exitFailure
 }
 
-// Main function
-func main() {
-	// Initialize config directory and files
-	err := initConfigFiles()
-	if err != nil {
-		log.Fatalf("Error initialising config: %v", err)
+// Pick the exit code for a command that was run, passing its own code through
+func commandExitCode(result CommandResult) int {
+	var exitErr *exec.ExitError
+	switch {
+	case result.Err == nil:
+		return exitOK
+	case errors.Is(result.Err, errNotAllowed):
+		return exitDeclined
+	case errors.As(result.Err, &exitErr) && exitErr.ExitCode() > 0:
+		return exitErr.ExitCode()
 	}
+	return exitFailure
+}
 
-	// Check if this is a cleanup command
-	if len(os.Args) >= 2 && os.Args[1] == "cleanup" {
-		err := cleanupConfigFiles()
+// Fill options not set by flags from the config file and validate them
+func resolveOptions(config aid.Config, env map[string]string) error {
+	if options.Provider == "" {
+		options.Provider = config.Provider
+	}
+	if options.Provider == "" {
+		options.Provider = aid.DefaultProvider
+	}
+	if _, ok := aid.Providers[options.Provider]; !ok {
+		return fmt.Errorf("unknown provider %q", options.Provider)
+	}
+	options.ShareCWD = config.ShareCWD
+	options.Portable = config.Portable
+	options.ShareAliases = config.ShareAliases
+	options.RedactQuery = config.RedactQuery
+	options.SplitStreams = options.SplitStreams || config.SplitStreams
+	options.SandboxNetwork = config.SandboxNetwork
+	options.RedactEnv = config.RedactEnv
+	options.Standalone = config.Standalone
+	options.SessionCost = options.SessionCost || config.SessionCost
+	if options.CostFormat == "" {
+		options.CostFormat = config.CostFormat
+	}
+	switch options.CostFormat {
+	case "":
+		options.CostFormat = costHuman
+	case costHuman, costRaw:
+	default:
+		return fmt.Errorf("unknown cost format %q (use %s or %s)", options.CostFormat, costHuman, costRaw)
+	}
+	switch config.Clipboard {
+	case "", clipboardTools, clipboardOSC52:
+		options.Clipboard = config.Clipboard
+	default:
+		return fmt.Errorf("unknown clipboard %q (use %s or %s)", config.Clipboard, clipboardTools, clipboardOSC52)
+	}
+	tlsFiles := aid.TLSFiles{CACert: config.CACert, ClientCert: config.ClientCert, ClientKey: config.ClientKey}
+	if tlsFiles.Set() {
+		transport, err := aid.NewTLSTransport(tlsFiles)
 		if err != nil {
-			log.Fatalf("Error cleaning up config files: %v", err)
+			return err
 		}
-		fmt.Printf("%sConfiguration files removed successfully!%s\n", colorGreen, colorReset)
-		return
+		apiTransport = transport
 	}
-
-	// Check if query argument is provided
-	if len(os.Args) < 2 {
-		fmt.Println("Usage:")
-		fmt.Println("  dingus-copilot <query>     - Get command suggestion")
-		fmt.Println("  dingus-copilot cleanup     - Remove all configuration files")
-		os.Exit(1)
+	options.KeepTrailingText = config.KeepTrailingText
+	if config.MaxCommandLength < 0 {
+		return fmt.Errorf("max_command_length must not be negative")
 	}
-	
-	// Join all arguments as the query except for the program name
-	query := strings.Join(os.Args[1:], " ")
-
-	// Try loading API key from config file
-	openaiAPIKey, err = loadAPIKey()
-	if err != nil || openaiAPIKey == "" {
-		// If API key is not found or empty, ask user for it and save it
-		fmt.Print("Enter your OpenAI API Key: ")
-		reader := bufio.NewReader(os.Stdin)
-		apiKey, err := reader.ReadString('\n')
+	options.MaxCommandLength = config.MaxCommandLength
+	if options.MaxCommandLength == 0 {
+		options.MaxCommandLength = defaultMaxCommandLength
+	}
+	options.AllowedCommands = config.AllowedCommands
+	interactivePrograms = append(interactivePrograms, config.InteractiveCommands...)
+	if config.HistoryFormat != "" && !containsString(aid.HistoryFormats, config.HistoryFormat) {
+		return fmt.Errorf("unknown history_format %q (use %s)", config.HistoryFormat, strings.Join(aid.HistoryFormats, ", "))
+	}
+	history.Format = config.HistoryFormat
+	if config.MinOutputWords < 0 {
+		return fmt.Errorf("min_output_store_words must not be negative")
+	}
+	history.MinWords = config.MinOutputWords
+	history.Dedup = config.DedupHistory
+	if config.HistoryOutputWords < 0 {
+		return fmt.Errorf("history_output_words must not be negative")
+	}
+	if config.HistoryOutputWords > 0 {
+		history.MaxWords = config.HistoryOutputWords
+	}
+	if config.DisplayMaxBytes < 0 {
+		return fmt.Errorf("display_max_bytes must not be negative")
+	}
+	options.DisplayMaxBytes = config.DisplayMaxBytes
+	if config.PagerLines < 0 {
+		return fmt.Errorf("pager_lines must not be negative")
+	}
+	options.PagerLines = config.PagerLines
+	if options.PagerLines == 0 {
+		options.PagerLines = defaultPagerLines
+	}
+	options.Pager = config.Pager
+	if config.HistoryMaxAge < 0 {
+		return fmt.Errorf("history_max_age_minutes must not be negative")
+	}
+	history.MaxAge = time.Duration(config.HistoryMaxAge) * time.Minute
+	if options.Cwd != "" {
+		dir, err := filepath.Abs(options.Cwd)
 		if err != nil {
-			log.Fatalf("Error reading API key: %v", err)
+			return err
 		}
-		openaiAPIKey = strings.TrimSpace(apiKey)
-
-		// Save the key to the configuration file
-		err = saveAPIKey(openaiAPIKey)
-		if err != nil {
-			log.Fatalf("Error saving API key: %v", err)
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("--cwd: %v", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("--cwd: %s is not a directory", dir)
 		}
-		fmt.Println("API key saved.")
+		options.Cwd = dir
 	}
-
-	// Get the suggested command from OpenAI and token usage
-	suggestedCommand, promptTokens, completionTokens, err := getCommandSuggestion(query)
-	if err != nil {
-		log.Fatalf("Error getting command suggestion: %v", err)
+	if options.Context < -1 {
+		return fmt.Errorf("--context must not be negative")
 	}
-
-	// Calculate the cost
-	cost := calculateCost(promptTokens, completionTokens)
-
-	// Output the suggested command with decoration
-	fmt.Printf("\n%s%s%sSuggested command:%s %s%s%s%s%s\n\n", 
-		colorBold, colorYellow, colorBold, 
-		colorReset,
-		colorCyan, colorBold, 
-		suggestedCommand,
-		colorReset, colorReset)
-		
-	// Output the token usage and cost in purple
-	fmt.Printf("%sQuery cost: $%.6f%s\n\n", colorPurple, cost, colorReset)
-
-	// Ask if the user wants to run the command
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Do you want to run this command? (y/n/c - 'c' to copy to clipboard): ")
-	confirm, err := reader.ReadString('\n')
-	if err != nil {
-		log.Fatalf("Error reading confirmation: %v", err)
+	if options.Short && options.Long {
+		return fmt.Errorf("--short and --long cannot be used together")
+	}
+	if options.MaxTokens < 0 {
+		return fmt.Errorf("--max-tokens must not be negative")
+	}
+	if options.RetryOnFail < 0 {
+		return fmt.Errorf("--retry-on-fail must not be negative")
+	}
+	if config.MaxPromptTokens < 0 {
+		return fmt.Errorf("max_prompt_tokens must not be negative")
+	}
+	options.MaxPromptTokens = config.MaxPromptTokens
+	if options.MaxPromptTokens == 0 {
+		options.MaxPromptTokens = defaultMaxPromptTokens
+	}
+	options.Retries = defaultRetries
+	if config.Retries != nil {
+		if *config.Retries < 0 {
+			return fmt.Errorf("retries must not be negative")
+		}
+		options.Retries = *config.Retries
 	}
-	confirm = strings.TrimSpace(strings.ToLower(confirm))
 
-	var output string
-	switch confirm {
-	case "y":
-		// Run the suggested command
-		output, err = runCommand(suggestedCommand)
-		if err != nil {
+	// Keep only the last accepted command, in its own file unless one is given
+	if config.RememberLast {
+		history.MaxSize = 1
+		if options.HistoryFile == "" && env["DINGUS_HISTORY_FILE"] == "" {
+			historyFile = lastFile
+		}
+	}
+	options.BaseURL = strings.TrimRight(env["OPENAI_BASE_URL"], "/")
+	if options.BaseURL == "" {
+		options.BaseURL = aid.Providers[options.Provider].BaseURL
+	}
+	if options.Model == "" {
+		options.Model = env["DINGUS_MODEL"]
+	}
+	options.OrgID, options.ProjectID = config.OrgID, config.ProjectID
+	options.KeyCommand = config.KeyCommand
+	if env["OPENAI_ORG_ID"] != "" {
+		options.OrgID = env["OPENAI_ORG_ID"]
+	}
+	if env["OPENAI_PROJECT_ID"] != "" {
+		options.ProjectID = env["OPENAI_PROJECT_ID"]
+	}
+	if options.Model == "" {
+		options.Model = config.Model
+	}
+	if options.Model == "" {
+		options.Model = aid.Providers[options.Provider].Model
+	}
+	if options.Model == "" {
+		options.Model = aid.DefaultModel
+	}
+	if options.Temperature == nil {
+		options.Temperature = config.Temperature
+	}
+	if options.Persona == "" {
+		options.Persona = config.Persona
+	}
+	if options.Persona != "" {
+		preset, ok := personas[options.Persona]
+		if !ok {
+			return fmt.Errorf("unknown persona %q (use %s)", options.Persona, strings.Join(personaNames(), ", "))
+		}
+		applyPersona(preset)
+	}
+	if options.Deterministic {
+		zero := 0.0
+		options.Temperature = &zero
+	}
+	if options.Temperature != nil {
+		if err := validateTemperature(*options.Temperature); err != nil {
+			return err
+		}
+	}
+	if options.Head < 0 || options.Tail < 0 {
+		return fmt.Errorf("--head and --tail must not be negative")
+	}
+	return nil
+}
+
+// Report whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Build the chat completions request body
+func buildRequestBody(system, prompt string, maxTokens int) map[string]interface{} {
+	reqBody := map[string]interface{}{
+		"model": options.Model,
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": system},
+			map[string]interface{}{"role": "user", "content": prompt},
+		},
+		"max_tokens": maxTokens,
+	}
+	if options.Temperature != nil {
+		reqBody["temperature"] = *options.Temperature
+	}
+	return reqBody
+}
+
+// Sanitise text for use on a single shell comment line
+func shellComment(text string) string {
+	text = strings.ReplaceAll(text, "\r", " ")
+	return "# " + strings.ReplaceAll(text, "\n", " ")
+}
+
+// Render accepted history commands as a shell script or markdown document
+func exportHistory(entries []aid.HistoryEntry, format string) (string, error) {
+	var out strings.Builder
+	switch format {
+	case "sh":
+		out.WriteString("#!/usr/bin/env bash\n")
+		out.WriteString("# Commands exported from dingus-copilot history\n")
+		for _, entry := range entries {
+			out.WriteString("\n")
+			if entry.Query != "" {
+				out.WriteString(shellComment(entry.Query) + "\n")
+			}
+			out.WriteString(entry.Command + "\n")
+		}
+	case "md":
+		out.WriteString("# dingus-copilot history\n")
+		for _, entry := range entries {
+			query := strings.Join(strings.Fields(entry.Query), " ")
+			if query == "" {
+				query = "(no query recorded)"
+			}
+			fence := "```"
+			for strings.Contains(entry.Command, fence) {
+				fence += "`"
+			}
+			out.WriteString(fmt.Sprintf("\n## %s\n\n%sbash\n%s\n%s\n", query, fence, entry.Command, fence))
+		}
+	default:
+		return "", fmt.Errorf("unsupported export format %q (use sh or md)", format)
+	}
+	return out.String(), nil
+}
+
+// Returned by a subcommand given positional arguments it does not take, so
+// that a query such as "export PATH to include ~/bin" is sent as a query
+var errNotSubcommand = errors.New("not a subcommand")
+
+// Handle the export subcommand, writing history to a file
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "sh", "Export format: sh or md")
+	outputPath := fs.String("o", "", "Output file (default dingus-copilot-history.<format>)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errNotSubcommand
+	}
+
+	err := history.Load(historyFile)
+	if err != nil {
+		return err
+	}
+	if len(history.Entries) == 0 {
+		return fmt.Errorf("no history to export")
+	}
+
+	content, err := exportHistory(history.Entries, *format)
+	if err != nil {
+		return err
+	}
+
+	path := *outputPath
+	if path == "" {
+		path = "dingus-copilot-history." + *format
+	}
+	mode := os.FileMode(0644)
+	if *format == "sh" {
+		mode = 0755
+	}
+	err = os.WriteFile(path, []byte(content), mode)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%sExported %d commands to %s%s\n", colorGreen, len(history.Entries), path, colorReset)
+	return nil
+}
+
+// Build metadata, set with -ldflags "-X main.version=v1.2.3 -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// Describe this build for --version and bug reports
+func versionString() string {
+	return fmt.Sprintf("dingus-copilot %s (commit %s, built %s, %s/%s)", version, commit, buildDate, runtime.GOOS, runtime.GOARCH)
+}
+
+// A setup check run by the doctor subcommand
+type doctorCheck struct {
+	Name string
+	Run  func() error
+}
+
+// Run the setup checks and print a pass/fail checklist, returning how many failed
+func runDoctor(w io.Writer, args []string, env map[string]string) (int, error) {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	checkKey := fs.Bool("check-key", false, "Also ask the API whether the key is accepted")
+	if err := fs.Parse(args); err != nil {
+		return 0, err
+	}
+	if fs.NArg() > 0 {
+		return 0, errNotSubcommand
+	}
+	return printChecks(w, doctorChecks(env, *checkKey)), nil
+}
+
+// Print each check's result and count the failures
+func printChecks(w io.Writer, checks []doctorCheck) int {
+	failures := 0
+	for _, check := range checks {
+		if err := check.Run(); err != nil {
+			failures++
+			fmt.Fprintf(w, "%s[fail]%s %s: %v\n", colorRed, colorReset, check.Name, err)
+		} else {
+			fmt.Fprintf(w, "%s[ok]%s   %s\n", colorGreen, colorReset, check.Name)
+		}
+	}
+	if failures == 0 {
+		fmt.Fprintf(w, "\n%sEverything looks good.%s\n", colorGreen, colorReset)
+	} else {
+		fmt.Fprintf(w, "\n%s%d check(s) failed.%s\n", colorRed, failures, colorReset)
+	}
+	return failures
+}
+
+// The checks run by doctor for the resolved provider and settings
+func doctorChecks(env map[string]string, checkKey bool) []doctorCheck {
+	// Find the key the way a query does: the environment, then
+	// key_command, then the config file
+	provider := aid.Providers[options.Provider]
+	apiKey := env["OPENAI_API_KEY"]
+	var keyErr error
+	if apiKey == "" || provider.Name != "openai" {
+		if options.KeyCommand != "" {
+			apiKey, keyErr = fetchKey(options.KeyCommand)
+		} else {
+			apiKey, _ = loadKey(provider.Name)
+		}
+	}
+
+	keyCheckName := provider.DisplayName + " API key is set"
+	if provider.NoKey {
+		keyCheckName = provider.DisplayName + " needs no API key"
+	}
+	checks := []doctorCheck{
+		{"Config directory is writable", func() error {
+			f, err := os.CreateTemp(configDir, "doctor-*")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			return os.Remove(f.Name())
+		}},
+		{keyCheckName, func() error {
+			if keyErr != nil {
+				return keyErr
+			}
+			if apiKey == "" && !provider.NoKey {
+				return fmt.Errorf("no key found; run a query to be asked for one, or set OPENAI_API_KEY")
+			}
+			return nil
+		}},
+		{"Shell is installed", func() error {
+			_, err := lookPath(aid.SelectShell(runtime.GOOS).Path)
+			return err
+		}},
+		{"Clipboard tool is installed", func() error {
+			if options.Clipboard == clipboardOSC52 {
+				return nil
+			}
+			_, err := lookPath(clipboardTool(runtime.GOOS))
+			return err
+		}},
+		{"API is reachable at " + options.BaseURL, func() error {
+			status, err := probeAPI("")
+			if err == nil && status >= 500 {
+				err = fmt.Errorf("server returned %d", status)
+			}
+			return err
+		}},
+	}
+	if checkKey {
+		checks = append(checks, doctorCheck{"API key is accepted", func() error {
+			status, err := probeAPI(apiKey)
+			if err != nil {
+				return err
+			}
+			if status == http.StatusUnauthorized {
+				return aid.ErrAPIKeyInvalid
+			}
+			if status != http.StatusOK {
+				return fmt.Errorf("server returned %d", status)
+			}
+			return nil
+		}})
+	}
+	return checks
+}
+
+// Program copyToClipboard uses on each platform
+func clipboardTool(goos string) string {
+	switch goos {
+	case "darwin":
+		return "pbcopy"
+	case "windows":
+		return "clip"
+	}
+	return "xclip"
+}
+
+// Transport for API requests, set when the config names TLS certificate
+// files; nil uses the default transport
+var apiTransport http.RoundTripper
+
+// Request the free models endpoint, returning the HTTP status
+func probeAPI(apiKey string) (int, error) {
+	req, err := http.NewRequest("GET", options.BaseURL+"/models", nil)
+	if err != nil {
+		return 0, err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	client := &http.Client{Timeout: 5 * time.Second, Transport: apiTransport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Latest release of the project, replaceable for testing
+var releasesURL = "https://api.github.com/repos/dingus-technology/DINGUS-AID/releases/latest"
+
+// Check for a newer release. Network and API failures are skipped quietly
+// so the check is safe to run offline. With check set only the versions are
+// reported; otherwise a newer release also comes with download instructions.
+func runUpdate(check bool) error {
+	latest, url, err := latestRelease()
+	if err != nil {
+		return nil
+	}
+	switch {
+	case version == "dev":
+		fmt.Printf("The latest release is %s; this is a development build.\n", latest)
+	case compareVersions(latest, version) > 0:
+		fmt.Printf("%sA new version is available: %s (you have %s).%s\n", colorGreen, latest, version, colorReset)
+		if !check {
+			fmt.Printf("Download it from %s\n", url)
+			fmt.Println("Automatic installation is not supported yet; replace the dingus-copilot binary with the download.")
+		}
+	default:
+		fmt.Printf("dingus-copilot %s is up to date.\n", version)
+	}
+	return nil
+}
+
+// Fetch the tag and page of the latest release
+func latestRelease() (string, string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(releasesURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("releases API returned %s", resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", "", err
+	}
+	if release.TagName == "" {
+		return "", "", fmt.Errorf("release has no tag")
+	}
+	return release.TagName, release.HTMLURL, nil
+}
+
+// Compare dotted versions such as v1.10.0 and 1.9.2 numerically,
+// returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(strings.SplitN(aParts[i], "-", 2)[0])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(strings.SplitN(bParts[i], "-", 2)[0])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Ask the user for an API key and save it, failing if none is entered
+func promptForAPIKey(message string) error {
+	fmt.Print(message)
+	apiKey, err := stdin.ReadString('\n')
+	if err != nil && apiKey == "" {
+		return fmt.Errorf("failed to read API key: %v", err)
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	if apiKey == "" {
+		return fmt.Errorf("%w: no API key entered", aid.ErrAPIKeyMissing)
+	}
+	activeAPIKey = apiKey
+
+	// Save the key to the configuration file
+	err = saveKey(options.Provider, activeAPIKey)
+	if err != nil {
+		return fmt.Errorf("failed to save API key: %v", err)
+	}
+	fmt.Println("API key saved.")
+	return nil
+}
+
+// Fingerprint a key so a rejected one can be remembered without storing it twice
+func keyFingerprint(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Remember that the API rejected this key
+func markKeyInvalid(apiKey string) {
+	err := os.WriteFile(invalidKeyFile, []byte(keyFingerprint(apiKey)), 0600)
+	if err != nil {
+		fmt.Printf("Error recording invalid key: %v\n", err)
+	}
+}
+
+// Report whether this key was rejected by a previous run
+func isKeyMarkedInvalid(apiKey string) bool {
+	data, err := os.ReadFile(invalidKeyFile)
+	return err == nil && strings.TrimSpace(string(data)) == keyFingerprint(apiKey)
+}
+
+// Suggest a command for each query in a file without running anything.
+// Suggestions are added to in-memory history so later lines have context.
+func runBatch(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var totalCost float64
+	count := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		query := strings.TrimSpace(line)
+		if query == "" || strings.HasPrefix(query, "#") {
+			continue
+		}
+		count++
+
+		suggestion, err := suggestCommand(query)
+		totalCost += calculateCost(suggestion.PromptTokens, suggestion.CompletionTokens)
+		if errors.Is(err, aid.ErrAPIKeyInvalid) {
+			return err
+		}
+
+		fmt.Printf("\n%s[%d] %s%s\n", colorBold, count, query, colorReset)
+		if err != nil {
+			fmt.Printf("    Error: %v\n", err)
+			continue
+		}
+		fmt.Printf("    %s%s%s\n", colorCyan, suggestion.Text, colorReset)
+		history.Add(query, suggestion.Text, "")
+	}
+
+	if showCost() {
+		fmt.Printf("\n%sTotal cost for %d queries: %s%s\n", colorPurple, count, formatCost(totalCost), colorReset)
+	}
+	return nil
+}
+
+// Usage counted across an interactive session
+type sessionStats struct {
+	Queries          int
+	Run              int
+	PromptTokens     int
+	CompletionTokens int
+	Started          time.Time
+}
+
+// Count the tokens used by a response
+func (s *sessionStats) add(response aid.ChatResponse) {
+	s.PromptTokens += response.PromptTokens
+	s.CompletionTokens += response.CompletionTokens
+}
+
+// Describe the session's usage up to now
+func (s sessionStats) summary(now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%sSession summary:%s\n", colorBold, colorReset)
+	fmt.Fprintf(&b, "  Queries:  %d\n", s.Queries)
+	fmt.Fprintf(&b, "  Run:      %d\n", s.Run)
+	fmt.Fprintf(&b, "  Tokens:   %d\n", s.PromptTokens+s.CompletionTokens)
+	if showCost() {
+		fmt.Fprintf(&b, "  Cost:     %s\n", formatCost(calculateCost(s.PromptTokens, s.CompletionTokens)))
+	}
+	fmt.Fprintf(&b, "  Time:     %s\n", now.Sub(s.Started).Round(time.Second))
+	return b.String()
+}
+
+// Ask for queries until exit or end of input, offering to run each
+// suggestion, and return what the session used
+func runInteractive(reader *bufio.Reader) sessionStats {
+	stats := sessionStats{Started: time.Now()}
+	fmt.Println("Type a query, or exit to quit.")
+	for {
+		fmt.Printf("%sdingus>%s ", colorBold, colorReset)
+		line, err := reader.ReadString('\n')
+		query := strings.TrimSpace(line)
+		if err != nil && query == "" {
+			fmt.Println()
+			return stats
+		}
+		if query == "exit" || query == "quit" {
+			return stats
+		}
+		if query == "" {
+			continue
+		}
+		stats.Queries++
+
+		prompt := query
+		if options.ExpandEnv {
+			prompt = expandQueryEnv(query, os.LookupEnv)
+		}
+		// Ctrl+C while a command runs stops only that command, after which
+		// the user may ask again with its partial output as context
+		request := prompt
+		for {
+			result, ok := suggestAndRun(reader, query, request, &stats)
+			if !ok {
+				return stats
+			}
+			if !result.Interrupted() {
+				break
+			}
+			fmt.Print("Command cancelled. Ask for a different command? (y/n): ")
+			answer, err := reader.ReadString('\n')
+			if err != nil && answer == "" {
+				fmt.Println()
+				return stats
+			}
+			if strings.TrimSpace(strings.ToLower(answer)) != "y" {
+				break
+			}
+			request = alternativePrompt(prompt, result)
+		}
+	}
+}
+
+// Ask for a command in the interactive session and run it once confirmed.
+// Returns the result, empty when nothing ran, and false when the session
+// should end.
+func suggestAndRun(reader *bufio.Reader, query, prompt string, stats *sessionStats) (CommandResult, bool) {
+	suggestion, err := suggestCommand(prompt)
+	stats.add(suggestion)
+	if err != nil {
+		fmt.Printf("Error getting command suggestion: %v%s\n", err, errorHint(err))
+		return CommandResult{}, !errors.Is(err, aid.ErrAPIKeyInvalid)
+	}
+
+	command := normalizeSuggestion(suggestion.Text)
+	fmt.Printf("\n%s%sSuggested command:%s %s%s%s\n\n", colorBold, colorYellow, colorReset, colorCyan, command, colorReset)
+	if showCost() {
+		line := "Query cost: " + formatCost(calculateCost(suggestion.PromptTokens, suggestion.CompletionTokens))
+		if options.SessionCost {
+			line += fmt.Sprintf(" (session %s)", formatCost(calculateCost(stats.PromptTokens, stats.CompletionTokens)))
+		}
+		fmt.Printf("%s%s%s\n\n", colorPurple, line, colorReset)
+	}
+	warnPipeToShell(command)
+	risk := aid.NormalizeRisk(suggestion.Risk)
+	fmt.Printf("%sRun this command? (y/n):%s ", riskColor(risk), colorReset)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return CommandResult{}, false
+	}
+	if strings.TrimSpace(strings.ToLower(answer)) != "y" || !confirmBeforeRun(reader, command, risk) {
+		fmt.Println("Command not executed.")
+		return CommandResult{}, true
+	}
+	result := runWithFixes(query, command)
+	stats.Run++
+	return result, true
+}
+
+// Extend a query after its command was cancelled, asking for a different
+// approach and passing on the output produced before the cancel
+func alternativePrompt(prompt string, result CommandResult) string {
+	output := aid.LimitLines(result.Output, 0, 20)
+	return fmt.Sprintf(`%s
+
+The command %q was cancelled by the user before it finished, so suggest a different command. Output before it was cancelled:
+<OUTPUT> %s </OUTPUT>`, prompt, result.Command, output)
+}
+
+// Settings that can come from the environment or a .env file
+var envSettingKeys = []string{"OPENAI_API_KEY", "OPENAI_BASE_URL", "OPENAI_ORG_ID", "OPENAI_PROJECT_ID", "DINGUS_MODEL", "DINGUS_HISTORY_FILE"}
+
+// Load settings from ~/.dingus-copilot/.env, then ./.env, then the process
+// environment, each overriding the last. Flags override all of these, and
+// all of these override config.json.
+//
+// A project .env comes with whatever directory you are in, so its
+// OPENAI_BASE_URL is only used when the same file sets OPENAI_API_KEY.
+// Otherwise a cloned repository could send your saved key to its own server.
+func loadEnvSettings() map[string]string {
+	settings := map[string]string{}
+	ignoredBaseURL := ""
+	for _, path := range []string{filepath.Join(configDir, ".env"), ".env"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		values := parseDotEnv(string(data))
+		if path == ".env" && values["OPENAI_BASE_URL"] != "" && values["OPENAI_API_KEY"] == "" {
+			ignoredBaseURL = values["OPENAI_BASE_URL"]
+			delete(values, "OPENAI_BASE_URL")
+		}
+		for key, value := range values {
+			settings[key] = value
+		}
+	}
+	for _, key := range envSettingKeys {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			settings[key] = value
+		}
+	}
+	if ignoredBaseURL != "" && os.Getenv("OPENAI_BASE_URL") == "" {
+		fmt.Fprintf(os.Stderr, "%sWarning: ignoring OPENAI_BASE_URL=%s from ./.env because that file does not also set OPENAI_API_KEY. Set it in the environment or %s to use it.%s\n",
+			colorYellow, ignoredBaseURL, filepath.Join(configDir, ".env"), colorReset)
+	}
+	return settings
+}
+
+// Print the most recent history entry
+func showLast() error {
+	err := history.Load(historyFile)
+	if err != nil {
+		return err
+	}
+	if len(history.Entries) == 0 {
+		fmt.Println("No command has been accepted yet.")
+		return nil
+	}
+	entry := history.Entries[len(history.Entries)-1]
+	if entry.Query != "" {
+		fmt.Printf("%sQuery:%s %s\n", colorBold, colorReset, entry.Query)
+	}
+	fmt.Printf("%sCommand:%s %s%s%s\n", colorBold, colorReset, colorCyan, entry.Command, colorReset)
+	if entry.Output != "" {
+		fmt.Printf("%sOutput:%s\n%s\n", colorBold, colorReset, entry.Output)
+	}
+	return nil
+}
+
+// Chooses one history entry, returning its index or -1 when nothing was picked
+type historySelector func(entries []aid.HistoryEntry) (int, error)
+
+// Single-line label for a history entry in a picker
+func historyLabel(entry aid.HistoryEntry) string {
+	command := strings.Join(strings.Fields(entry.Command), " ")
+	query := strings.Join(strings.Fields(entry.Query), " ")
+	if entry.Pinned {
+		command = "[pinned] " + command
+	}
+	if query == "" {
+		return command
+	}
+	return fmt.Sprintf("%s  # %s", command, query)
+}
+
+// Pick an entry by fuzzy search in fzf. Each line starts with the
+// entry's index, which fzf hides and hands back with the selection.
+func fzfSelector(path string) historySelector {
+	return func(entries []aid.HistoryEntry) (int, error) {
+		var input strings.Builder
+		for i, entry := range entries {
+			fmt.Fprintf(&input, "%d\t%s\n", i, historyLabel(entry))
+		}
+		cmd := exec.Command(path, "--delimiter=\t", "--with-nth=2..", "--tac", "--no-sort", "--prompt=history> ")
+		cmd.Stdin = strings.NewReader(input.String())
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			// fzf exits with 1 for no match and 130 when cancelled
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130) {
+				return -1, nil
+			}
+			return -1, err
+		}
+		index, err := strconv.Atoi(strings.SplitN(strings.TrimSpace(string(output)), "\t", 2)[0])
+		if err != nil || index < 0 || index >= len(entries) {
+			return -1, fmt.Errorf("unexpected selection from fzf: %q", strings.TrimSpace(string(output)))
+		}
+		return index, nil
+	}
+}
+
+// Pick an entry by number from a printed list
+func numberedSelector(reader *bufio.Reader, out io.Writer) historySelector {
+	return func(entries []aid.HistoryEntry) (int, error) {
+		for i, entry := range entries {
+			fmt.Fprintf(out, "%3d  %s\n", i+1, historyLabel(entry))
+		}
+		fmt.Fprint(out, "Entry number (blank to cancel): ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			return -1, nil
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			return -1, nil
+		}
+		number, err := strconv.Atoi(answer)
+		if err != nil || number < 1 || number > len(entries) {
+			return -1, fmt.Errorf("%q is not an entry number between 1 and %d", answer, len(entries))
+		}
+		return number - 1, nil
+	}
+}
+
+// Use fzf when asked for and installed, otherwise the numbered list
+func chooseHistorySelector(useFzf bool, reader *bufio.Reader, out io.Writer) historySelector {
+	if useFzf {
+		path, err := lookPath("fzf")
+		if err == nil {
+			return fzfSelector(path)
+		}
+		fmt.Fprintf(out, "%sfzf was not found; showing a numbered list instead.%s\n", colorYellow, colorReset)
+	}
+	return numberedSelector(reader, out)
+}
+
+// Handle the history subcommand: pick a past command, then run it again,
+// copy it or pin it. Returns the exit code to finish with.
+func runHistory(args []string) (int, error) {
+	if len(args) >= 1 && len(args) <= 2 && (args[0] == "pin" || args[0] == "unpin") {
+		return pinHistory(args)
+	}
+
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	useFzf := fs.Bool("fzf", false, "Pick the entry with fzf when it is installed")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage, err
+	}
+	if fs.NArg() > 0 {
+		return exitOK, errNotSubcommand
+	}
+
+	err := history.Load(historyFile)
+	if err != nil {
+		return exitFailure, err
+	}
+	if len(history.Entries) == 0 {
+		fmt.Println("No command has been accepted yet.")
+		return exitOK, nil
+	}
+
+	selector := chooseHistorySelector(*useFzf, stdin, os.Stdout)
+	return actOnHistory(history.Entries, selector, stdin)
+}
+
+// Handle history pin <n> and history unpin <n>, numbering entries as the
+// history picker lists them
+func pinHistory(args []string) (int, error) {
+	if len(args) != 2 {
+		return exitUsage, fmt.Errorf("usage: dingus-copilot history %s <n>", args[0])
+	}
+	number, err := strconv.Atoi(args[1])
+	if err != nil || number < 1 {
+		return exitUsage, fmt.Errorf("%q is not an entry number", args[1])
+	}
+	if err := setPinned(number-1, args[0] == "pin"); err != nil {
+		return exitFailure, err
+	}
+	return exitOK, nil
+}
+
+// Pin or unpin a history entry and say which command it was
+func setPinned(index int, pinned bool) error {
+	if err := history.SetPinned(historyFile, index, pinned); err != nil {
+		return err
+	}
+	verb := "Pinned"
+	if !pinned {
+		verb = "Unpinned"
+	}
+	fmt.Printf("%s: %s%s%s\n", verb, colorCyan, history.Entries[index].Command, colorReset)
+	return nil
+}
+
+// Ask what to do with the entry chosen by selector and do it
+func actOnHistory(entries []aid.HistoryEntry, selector historySelector, reader *bufio.Reader) (int, error) {
+	index, err := selector(entries)
+	if err != nil {
+		return exitUsage, err
+	}
+	if index < 0 {
+		return exitDeclined, nil
+	}
+	entry := entries[index]
+	fmt.Printf("\n%sCommand:%s %s%s%s\n", colorBold, colorReset, colorCyan, entry.Command, colorReset)
+	pinAction := "pin"
+	if entry.Pinned {
+		pinAction = "unpin"
+	}
+	fmt.Printf("Run it again? (y/n/c/p - 'c' to copy, 'p' to %s): ", pinAction)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return exitDeclined, nil
+	}
+	switch strings.TrimSpace(strings.ToLower(answer)) {
+	case "y":
+		if !confirmBeforeRun(reader, entry.Command, aid.RiskSafe) {
+			fmt.Println("Command not executed.")
+			return exitDeclined, nil
+		}
+		return commandExitCode(executeAndRecord(entry.Query, entry.Command)), nil
+	case "c":
+		copyOrPrint(entry.Command)
+		return exitOK, nil
+	case "p":
+		if err := setPinned(index, !entry.Pinned); err != nil {
+			return exitFailure, err
+		}
+		return exitOK, nil
+	}
+	fmt.Println("Command not executed.")
+	return exitDeclined, nil
+}
+
+// Point history at the --history-file or DINGUS_HISTORY_FILE override, if any,
+// creating its directory so separate shells can keep separate histories
+func selectHistoryFile(env map[string]string) error {
+	path := options.HistoryFile
+	if path == "" {
+		path = env["DINGUS_HISTORY_FILE"]
+	}
+	if path == "" {
+		return nil
+	}
+	historyFile = path
+	return os.MkdirAll(filepath.Dir(path), 0755)
+}
+
+// Parse KEY=VALUE lines, allowing comments, an export prefix and quoted values
+func parseDotEnv(data string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// Remove all configuration files
+func cleanupConfigFiles() error {
+	// Remove the entire config directory
+	err := os.RemoveAll(configDir)
+	if err != nil {
+		return fmt.Errorf("failed to remove config files: %v", err)
+	}
+	return nil
+}
+
+// System prompts for the different API calls
+const (
+	suggestionSystemPrompt = "You are a helpful assistant designed to suggest valid, safe, and relevant terminal commands based on user input."
+	summarySystemPrompt    = "You are a helpful assistant that briefly explains terminal commands."
+	explainSystemPrompt    = "You are a helpful assistant that answers questions about terminal commands and shells concisely, in plain text without markdown."
+)
+
+// Response format rules for a single command or a multi-step sequence
+const (
+	singleCommandFormat = `Format your response as follows:
+- Only respond with the suggested command.
+- Ensure the command is executable in the current session.
+- Do not include any additional information or context.
+- Do not include any formattings.
+- Do not include 'dingus-copilot' in the command.`
+
+	stepsFormat = `Format your response as follows:
+- Respond with a numbered list of commands, one per line, in the order they should be run.
+- Write each line as "<number>. <command>" with nothing else on the line.
+- Each command must be executable on its own in the current session.
+- Do not include any additional information or context.
+- Do not include any formattings.
+- Do not include 'dingus-copilot' in any command.`
+)
+
+// Fill {{.name}} placeholders in the query from --arg values
+func renderQuery(query string, vars map[string]string) (string, error) {
+	if !strings.Contains(query, "{{") {
+		return query, nil
+	}
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid query template: %v", err)
+	}
+	var rendered strings.Builder
+	err = tmpl.Execute(&rendered, vars)
+	if err != nil {
+		return "", fmt.Errorf("query placeholder not set, use --arg name=value: %v", err)
+	}
+	return rendered.String(), nil
+}
+
+// A bundle of prompt rules and defaults selected with persona
+type persona struct {
+	Rules        string   // Extra "- rule" lines for the suggestion prompt
+	Explain      bool     // Explain suggestions as with --explain
+	Temperature  *float64 // Used when neither the flag nor the config sets one
+	ConfirmRisky bool     // Ask for a typed "yes" before cautionary commands too
+}
+
+// Temperature used by the cautious persona
+var cautiousTemperature = 0.1
+
+// Presets that can be selected with --persona or the persona config key
+var personas = map[string]persona{
+	"concise": {
+		Rules: "- Prefer the shortest command that does the job, leaving out optional flags.\n",
+	},
+	"teacher": {
+		Rules:   "- Prefer readable commands with long option names over terse ones.\n",
+		Explain: true,
+	},
+	"cautious": {
+		Rules:        "- Prefer read-only or dry-run forms of commands when they answer the query.\n",
+		Temperature:  &cautiousTemperature,
+		ConfirmRisky: true,
+	},
+}
+
+// Persona names in a stable order for messages
+func personaNames() []string {
+	names := make([]string, 0, len(personas))
+	for name := range personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply a persona's defaults to options, leaving settings given by flag or config alone
+func applyPersona(preset persona) {
+	if preset.Explain && !flagsSet["explain"] {
+		options.Explain = true
+	}
+	if preset.Temperature != nil && options.Temperature == nil {
+		temperature := *preset.Temperature
+		options.Temperature = &temperature
+	}
+	if preset.ConfirmRisky {
+		options.ConfirmRisky = true
+	}
+}
+
+// Additional rules enabled by flags and config, one "- rule" per line.
+// The environment is described only when shareEnv is set.
+func extraPromptRules(shareEnv bool) string {
+	var rules strings.Builder
+	rules.WriteString(personas[options.Persona].Rules)
+	rules.WriteString(lengthRule())
+	if options.Tool != "" {
+		rules.WriteString(fmt.Sprintf("- Only suggest a %s command; the command must start with %s.\n", options.Tool, options.Tool))
+	}
+	if options.Portable {
+		rules.WriteString("- Prefer POSIX-portable syntax that works on both Linux and BSD/macOS; avoid GNU-only flags and bash-only features.\n")
+	}
+	if shareEnv {
+		rules.WriteString(environmentContext())
+	} else if options.Cwd != "" {
+		rules.WriteString(workingDirRule(options.Cwd))
+	}
+	if options.ShareAliases {
+		if aliases := aliasContext(loadAliases()); aliases != "" {
+			rules.WriteString(aliases)
+		}
+	}
+	return rules.String()
+}
+
+// Tell the model which directory the command will run in
+func workingDirRule(dir string) string {
+	return fmt.Sprintf("- The command will run in the directory %s.\n", dir)
+}
+
+// Common tools whose presence is shared with the model when share_cwd is on
+var contextTools = []string{"git", "docker", "kubectl", "python3", "node", "npm", "go", "make"}
+
+// Looks up executables on PATH, replaceable for testing
+var lookPath = exec.LookPath
+
+// Describe the working directory and installed tools without sharing the wider environment
+func environmentContext() string {
+	var context strings.Builder
+	if options.Cwd != "" {
+		context.WriteString(workingDirRule(options.Cwd))
+	} else if cwd, err := os.Getwd(); err == nil {
+		context.WriteString(workingDirRule(cwd))
+	}
+
+	var installed, missing []string
+	for _, tool := range contextTools {
+		if _, err := lookPath(tool); err == nil {
+			installed = append(installed, tool)
+		} else {
+			missing = append(missing, tool)
+		}
+	}
+	if len(installed) > 0 {
+		context.WriteString(fmt.Sprintf("- These tools are installed: %s.\n", strings.Join(installed, ", ")))
+	}
+	if len(missing) > 0 {
+		context.WriteString(fmt.Sprintf("- These tools are not installed: %s.\n", strings.Join(missing, ", ")))
+	}
+	return context.String()
+}
+
+// Shell startup files that alias definitions are read from when share_aliases is on
+var aliasFiles = []string{".bash_aliases", ".aliases", ".bashrc", ".zshrc"}
+
+// Most aliases shared with the model, to keep the prompt small
+const maxSharedAliases = 40
+
+// Alias values mentioning these are never shared with the model
+var sensitiveAliasPattern = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|api[_-]?key|auth|bearer|credential)`)
+
+// Read alias definitions from the user's shell startup files
+func loadAliases() map[string]string {
+	aliases := map[string]string{}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return aliases
+	}
+	for _, name := range aliasFiles {
+		data, err := os.ReadFile(filepath.Join(homeDir, name))
+		if err != nil {
+			continue
+		}
+		for alias, value := range parseAliases(string(data)) {
+			if _, seen := aliases[alias]; !seen {
+				aliases[alias] = value
+			}
+		}
+	}
+	return aliases
+}
+
+// Parse alias name='value' lines, as written in startup files or printed by alias
+func parseAliases(data string) map[string]string {
+	aliases := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "alias ") {
+			continue
+		}
+		name, value, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "alias ")), "=")
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		aliases[name] = value
+	}
+	return aliases
+}
+
+// Describe the aliases as a prompt rule, leaving out any that look sensitive
+func aliasContext(aliases map[string]string) string {
+	names := make([]string, 0, len(aliases))
+	for name, value := range aliases {
+		if !sensitiveAliasPattern.MatchString(value) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	if len(names) > maxSharedAliases {
+		names = names[:maxSharedAliases]
+	}
+	definitions := make([]string, len(names))
+	for i, name := range names {
+		definitions[i] = fmt.Sprintf("%s='%s'", name, aliases[name])
+	}
+	return fmt.Sprintf("- The user's shell defines these aliases; they do not expand when the command is run, so write out what they stand for: %s.\n", strings.Join(definitions, ", "))
+}
+
+// Prompt size used when max_prompt_tokens is not configured
+const defaultMaxPromptTokens = 12000
+
+// Estimate the number of tokens in text at roughly four characters per token
+func countTokensApprox(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// Build the suggestion prompt from the rules, history and query. When the
+// prompt is over the token budget, history is dropped oldest first, pinned
+// entries last, and then the environment context, with a warning saying
+// what was left out.
+func buildSuggestionPrompt(query string) string {
+	// Add command history context to the prompt unless starting fresh
+	var entries []aid.HistoryEntry
+	if !options.Fresh {
+		entries = history.Entries
+	}
+	// --context limits the turns sent without changing what is stored.
+	// Pinned entries are kept within a limit, but 0 sends no history at all.
+	if options.Context == 0 {
+		entries = nil
+	} else if options.Context > 0 {
+		entries = aid.TrimHistory(entries, options.Context)
+	}
+	shareEnv := options.ShareCWD
+	prompt := renderSuggestionPrompt(query, entries, shareEnv)
+
+	dropped := 0
+	for countTokensApprox(prompt) > options.MaxPromptTokens {
+		if dropped < len(entries) {
+			dropped++
+		} else if shareEnv {
+			shareEnv = false
+		} else {
+			break
+		}
+		prompt = renderSuggestionPrompt(query, aid.DropOldest(entries, dropped), shareEnv)
+	}
+	if dropped > 0 || shareEnv != options.ShareCWD {
+		var left []string
+		if dropped == 1 {
+			left = append(left, "the oldest history entry")
+		} else if dropped > 1 {
+			left = append(left, fmt.Sprintf("the %d oldest history entries", dropped))
+		}
+		if shareEnv != options.ShareCWD {
+			left = append(left, "the environment context")
+		}
+		fmt.Fprintf(os.Stderr, "%sWarning: the prompt was over %d tokens, so it leaves out %s.%s\n",
+			colorYellow, options.MaxPromptTokens, strings.Join(left, " and "), colorReset)
+	}
+	return prompt
+}
+
+// Prompt rules that treat each query as a follow-up to the history
+const continuationRules = `- Continue the conversation by giving useful commands.
+- Consider the chat history and make the command more useful than before based on the user's follow up questions.
+- Use information from the chat history to help generate the command.`
+
+// Prompt rules used with standalone, answering each query on its own
+const standaloneRules = `- Answer only the current query literally; do not assume it continues the chat history or suggest a next step instead.
+- Use the chat history only for details the query refers to, such as file names.`
+
+// Fill the suggestion prompt template with the given history and rules
+func renderSuggestionPrompt(query string, entries []aid.HistoryEntry, shareEnv bool) string {
+	context := history
+	context.Entries = entries
+	historyContext := context.GetContext()
+	shell := aid.SelectShell(runtime.GOOS)
+
+	format, answerLabel := singleCommandFormat, "Suggested command:"
+	if options.Steps {
+		format, answerLabel = stepsFormat, "Suggested commands:"
+	}
+	historyRules := continuationRules
+	if options.Standalone {
+		historyRules = standaloneRules
+	}
+
+	return fmt.Sprintf(`
+Always adhere to these rules when suggesting the command:
+- The command must be a valid terminal command.
+- The command will be run by %s on %s, so use its syntax.
+- It should be relevant to the user's query.
+%s
+- The command should not require user input.
+- It must not be destructive or modify the system in any harmful way.
+- The command should not require additional software, configuration, or access to external resources, the internet, or sensitive information.
+%s
+%s
+
+The command line history is as follows:
+
+<COMMAND_HISTORY> %s </COMMAND_HISTORY>
+
+The user query is as follows:
+
+<USER_QUESTION> %s </USER_QUESTION>
+
+%s`, shell.Name, runtime.GOOS, historyRules, extraPromptRules(shareEnv), format, historyContext, query, answerLabel)
+}
+
+// Reply token limits for a single suggestion with --short, by default and with --long.
+// A --steps list gets twice as many.
+const (
+	shortMaxTokens   = 60
+	defaultMaxTokens = 150
+	longMaxTokens    = 500
+)
+
+// Reply token limit for a suggestion from --max-tokens, --short, --long and --steps
+func suggestionMaxTokens() int {
+	if options.MaxTokens > 0 {
+		return options.MaxTokens
+	}
+	maxTokens := defaultMaxTokens
+	if options.Short {
+		maxTokens = shortMaxTokens
+	} else if options.Long {
+		maxTokens = longMaxTokens
+	}
+	if options.Steps {
+		maxTokens *= 2
+	}
+	return maxTokens
+}
+
+// Prompt rule for the length asked for with --short or --long, if any
+func lengthRule() string {
+	switch {
+	case options.Short:
+		return "- Keep the command to one short line, using as few options and pipeline stages as possible.\n"
+	case options.Long:
+		return "- The command does not need to be a one-liner; use a long pipeline or several lines when that does the job better.\n"
+	}
+	return ""
+}
+
+// Get command suggestion from OpenAI API and return token usage
+func getCommandSuggestion(query string) (aid.ChatResponse, error) {
+	start := time.Now()
+	prompt := buildSuggestionPrompt(query)
+	tracer.Track("prompt build", start)
+
+	reqBody := buildRequestBody(suggestionSystemPrompt, prompt, suggestionMaxTokens())
+	reqBody["logprobs"] = true
+	if !options.Steps {
+		requireSuggestFormat(reqBody)
+	}
+	return sendRequest("suggestion", reqBody)
+}
+
+// Make the model answer with a suggest_command object, so the command
+// comes with a risk rating
+func requireSuggestFormat(reqBody map[string]interface{}) {
+	reqBody["response_format"] = aid.SuggestCommandFormat
+}
+
+// Get a suggestion, re-prompting once if it ignores the --tool constraint
+func suggestCommand(query string) (aid.ChatResponse, error) {
+	first, err := getCommandSuggestion(query)
+	if err != nil || options.Tool == "" || options.Steps || commandUsesTool(first.Text, options.Tool) {
+		return first, err
+	}
+
+	fmt.Printf("%sSuggestion did not use %s, asking again...%s\n", colorYellow, options.Tool, colorReset)
+	retryQuery := fmt.Sprintf("%s\n(The previous suggestion %q did not start with %s. Suggest a %s command instead.)",
+		query, first.Text, options.Tool, options.Tool)
+	retry, err := getCommandSuggestion(retryQuery)
+	retry.PromptTokens += first.PromptTokens
+	retry.CompletionTokens += first.CompletionTokens
+	if err == nil && !commandUsesTool(retry.Text, options.Tool) {
+		fmt.Printf("%sWarning: the suggestion still does not start with %s.%s\n", colorYellow, options.Tool, colorReset)
+	}
+	return retry, err
+}
+
+// Report whether a command's first word is the given tool
+func commandUsesTool(command, tool string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+	return fields[0] == tool || filepath.Base(fields[0]) == tool
+}
+
+// Get a one-line summary of what a command will do and return token usage
+func getCommandSummary(command string) (aid.ChatResponse, error) {
+	prompt := fmt.Sprintf(`Summarise in one short sentence what the following terminal command will do.
+Start the sentence with a verb and do not repeat the command.
+
+<COMMAND> %s </COMMAND>`, command)
+
+	return sendRequest("summary", buildRequestBody(summarySystemPrompt, prompt, 60))
+}
+
+// Openings of questions that want an answer rather than a command to run
+var questionPrefixes = []string{
+	"what is", "what's", "what are", "what does", "what do", "why", "explain", "describe",
+	"when should", "is it", "is there a difference", "difference between", "meaning of",
+}
+
+// Openings of requests for a command, which take precedence over questions
+var commandRequestPrefixes = []string{"how do i", "how can i", "how to", "how would i", "what command"}
+
+// Report whether a query is an informational question rather than a request for a command
+func isQuestion(query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	for _, prefix := range commandRequestPrefixes {
+		if strings.HasPrefix(query, prefix) {
+			return false
+		}
+	}
+	for _, prefix := range questionPrefixes {
+		if strings.HasPrefix(query, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Answer an informational question about commands or the shell
+func getExplanation(query string) (aid.ChatResponse, error) {
+	prompt := fmt.Sprintf("Answer this question in at most a few short sentences, giving an example command where it helps.\n\nQuestion: %s", query)
+	return sendRequest("explanation", buildRequestBody(explainSystemPrompt, prompt, 300))
+}
+
+// Explain each part of a command for --learn
+func getCommandBreakdown(command string) (aid.ChatResponse, error) {
+	prompt := fmt.Sprintf(`Explain what the following terminal command does in a few short sentences,
+covering each program, option and argument a learner may not know.
+
+<COMMAND> %s </COMMAND>`, command)
+
+	return sendRequest("breakdown", buildRequestBody(explainSystemPrompt, prompt, 300))
+}
+
+// Print a command breakdown and what it cost
+func printExplanation(explanation aid.ChatResponse) {
+	fmt.Printf("\n%sExplanation:%s\n%s\n\n", colorBold, colorReset, renderMarkdown(explanation.Text))
+	if showCost() {
+		fmt.Printf("%sExplanation cost: %s%s\n\n", colorPurple, formatCost(calculateCost(explanation.PromptTokens, explanation.CompletionTokens)), colorReset)
+	}
+}
+
+// Markdown constructs styled by renderMarkdown
+var (
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	markdownBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	markdownBold    = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	markdownCode    = regexp.MustCompile("`([^`]+)`")
+)
+
+// Render the markdown the model tends to use in explanations for the
+// terminal: headings and bold in bold, code in cyan, bullets as dots and
+// fenced code blocks indented. Markers are removed even without colour.
+func renderMarkdown(text string) string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, "    "+colorCyan+line+colorReset)
+			continue
+		}
+		if match := markdownHeading.FindStringSubmatch(line); match != nil {
+			out = append(out, colorBold+renderInline(match[1])+colorReset)
+			continue
+		}
+		if match := markdownBullet.FindStringSubmatch(line); match != nil {
+			line = match[1] + "  • " + match[2]
+		}
+		out = append(out, renderInline(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+// Style bold text and code spans within a line
+func renderInline(line string) string {
+	line = markdownCode.ReplaceAllString(line, colorCyan+"$1"+colorReset)
+	return markdownBold.ReplaceAllString(line, colorBold+"$1$2"+colorReset)
+}
+
+// Ask the user to predict what a command does, then reveal the model's explanation
+func runQuiz(reader *bufio.Reader, command string, explain func(string) (aid.ChatResponse, error)) error {
+	fmt.Print("What do you think this command does? (press Enter to skip): ")
+	guess, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	explanation, err := explain(command)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(guess) != "" {
+		fmt.Printf("\n%sYour answer:%s %s\n", colorBold, colorReset, strings.TrimSpace(guess))
+	}
+	printExplanation(explanation)
+	return nil
+}
+
+// Follow-up instructions for the prompt's quick-refine keys
+var refinements = map[string]string{
+	"s": "Make it simpler and shorter, using fewer options and pipeline stages.",
+	"l": "Make it more robust and explicit: handle spaces in file names and missing files, and prefer long option names.",
+}
+
+// Ask the model to rewrite a suggested command following an instruction
+func getRefinement(query, command, instruction string) (aid.ChatResponse, error) {
+	shell := aid.SelectShell(runtime.GOOS)
+	prompt := fmt.Sprintf(`The following command, to be run by %s on %s, was suggested for this request: %s
+
+<COMMAND> %s </COMMAND>
+
+Rewrite the command. %s
+%s
+
+Rewritten command:`, shell.Name, runtime.GOOS, query, command, instruction, singleCommandFormat)
+
+	reqBody := buildRequestBody(suggestionSystemPrompt, prompt, 150)
+	requireSuggestFormat(reqBody)
+	return sendRequest("refinement", reqBody)
+}
+
+// Send the query verbatim as the only message for --raw-prompt
+func getRawReply(query string) (aid.ChatResponse, error) {
+	reqBody := map[string]interface{}{
+		"model": options.Model,
+		"messages": []interface{}{
+			map[string]interface{}{"role": "user", "content": query},
+		},
+	}
+	if options.Temperature != nil {
+		reqBody["temperature"] = *options.Temperature
+	}
+	return sendRequest("raw", reqBody)
+}
+
+// Ask the model to correct a command that failed, given its error and output
+func getCommandFix(result CommandResult) (aid.ChatResponse, error) {
+	shell := aid.SelectShell(runtime.GOOS)
+	// The error messages are what matter, so use stderr alone when it was captured
+	output := result.Output
+	if result.Stderr != "" {
+		output = result.Stderr
+	}
+	output = aid.LimitLines(output, 0, 40)
+	prompt := fmt.Sprintf(`The following terminal command, run by %s on %s, failed.
+
+<COMMAND> %s </COMMAND>
+
+<ERROR> %v </ERROR>
+
+<OUTPUT> %s </OUTPUT>
+
+Suggest a corrected command that achieves what the original command intended.
+%s
+
+Corrected command:`, shell.Name, runtime.GOOS, result.Command, result.Err, output, singleCommandFormat)
+
+	reqBody := buildRequestBody(suggestionSystemPrompt, prompt, 100)
+	requireSuggestFormat(reqBody)
+	return sendRequest("fix", reqBody)
+}
+
+// Most responses kept in the --deterministic cache
+const maxCacheEntries = 500
+
+// Send an API request, recording its timing for --trace and --metrics-file
+func sendRequest(call string, reqBody map[string]interface{}) (aid.ChatResponse, error) {
+	if options.SavePrompt != "" && (call == "suggestion" || call == "explanation" || call == "raw") {
+		if err := savePrompt(options.SavePrompt, reqBody); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving prompt: %v\n", err)
+		}
+	}
+
+	start := time.Now()
+
+	// Replayed suggestions come from the cache when --deterministic is set
+	var cache *aid.ResponseCache
+	var cacheKey string
+	if options.Deterministic && call == "suggestion" {
+		cache = aid.NewResponseCache(cacheFile, maxCacheEntries)
+		key, err := aid.CacheKey(reqBody)
+		if err != nil {
+			return aid.ChatResponse{}, err
+		}
+		cacheKey = key
+		cached, ok, err := cache.Get(cacheKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading cache: %v\n", err)
+		} else if ok {
+			fmt.Printf("%sUsing cached suggestion.%s\n", colorYellow, colorReset)
+			// Nothing was spent on a cached answer
+			cached.PromptTokens, cached.CompletionTokens = 0, 0
+			recordMetrics(call, reqBody, start, cached, 0, true, nil)
+			return cached, nil
+		}
+	}
+
+	start = time.Now()
+	response, retries, err := chatCompletion(reqBody)
+	tracer.Track(call+" api round-trip", start)
+
+	if cache != nil && err == nil {
+		if cacheErr := cache.Put(cacheKey, response); cacheErr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing cache: %v\n", cacheErr)
+		}
+	}
+
+	recordMetrics(call, reqBody, start, response, retries, false, err)
+	return response, err
+}
+
+// Append a --metrics-file record for an API call that began at start
+func recordMetrics(call string, reqBody map[string]interface{}, start time.Time, response aid.ChatResponse, retries int, cacheHit bool, err error) {
+	if options.MetricsFile == "" {
+		return
+	}
+	model, _ := reqBody["model"].(string)
+	record := MetricsRecord{
+		Timestamp:        start.UTC(),
+		Call:             call,
+		Model:            model,
+		LatencyMS:        time.Since(start).Milliseconds(),
+		PromptTokens:     response.PromptTokens,
+		CompletionTokens: response.CompletionTokens,
+		Cost:             calculateCost(response.PromptTokens, response.CompletionTokens),
+		CacheHit:         cacheHit,
+		Retries:          retries,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if metricsErr := appendMetrics(options.MetricsFile, record); metricsErr != nil {
+		fmt.Fprintf(os.Stderr, "Error writing metrics: %v\n", metricsErr)
+	}
+}
+
+// Write the messages of a request to path for --save-prompt, one
+// section per message, with the API key redacted and other secrets too
+// when redact_query is set
+func savePrompt(path string, reqBody map[string]interface{}) error {
+	var b strings.Builder
+	messages, _ := reqBody["messages"].([]interface{})
+	for i, m := range messages {
+		message, _ := m.(map[string]interface{})
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "### %v\n%v\n", message["role"], message["content"])
+	}
+	text := b.String()
+	if activeAPIKey != "" {
+		text = strings.ReplaceAll(text, activeAPIKey, "[REDACTED]")
+	}
+	return aid.WriteFileAtomic(path, []byte(loggedText(text)), 0600)
+}
+
+// Colour used for the run prompt at each risk rating
+func riskColor(risk string) string {
+	switch aid.NormalizeRisk(risk) {
+	case aid.RiskCaution:
+		return colorYellow
+	case aid.RiskDangerous:
+		return colorRed
+	}
+	return colorGreen
+}
+
+// Suggest what to do next for the error categories a user can act on
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, aid.ErrRateLimited):
+		return "\nHint: the API is rate limiting this key; wait a moment or lower rate_limit_rpm in the config."
+	case errors.Is(err, aid.ErrLimitReached):
+		return "\nHint: this is the rate_limit_rpm set in the config; run without --no-wait to wait for it."
+	case errors.Is(err, aid.ErrConnDropped):
+		return "\nHint: the connection dropped before the reply arrived; please retry, or raise retries in the config."
+	case errors.Is(err, aid.ErrNetwork):
+		return "\nHint: check your network connection and the API base URL (" + options.BaseURL + ")."
+	case errors.Is(err, aid.ErrModelRefused):
+		return "\nHint: the model declined to answer; try rephrasing the request."
+	}
+	return ""
+}
+
+// Extra attempts for an API call after a network error or dropped connection
+const defaultRetries = 2
+
+// Send a chat completions request to the selected provider, returning
+// how many retries it took too
+func chatCompletion(reqBody map[string]interface{}) (aid.ChatResponse, int, error) {
+	// Short-lived keys are fetched afresh for every call
+	if options.KeyCommand != "" {
+		key, err := fetchKey(options.KeyCommand)
+		if err != nil {
+			return aid.ChatResponse{}, 0, err
+		}
+		activeAPIKey = key
+	}
+	client := aid.NewClient(aid.Providers[options.Provider], activeAPIKey)
+	client.BaseURL = options.BaseURL
+	client.OrgID, client.ProjectID = options.OrgID, options.ProjectID
+	client.Retries = options.Retries
+	client.Limiter, client.NoWait = rateLimiter, options.NoWait
+	if apiTransport != nil {
+		client.HTTPClient = &http.Client{Transport: apiTransport}
+	}
+	retries := 0
+	client.OnRetry = func(attempt int, err error) {
+		retries = attempt
+		reason := "Network error"
+		if errors.Is(err, aid.ErrConnDropped) {
+			reason = "Connection dropped"
+		}
+		fmt.Fprintf(os.Stderr, "%s%s, retrying (%d/%d)...%s\n", colorYellow, reason, attempt, options.Retries, colorReset)
+	}
+	client.OnWarning = func(message string) {
+		fmt.Fprintf(os.Stderr, "%sWarning: %s.%s\n", colorYellow, message, colorReset)
+	}
+	response, err := client.Complete(reqBody)
+	return response, retries, err
+}
+
+// Suggestions whose first token is less likely than this get a review hint
+const lowConfidenceThreshold = 0.5
+
+// Hint shown before the prompt when the model was unsure, empty otherwise
+func confidenceHint(confidence float64) string {
+	if confidence <= 0 || confidence >= lowConfidenceThreshold {
+		return ""
+	}
+	return fmt.Sprintf("Low confidence (%.0f%%): the model was unsure about this suggestion, review it carefully.", confidence*100)
+}
+
+// Calculate API call cost at the active model's rates
+func calculateCost(promptTokens, completionTokens int) float64 {
+	return aid.Providers[options.Provider].Cost(options.Model, promptTokens, completionTokens)
+}
+
+// Values of --cost-format and the cost_format config key
+const (
+	costHuman = "human"
+	costRaw   = "raw"
+)
+
+// Format a cost in dollars as chosen by --cost-format
+func formatCost(cost float64) string {
+	return aid.FormatCost(cost, options.CostFormat != costRaw)
+}
+
+// Report whether cost lines should be printed, hiding them for free
+// providers, models without known prices or --no-cost
+func showCost() bool {
+	return !options.NoCost && aid.Providers[options.Provider].Priced(options.Model)
+}
+
+// The shell that runs suggested commands, in the --cwd directory when
+// given and without network access when sandbox_network is on
+func commandShell() aid.Shell {
+	shell := aid.SelectShell(runtime.GOOS)
+	shell.Dir = options.Cwd
+	if options.SandboxNetwork {
+		if unshare := networkSandbox(runtime.GOOS); unshare != "" {
+			shell = shell.WithoutNetwork(unshare)
+		}
+	}
+	return shell
+}
+
+// Find unshare to cut commands off from the network, or "" where it can't be used
+func networkSandbox(goos string) string {
+	if goos != "linux" {
+		return ""
+	}
+	path, err := lookPath("unshare")
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// Programs that usually reach the network
+var networkPrograms = []string{"curl", "wget", "nc", "ncat", "netcat", "ssh", "scp", "sftp", "rsync", "ftp", "telnet", "ping", "dig", "nslookup", "git", "pip", "pip3", "npm", "apt", "apt-get", "brew", "docker"}
+
+// List the programs in a command that usually reach the network
+func networkCommands(command string) []string {
+	var found []string
+	for _, program := range commandPrograms(command) {
+		if containsString(networkPrograms, program) && !containsString(found, program) {
+			found = append(found, program)
+		}
+	}
+	return found
+}
+
+// Tell the user how sandbox_network affects a command that looks like it
+// reaches the network
+func warnNetworkUse(command string) {
+	programs := networkCommands(command)
+	if !options.SandboxNetwork || len(programs) == 0 {
+		return
+	}
+	if networkSandbox(runtime.GOOS) != "" {
+		fmt.Printf("%sNote: network access is disabled, so %s may fail.%s\n", colorYellow, strings.Join(programs, ", "), colorReset)
+		return
+	}
+	fmt.Printf("%sWarning: sandbox_network is on, but unshare is not available here, so %s can reach the network.%s\n",
+		colorYellow, strings.Join(programs, ", "), colorReset)
+}
+
+// Run the suggested command, copying its output to live while it runs and
+// reporting when an interrupt is forwarded to it. Stderr is returned on its
+// own with --split-streams; otherwise it is mixed into stdout and empty.
+func runCommand(command string, live io.Writer) (string, string, error) {
+	onInterrupt := func(err error) {
+		fmt.Printf("\n%sInterrupted, stopping command...%s\n", colorYellow, colorReset)
+		if err != nil {
+			fmt.Printf("Error forwarding signal: %v\n", err)
+		}
+	}
+	if !options.SplitStreams {
+		output, err := commandShell().Run(command, live, onInterrupt)
+		return output, "", err
+	}
+	var liveErr io.Writer
+	if live != nil {
+		liveErr = &prefixWriter{w: live, prefix: colorYellow + "stderr: " + colorReset, lineStart: true}
+	}
+	return commandShell().RunSeparate(command, live, liveErr, onInterrupt)
+}
+
+// Writes a prefix at the start of every line, labelling a stream
+type prefixWriter struct {
+	w         io.Writer
+	prefix    string
+	lineStart bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	var out bytes.Buffer
+	for _, c := range b {
+		if p.lineStart {
+			out.WriteString(p.prefix)
+		}
+		out.WriteByte(c)
+		p.lineStart = c == '\n'
+	}
+	if _, err := p.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Join separately captured streams for display and history, labelling stderr
+func labelStreams(stdout, stderr string) string {
+	if stderr == "" {
+		return stdout
+	}
+	if stdout != "" && !strings.HasSuffix(stdout, "\n") {
+		stdout += "\n"
+	}
+	return stdout + "STDERR:\n" + stderr
+}
+
+// Passes writes through until limit bytes have been written, then drops
+// the rest. A limit of 0 means no limit.
+type cappedWriter struct {
+	w         io.Writer
+	limit     int
+	written   int
+	truncated bool
+	pending   []byte // Start of a character split across writes
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if c.limit <= 0 {
+		return c.w.Write(p)
+	}
+	if c.truncated {
+		return len(p), nil
+	}
+	// Hold back a character split across writes until the rest arrives
+	data := append(c.pending, p...)
+	split := incompleteSuffix(data)
+	c.pending = append([]byte(nil), data[len(data)-split:]...)
+	data = data[:len(data)-split]
+
+	n := len(data)
+	if room := c.limit - c.written; n > room {
+		// Stop before a character that would be cut in half
+		n = len(truncateUTF8(string(data), room))
+		c.truncated = true
+	}
+	if n > 0 {
+		written, err := c.w.Write(data[:n])
+		c.written += written
+		if err != nil {
+			return written, err
+		}
+	}
+	// Report the whole write so the command's output is still captured
+	return len(p), nil
+}
+
+// Passes on output up to limit lines and drops the rest, noting whether
+// there was more
+type lineLimitWriter struct {
+	w        io.Writer
+	limit    int
+	lines    int
+	exceeded bool
+}
+
+func (l *lineLimitWriter) Write(p []byte) (int, error) {
+	if l.exceeded {
+		return len(p), nil
+	}
+	kept := p
+	for i, c := range p {
+		if l.lines == l.limit {
+			kept = p[:i]
+			l.exceeded = true
+			break
+		}
+		if c == '\n' {
+			l.lines++
+		}
+	}
+	if _, err := l.w.Write(kept); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Lines of output shown before the rest goes to the pager, unless
+// pager_lines sets another number
+const defaultPagerLines = 50
+
+// Value of the pager config key that turns paging off
+const pagerOff = "off"
+
+// Choose the pager for long output: the pager config key, then $PAGER,
+// then less when it is installed. Returns nil when output should not be
+// paged because paging is off or stdout is not a terminal.
+func pagerCommand(getenv func(string) string) []string {
+	if options.Pager == pagerOff || !stdoutIsTerminal() {
+		return nil
+	}
+	for _, setting := range []string{options.Pager, getenv("PAGER")} {
+		if fields := strings.Fields(setting); len(fields) > 0 {
+			return fields
+		}
+	}
+	if _, err := lookPath("less"); err == nil {
+		return []string{"less"}
+	}
+	return nil
+}
+
+// Report whether stdout is a terminal. Replaced in tests.
+var stdoutIsTerminal = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Show text in the pager, attached to the terminal. Ctrl+C is left to the
+// pager rather than ending this process. Replaced in tests.
+var runPager = func(pager []string, text string) error {
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	return cmd.Run()
+}
+
+// Page output, reporting a pager that fails to run
+func pageOutput(pager []string, output string) {
+	if err := runPager(pager, output); err != nil {
+		fmt.Printf("Error running pager %s: %v\n", pager[0], err)
+	}
+}
+
+// Shorten output shown on screen to display_max_bytes
+func capDisplay(output string) string {
+	if options.DisplayMaxBytes <= 0 || len(output) <= options.DisplayMaxBytes {
+		return output
+	}
+	return truncateUTF8(output, options.DisplayMaxBytes) + "\n" + displayTruncatedNote()
+}
+
+// Length of an incomplete multi-byte character at the end of b
+func incompleteSuffix(b []byte) int {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if utf8.FullRune(b[len(b)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
+
+// Cut s to at most n bytes without splitting a multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Keep at most the last n bytes of s without splitting a multi-byte character
+func tailUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+// Pad s with spaces to width characters, counting runes rather than bytes
+func padRight(s string, width int) string {
+	if pad := width - utf8.RuneCountInString(s); pad > 0 {
+		return s + strings.Repeat(" ", pad)
+	}
+	return s
+}
+
+// Note shown where display_max_bytes cut off the output
+func displayTruncatedNote() string {
+	return fmt.Sprintf("... output truncated after %d bytes (display_max_bytes)", options.DisplayMaxBytes)
+}
+
+// A command that was run, its displayed output and its error
+type CommandResult struct {
+	Command string
+	Output  string
+	Stderr  string // Set only with --split-streams
+	Err     error
+}
+
+// Report whether the user stopped the command with Ctrl+C
+func (r CommandResult) Interrupted() bool {
+	var interrupted *aid.InterruptedError
+	return errors.As(r.Err, &interrupted)
+}
+
+// Run a command, show its output and add it to history.
+// The result lets callers react to failures.
+func executeAndRecord(query, command string) CommandResult {
+	// With --replace-run, let the user fill in placeholders such as
+	// <filename> before running. --yes never stops to ask.
+	if options.ReplaceRun && !options.Yes {
+		command = fillPlaceholders(command)
+	}
+
+	// Admins can restrict which programs may be run
+	if blocked := disallowedPrograms(command); len(blocked) > 0 {
+		fmt.Printf("%sNot running: %s not in allowed_commands.%s\n", colorYellow, strings.Join(blocked, ", "), colorReset)
+		return CommandResult{Command: command, Err: errNotAllowed}
+	}
+
+	warnNetworkUse(command)
+
+	// Full-screen and prompting programs need the terminal, so their
+	// output is neither captured nor recorded
+	if isInteractive(command) {
+		fmt.Printf("\n%sRunning interactively; output will not be saved to history.%s\n", colorBold, colorReset)
+		err := commandShell().RunAttached(command)
+		if err != nil {
 			fmt.Printf("Command returned error: %v\n", err)
-			fmt.Printf("Output:\n%s\n", output)
+		}
+		return CommandResult{Command: command, Err: err}
+	}
+
+	if wouldBlockOnStdin(command) {
+		fmt.Printf("%sNote: this command reads standard input, which is not connected, so it will see no input.%s\n", colorYellow, colorReset)
+	}
+
+	// Stream output as it arrives unless it is trimmed for display. The
+	// display cap only affects the screen; history keeps its own word limit.
+	// Long output on a terminal stops streaming after pager_lines lines and
+	// is shown in full in a pager once the command finishes.
+	var live io.Writer
+	var display *cappedWriter
+	var lines *lineLimitWriter
+	pager := pagerCommand(os.Getenv)
+	if options.Head == 0 && options.Tail == 0 {
+		display = &cappedWriter{w: os.Stdout, limit: options.DisplayMaxBytes}
+		live = display
+		if pager != nil {
+			lines = &lineLimitWriter{w: display, limit: options.PagerLines}
+			live = lines
+		}
+		fmt.Printf("\n%sCommand output:%s\n", colorBold, colorReset)
+	}
+
+	start := time.Now()
+	stdout, stderr, err := runWithRetries(command, live, runCommand, time.Sleep)
+	tracer.Track("command execution", start)
+	output := labelStreams(stdout, stderr)
+
+	// Keep the full output on disk before trimming it for display and
+	// history. With --split-streams the file gets clean stdout only. Output
+	// can hold secrets, so only the owner may read the file.
+	if options.OutputFile != "" {
+		if writeErr := aid.WriteFileAtomic(options.OutputFile, []byte(stdout), 0600); writeErr != nil {
+			fmt.Printf("Error writing output file: %v\n", writeErr)
+		}
+	}
+	output = aid.LimitLines(output, options.Head, options.Tail)
+	if lines != nil && lines.exceeded {
+		fmt.Printf("\n%s... more than %d lines, showing all of it in %s%s\n", colorYellow, options.PagerLines, pager[0], colorReset)
+		pageOutput(pager, output)
+	} else if display != nil && display.truncated {
+		fmt.Printf("\n%s%s%s\n", colorYellow, displayTruncatedNote(), colorReset)
+	}
+
+	if err != nil {
+		fmt.Printf("Command returned error: %v\n", err)
+		if live == nil {
+			fmt.Printf("Output:\n%s\n", capDisplay(output))
+		}
+	} else if live == nil && pager != nil && strings.Count(output, "\n") > options.PagerLines {
+		pageOutput(pager, output)
+	} else if live == nil {
+		// Output the result
+		fmt.Printf("\n%sCommand output:%s\n%s\n", colorBold, colorReset, capDisplay(output))
+	}
+
+	// Add to command history unless this query is private
+	if !options.NoHistory {
+		if recordErr := recordHistory(query, command, output); recordErr != nil {
+			fmt.Printf("Error saving history: %v\n", recordErr)
+		}
+	}
+	return CommandResult{Command: command, Output: output, Stderr: stderr, Err: err}
+}
+
+// Pause between runs of a command retried with --retry-on-fail
+const retryOnFailDelay = 2 * time.Second
+
+// Run a command, running it again up to --retry-on-fail times while it
+// exits non-zero. Commands that could not start or were interrupted are
+// not retried. Returns the output and error of the last attempt.
+func runWithRetries(command string, live io.Writer, run func(string, io.Writer) (string, string, error), sleep func(time.Duration)) (string, string, error) {
+	for attempt := 1; ; attempt++ {
+		output, stderr, err := run(command, live)
+		var exitErr *exec.ExitError
+		var interrupted *aid.InterruptedError
+		retry := errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && !errors.As(err, &interrupted)
+		if !retry || attempt > options.RetryOnFail {
+			if attempt > 1 && err == nil {
+				fmt.Printf("%sSucceeded on attempt %d.%s\n", colorGreen, attempt, colorReset)
+			} else if attempt > 1 {
+				fmt.Printf("%sFailed after %d attempts.%s\n", colorYellow, attempt, colorReset)
+			}
+			return output, stderr, err
+		}
+		fmt.Printf("\n%sCommand failed (%v), retrying in %s (%d/%d)...%s\n",
+			colorYellow, err, retryOnFailDelay, attempt, options.RetryOnFail, colorReset)
+		sleep(retryOnFailDelay)
+	}
+}
+
+// Most fix attempts made for one failing command
+const maxFixAttempts = 3
+
+// Run a command and, when it fails, offer a corrected command from the model.
+// With --auto-fix the fix is requested without asking first.
+func runWithFixes(query, command string) CommandResult {
+	for attempt := 1; ; attempt++ {
+		result := executeAndRecord(query, command)
+		if result.Err == nil || errors.Is(result.Err, errNotAllowed) || result.Interrupted() || attempt > maxFixAttempts {
+			return result
+		}
+
+		if !options.AutoFix {
+			fmt.Print("Ask for a corrected command? (y/n): ")
+			answer, err := stdin.ReadString('\n')
+			if err != nil || strings.TrimSpace(strings.ToLower(answer)) != "y" {
+				return result
+			}
+		}
+
+		fix, err := getCommandFix(result)
+		if err != nil {
+			fmt.Printf("Error getting a fix: %v\n", err)
+			return result
+		}
+		fixed := normalizeSuggestion(fix.Text)
+		fmt.Printf("\n%s%sSuggested fix (%d/%d):%s %s%s%s\n", colorBold, colorYellow, attempt, maxFixAttempts, colorReset, colorCyan, fixed, colorReset)
+		if showCost() {
+			fmt.Printf("%sFix cost: %s%s\n\n", colorPurple, formatCost(calculateCost(fix.PromptTokens, fix.CompletionTokens)), colorReset)
+		}
+
+		if !confirmFix(stdin, fixed, aid.NormalizeRisk(fix.Risk)) {
+			fmt.Println("Command not executed.")
+			return result
+		}
+		command = fixed
+	}
+}
+
+// Ask before running a fix from the model, with the warnings and typed
+// confirmations a fresh suggestion gets. A fix is offered in response to
+// a failure rather than asked for, so anything destructive also needs a
+// typed "yes".
+func confirmFix(reader *bufio.Reader, command, risk string) bool {
+	if blocked := disallowedPrograms(command); len(blocked) > 0 {
+		fmt.Printf("%sNot running: %s not in allowed_commands.%s\n", colorYellow, strings.Join(blocked, ", "), colorReset)
+		return false
+	}
+	warnTooLong(command)
+	typed := warnPipeToShell(command) || needsTypedConfirm(risk)
+
+	fmt.Printf("%sRun the fix? (y/n):%s ", riskColor(risk), colorReset)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return false
+	}
+	if strings.TrimSpace(strings.ToLower(answer)) != "y" {
+		return false
+	}
+	if isDestructive(command) && !typed && !confirmTyped(reader, "This fix looks destructive.") {
+		return false
+	}
+	return confirmBeforeRun(reader, command, risk)
+}
+
+// Read the last command run in the user's shell and its exit status, as
+// recorded by the hook in the completion script
+func lastShellCommand(getenv func(string) string) (string, int, error) {
+	command := strings.TrimSpace(getenv("DINGUS_LAST_COMMAND"))
+	if command == "" {
+		return "", 0, errors.New(`no command has been recorded; add eval "$(dingus-copilot completion bash)" (or zsh) to your shell rc file`)
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(getenv("DINGUS_LAST_STATUS")))
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid DINGUS_LAST_STATUS %q", getenv("DINGUS_LAST_STATUS"))
+	}
+	return command, status, nil
+}
+
+// Handle the fix subcommand: ask for a correction of the shell's last
+// failed command and offer to run it. Returns the exit code.
+func fixLastCommand(reader *bufio.Reader, getenv func(string) string) int {
+	command, status, err := lastShellCommand(getenv)
+	if err != nil {
+		fail(exitUsage, "Error: %v", err)
+		return exitUsage
+	}
+	if status == 0 {
+		fmt.Printf("The last command succeeded, so there is nothing to fix: %s\n", command)
+		return exitOK
+	}
+	fmt.Printf("%sLast command (exit status %d):%s %s\n", colorBold, status, colorReset, command)
+
+	failed := CommandResult{Command: command, Err: fmt.Errorf("exit status %d", status)}
+	fix, err := getCommandFix(failed)
+	if err != nil {
+		fail(errorExitCode(err), "Error getting a fix: %v%s", err, errorHint(err))
+		return errorExitCode(err)
+	}
+	suggestion := normalizeSuggestion(fix.Text)
+	fmt.Printf("\n%s%sSuggested fix:%s %s%s%s\n\n", colorBold, colorYellow, colorReset, colorCyan, suggestion, colorReset)
+	if showCost() {
+		fmt.Printf("%sFix cost: %s%s\n\n", colorPurple, formatCost(calculateCost(fix.PromptTokens, fix.CompletionTokens)), colorReset)
+	}
+	if !confirmFix(reader, suggestion, aid.NormalizeRisk(fix.Risk)) {
+		fmt.Println("Command not executed.")
+		return exitDeclined
+	}
+	return commandExitCode(runWithFixes("fix: "+command, suggestion))
+}
+
+// Matches a numbered list item such as "1. ls" or "2) cd dir"
+var stepPattern = regexp.MustCompile(`^\s*\d+[.)]\s+(.+)$`)
+
+// Parse a numbered list of commands from a --steps response
+func parseSteps(response string) []string {
+	var steps []string
+	for _, line := range strings.Split(response, "\n") {
+		if match := stepPattern.FindStringSubmatch(line); match != nil {
+			step := strings.Trim(strings.TrimSpace(match[1]), "`")
+			if step != "" {
+				steps = append(steps, step)
+			}
+		}
+	}
+	return steps
+}
+
+// Walk through each step, confirming before running it, and return the
+// exit code of the last failed step. Each step gets the warnings and typed
+// confirmations a single suggestion with the plan's risk rating would.
+func runSteps(reader *bufio.Reader, query string, steps []string, risk string) int {
+	code := exitOK
+	for i, step := range steps {
+		fmt.Printf("\n%sStep %d/%d:%s %s%s%s\n", colorBold, i+1, len(steps), colorReset, colorCyan, step, colorReset)
+		warnTooLong(step)
+		warnPipeToShell(step)
+		fmt.Print("Run this step? (y/n/s - 'n' to stop, 's' to skip): ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			fail(exitFailure, "Error reading confirmation: %v", err)
+			return exitFailure
+		}
+
+		switch strings.TrimSpace(strings.ToLower(answer)) {
+		case "y":
+			if !confirmBeforeRun(reader, step, risk) {
+				fmt.Println("Step not executed. Remaining steps not executed.")
+				return exitDeclined
+			}
+			result := executeAndRecord(query, step)
+			if result.Err != nil {
+				code = commandExitCode(result)
+			}
+			if result.Err != nil && !options.KeepGoing {
+				fmt.Printf("Step %d failed, stopping. Use --keep-going to continue past failures.\n", i+1)
+				return code
+			}
+		case "s":
+			fmt.Println("Step skipped.")
+		default:
+			fmt.Println("Remaining steps not executed.")
+			return exitDeclined
+		}
+	}
+	return code
+}
+
+// Checks a command and returns warnings to show the user
+type CommandValidator func(command string) ([]string, error)
+
+// Validator used before offering to run a suggestion, replaceable for testing
+var validateCommand CommandValidator = shellcheckCommand
+
+// Run shellcheck over the command, skipping silently if it isn't installed.
+// With portable on it checks as POSIX sh so bash-only syntax is flagged
+func shellcheckCommand(command string) ([]string, error) {
+	path, err := lookPath("shellcheck")
+	if err != nil {
+		return nil, nil
+	}
+	dialect := "bash"
+	if options.Portable {
+		dialect = "sh"
+	}
+	cmd := exec.Command(path, "--shell="+dialect, "--format=gcc", "-")
+	cmd.Stdin = strings.NewReader(command + "\n")
+	output, err := cmd.Output()
+
+	// shellcheck exits 1 when it finds problems, which is not a failure here
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		// Lines look like "-:1:5: warning: message [SC2086]"
+		if parts := strings.SplitN(line, ": ", 2); len(parts) == 2 {
+			warnings = append(warnings, parts[1])
+		}
+	}
+	return warnings, nil
+}
+
+// Placeholders the model leaves for the user, like <filename> or FILE
+var (
+	anglePlaceholderPattern = regexp.MustCompile(`<[A-Za-z][\w .-]*>`)
+	capsPlaceholderPattern  = regexp.MustCompile(`\b[A-Z][A-Z0-9_]{2,}\b`)
+)
+
+// All-caps words that are real syntax rather than placeholders
+var capsNonPlaceholders = map[string]bool{
+	"HEAD": true, "ORIG_HEAD": true, "FETCH_HEAD": true,
+	"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true,
+	"TCP": true, "UDP": true, "UTF": true, "EOF": true, "README": true,
+}
+
+// Find the spans of placeholders in a command, skipping variables like $HOME,
+// assignments like NODE_ENV=production and all-caps words in quoted text
+// such as an SQL statement
+func placeholderSpans(command string) [][]int {
+	spans := anglePlaceholderPattern.FindAllStringIndex(command, -1)
+	quoted := quotedSpans(command)
+	for _, span := range capsPlaceholderPattern.FindAllStringIndex(command, -1) {
+		word := command[span[0]:span[1]]
+		if capsNonPlaceholders[word] {
+			continue
+		}
+		if span[0] > 0 && strings.ContainsRune("$-={.", rune(command[span[0]-1])) {
+			continue
+		}
+		if span[1] < len(command) && command[span[1]] == '=' {
+			continue
+		}
+		if insideSpan(span, spans) || insideSpan(span, quoted) {
+			continue
+		}
+		spans = append(spans, span)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	return spans
+}
+
+// Find the spans of single- and double-quoted text in a command, including
+// the quotes. An unclosed quote runs to the end.
+func quotedSpans(command string) [][]int {
+	var spans [][]int
+	start := -1
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case start < 0 && (c == '\'' || c == '"'):
+			start, quote = i, c
+		case start >= 0 && c == '\\' && quote == '"':
+			i++
+		case start >= 0 && c == quote:
+			spans = append(spans, []int{start, i + 1})
+			start = -1
+		case start < 0 && c == '\\':
+			i++
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, []int{start, len(command)})
+	}
+	return spans
+}
+
+// Report whether span lies within any of the others
+func insideSpan(span []int, others [][]int) bool {
+	for _, other := range others {
+		if span[0] >= other[0] && span[1] <= other[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// List the distinct placeholders in a command in order of appearance
+func findPlaceholders(command string) []string {
+	var placeholders []string
+	seen := map[string]bool{}
+	for _, span := range placeholderSpans(command) {
+		placeholder := command[span[0]:span[1]]
+		if !seen[placeholder] {
+			seen[placeholder] = true
+			placeholders = append(placeholders, placeholder)
+		}
+	}
+	return placeholders
+}
+
+// Ask for a value for each placeholder; an empty answer keeps the original text
+func fillPlaceholders(command string) string {
+	spans := placeholderSpans(command)
+	if len(spans) == 0 {
+		return command
+	}
+
+	values := map[string]string{}
+	for _, placeholder := range findPlaceholders(command) {
+		fmt.Printf("Value for %s%s%s (Enter to keep as is): ", colorCyan, placeholder, colorReset)
+		value, err := stdin.ReadString('\n')
+		if err != nil && value == "" {
+			break
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			values[placeholder] = value
+		}
+	}
+	if len(values) == 0 {
+		return command
+	}
+
+	// Replace from the end so earlier spans stay valid
+	for i := len(spans) - 1; i >= 0; i-- {
+		span := spans[i]
+		if value, ok := values[command[span[0]:span[1]]]; ok {
+			command = command[:span[0]] + value + command[span[1]:]
+		}
+	}
+	fmt.Printf("%sCommand:%s %s%s%s\n", colorBold, colorReset, colorCyan, command, colorReset)
+	return command
+}
+
+// Shown when the suggestion only changes directory
+const cdNotice = "Note: dingus-copilot runs commands in a subshell, so a cd will not change the directory of your terminal.\nCopy it with 'c' and paste it into your shell, or use dingus-eval from 'dingus-copilot completion'."
+
+// Report whether a command is just a cd, which has no lasting effect in a subshell
+func isStandaloneCd(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || fields[0] != "cd" {
+		return false
+	}
+	return !strings.ContainsAny(command, ";|&\n")
+}
+
+// Programs that need a terminal, extended by interactive_commands in the config
+var interactivePrograms = []string{
+	"top", "htop", "btop", "vi", "vim", "nvim", "nano", "emacs", "less", "more", "man",
+	"ssh", "mosh", "telnet", "ftp", "sftp", "tmux", "screen", "watch",
+	"mysql", "psql", "sqlite3", "mongosh", "redis-cli",
+}
+
+// Report whether any program in a command needs an interactive terminal
+func isInteractive(command string) bool {
+	for _, program := range commandPrograms(command) {
+		if containsString(interactivePrograms, program) {
+			return true
+		}
+	}
+	return false
+}
+
+// Programs that read standard input when given no file operands, mapped to
+// the number of leading operands (such as a pattern) that are not files.
+// -1 marks programs that always read standard input.
+var stdinReaders = map[string]int{
+	"cat": 0, "sort": 0, "uniq": 0, "wc": 0, "head": 0, "tail": 0, "less": 0, "more": 0,
+	"base64": 0, "md5sum": 0, "sha1sum": 0, "sha256sum": 0,
+	"grep": 1, "egrep": 1, "fgrep": 1, "sed": 1, "awk": 1, "jq": 1,
+	"tr": -1, "tee": -1, "xargs": -1,
+}
+
+// Report whether a command starts a pipeline with a program that reads
+// standard input but is given no file or input redirection. Such commands
+// would wait on the terminal; they are run with /dev/null as input instead.
+func wouldBlockOnStdin(command string) bool {
+	words := shellWords(command)
+	atStart := true
+	for i := 0; i < len(words); i++ {
+		if !atStart {
+			if isCommandSeparator(words[i]) {
+				atStart = true
+			}
+			continue
+		}
+		atStart = false
+
+		// Skip variable assignments and sudo to find the program
+		for i < len(words) && (words[i] == "sudo" || (strings.Contains(words[i], "=") && !strings.HasPrefix(words[i], "-"))) {
+			i++
+		}
+		if i >= len(words) {
+			return false
+		}
+		skip, reads := stdinReaders[filepath.Base(words[i])]
+		if !reads {
+			continue
+		}
+
+		// Count file operands up to the end of this pipeline stage
+		operands, redirected, recursive := 0, false, false
+		for i+1 < len(words) && words[i+1] != "|" && !isCommandSeparator(words[i+1]) {
+			i++
+			switch word := words[i]; {
+			case strings.HasPrefix(word, "<"):
+				redirected = true
+			case word == ">" || word == ">>":
+				i++ // The output file is not an input operand
+			case word == "-r" || word == "-R" || word == "--recursive":
+				recursive = true
+			case word == "-" || strings.HasPrefix(word, "-"):
+			default:
+				operands++
+			}
+		}
+		if redirected || (recursive && skip > 0) {
+			continue
+		}
+		if skip < 0 || operands <= skip {
+			return true
+		}
+	}
+	return false
+}
+
+// List the program run by each command and pipeline stage in a command line
+func commandPrograms(command string) []string {
+	var programs []string
+	atStart := true
+	for _, word := range shellWords(command) {
+		switch {
+		case word == "|" || isCommandSeparator(word):
+			atStart = true
+		case !atStart || word == "sudo" || (strings.Contains(word, "=") && !strings.HasPrefix(word, "-")):
+		default:
+			programs = append(programs, filepath.Base(word))
+			atStart = false
+		}
+	}
+	return programs
+}
+
+// Returned instead of running a command that uses a program outside allowed_commands
+var errNotAllowed = errors.New("command is not in allowed_commands")
+
+// List the programs in a command that allowed_commands does not permit,
+// or nil when no allowlist is configured
+func disallowedPrograms(command string) []string {
+	if len(options.AllowedCommands) == 0 {
+		return nil
+	}
+	var blocked []string
+	for _, program := range commandPrograms(command) {
+		if !containsString(options.AllowedCommands, program) && !containsString(blocked, program) {
+			blocked = append(blocked, program)
+		}
+	}
+	return blocked
+}
+
+// Report whether a shell word ends one command and starts another
+func isCommandSeparator(word string) bool {
+	switch word {
+	case ";", "&&", "||", "&", "\n":
+		return true
+	}
+	return false
+}
+
+// Split a command into words, removing quotes and escapes, with the
+// operators | || & && ; < << <<< > >> and newlines as separate words
+func shellWords(command string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case strings.ContainsRune("|&;<>\n", r):
+			flush()
+			op := string(r)
+			for i+1 < len(runes) && runes[i+1] == r && r != ';' && r != '\n' && len(op) < 3 {
+				i++
+				op += string(r)
+			}
+			words = append(words, op)
+		case r == ' ' || r == '\t':
+			flush()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	flush()
+	return words
+}
+
+// Expand $VAR, ${VAR} and a leading ~ in a command for preview, following
+// shell quoting: nothing expands inside single quotes. Command substitutions
+// are never run; they are left in place and returned so they can be flagged.
+func expandPreview(command string, getenv func(string) string) (string, []string) {
+	var out strings.Builder
+	var substitutions []string
+	inSingle, inDouble := false, false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == '\\' && !inSingle && i+1 < len(command):
+			out.WriteByte(c)
+			out.WriteByte(command[i+1])
+			i++
+		case c == '\'' && !inDouble:
+			inSingle = !inSingle
+			out.WriteByte(c)
+		case c == '"' && !inSingle:
+			inDouble = !inDouble
+			out.WriteByte(c)
+		case inSingle:
+			out.WriteByte(c)
+		case c == '`':
+			end := strings.IndexByte(command[i+1:], '`')
+			if end < 0 {
+				end = len(command) - i - 2
+			}
+			sub := command[i : i+end+2]
+			substitutions = append(substitutions, sub)
+			out.WriteString(sub)
+			i += end + 1
+		case c == '$' && strings.HasPrefix(command[i:], "$("):
+			depth, j := 0, i+1
+			for ; j < len(command); j++ {
+				if command[j] == '(' {
+					depth++
+				} else if command[j] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if j >= len(command) {
+				j = len(command) - 1
+			}
+			sub := command[i : j+1]
+			substitutions = append(substitutions, sub)
+			out.WriteString(sub)
+			i = j
+		case c == '$' && strings.HasPrefix(command[i:], "${"):
+			end := strings.IndexByte(command[i:], '}')
+			if end < 0 {
+				out.WriteByte(c)
+				continue
+			}
+			out.WriteString(getenv(command[i+2 : i+end]))
+			i += end
+		case c == '$':
+			j := i + 1
+			for j < len(command) && (command[j] == '_' || isAlphaNum(command[j])) {
+				j++
+			}
+			// Positional parameters such as $1 are left as they are
+			if j == i+1 || (command[i+1] >= '0' && command[i+1] <= '9') {
+				out.WriteByte(c)
+				continue
+			}
+			out.WriteString(getenv(command[i+1 : j]))
+			i = j - 1
+		case c == '~' && !inDouble && (i == 0 || command[i-1] == ' ') && (i+1 == len(command) || command[i+1] == '/' || command[i+1] == ' '):
+			out.WriteString(getenv("HOME"))
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), substitutions
+}
+
+// Report whether a byte is an ASCII letter or digit
+func isAlphaNum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Tidy a suggestion that may span several lines: drop code fences the
+// model added despite the rules, trailing spaces and blank edge lines
+func normalizeSuggestion(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > 1 && strings.HasPrefix(lines[0], "```") && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+		lines = lines[1 : len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text = strings.TrimSpace(strings.Join(lines, "\n"))
+	if options.KeepTrailingText {
+		return text
+	}
+	command, prose := splitTrailingProse(text)
+	if prose != "" && options.Debug {
+		fmt.Fprintf(os.Stderr, "debug: discarded trailing text from the model: %q\n", prose)
+	}
+	return command
+}
+
+// Matches a line of prose such as "This will list the files." rather than a
+// command: capitalised words ending in a full stop, without shell syntax
+var proseLine = regexp.MustCompile(`^(Note:\s+\S+|[A-Z][a-z]+('[a-z]+)?)(\s+[^\s$|;&<>=` + "`" + `\\]+){2,}[.!]$`)
+
+// Matches the start of a here-document, capturing its terminator
+var heredocStart = regexp.MustCompile(`<<-?\s*['"]?(\w+)`)
+
+// Matches a sentence appended to a command on the same line
+var trailingSentence = regexp.MustCompile(`^(.*[^\s.])\s+((This|That|It|These|Note:)\s[^$|;&<>=` + "`" + `\\"']*[.!])$`)
+
+// Split a suggestion into its command and any explanation the model added
+// after it, either on the command's last line or on lines of their own.
+// Lines of a continued or multi-line command are never treated as prose.
+func splitTrailingProse(text string) (command, prose string) {
+	lines := strings.Split(text, "\n")
+	terminator := ""
+	if match := heredocStart.FindStringSubmatch(lines[0]); match != nil {
+		terminator = match[1]
+	}
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		// Here-document bodies are data, however much they read like prose
+		if terminator != "" {
+			if line == terminator {
+				terminator = ""
+			}
+			continue
+		}
+		if match := heredocStart.FindStringSubmatch(line); match != nil {
+			terminator = match[1]
+			continue
+		}
+		if proseLine.MatchString(line) && !continuesLine(strings.TrimSpace(lines[i-1])) {
+			prose = strings.TrimSpace(strings.Join(lines[i:], "\n"))
+			lines = lines[:i]
+			break
+		}
+	}
+
+	last := len(lines) - 1
+	if match := trailingSentence.FindStringSubmatch(lines[last]); match != nil && !printsText(match[1]) {
+		lines[last] = match[1]
+		prose = strings.TrimSpace(match[2] + "\n" + prose)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), prose
+}
+
+// Report whether a command line ends with a program that prints its
+// arguments, where a trailing sentence is part of the command
+func printsText(line string) bool {
+	programs := commandPrograms(line)
+	if len(programs) == 0 {
+		return false
+	}
+	switch programs[len(programs)-1] {
+	case "echo", "printf", "Write-Host", "Write-Output":
+		return true
+	}
+	return false
+}
+
+// Report whether a line continues onto the next one, with a trailing
+// backslash or an operator that needs another command after it
+func continuesLine(line string) bool {
+	for _, suffix := range []string{"\\", "|", "&&", "||"} {
+		if strings.HasSuffix(line, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count the separate commands in a multi-line suggestion, treating
+// continued lines and the bodies of loops, conditionals and groups as
+// part of one command
+func countCommands(command string) int {
+	count, depth := 0, 0
+	continued := false
+	for _, line := range strings.Split(command, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !continued && depth == 0 {
+			count++
+		}
+		if first := strings.Fields(line)[0]; depth > 0 && (first == "done" || first == "fi" || first == "esac" || first == "}" || first == ")") {
+			depth--
+		}
+		for _, opener := range []string{"do", "then", "{", "(", " in"} {
+			if strings.HasSuffix(line, opener) {
+				depth++
+				break
+			}
+		}
+		continued = continuesLine(line)
+	}
+	return count
+}
+
+// Print a multi-line command with its line breaks kept, warning when the
+// lines are separate commands rather than one continued command
+func printMultiLine(label, command string) {
+	fmt.Printf("\n%s%s%s%s\n", colorBold, colorYellow, label, colorReset)
+	for _, line := range strings.Split(command, "\n") {
+		fmt.Printf("  %s%s%s\n", colorCyan, line, colorReset)
+	}
+	fmt.Println()
+	if n := countCommands(command); n > 1 {
+		fmt.Printf("%sNote: this is %d separate commands; they will run one after another in a single shell.%s\n\n", colorYellow, n, colorReset)
+	}
+}
+
+// Join a user supplied suffix onto the suggested command
+func appendToCommand(command, suffix string) string {
+	suffix = strings.TrimSpace(suffix)
+	if suffix == "" {
+		return command
+	}
+	return command + " " + suffix
+}
+
+// Patterns for operations that delete data, overwrite files or take over the system
+var destructivePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\brm\s`),
+	regexp.MustCompile(`\b(dd|mkfs(\.\w+)?|shred|wipefs|shutdown|reboot|halt)\b`),
+	regexp.MustCompile(`\bsudo\b`),
+	regexp.MustCompile(`\bchmod\s+(-\w*R|-\w*\s+777)`),
+	regexp.MustCompile(`\|\s*(sudo\s+)?(ba|z|da)?sh\b`),
+	regexp.MustCompile(`(^|[^>&0-9])>\s*[^>&\s]`),
+	regexp.MustCompile(`:\(\)\s*\{`),
+}
+
+// Programs that fetch a URL and can write it to standard output
+var downloaders = []string{"curl", "wget", "fetch", "iwr", "irm", "invoke-webrequest", "invoke-restmethod"}
+
+// Programs that run a script read from standard input
+var scriptInterpreters = []string{"sh", "bash", "zsh", "dash", "ksh", "fish", "python", "python3", "perl", "ruby", "node", "php", "pwsh", "powershell", "iex", "invoke-expression"}
+
+// Matches a shell running a download through command or process substitution,
+// such as bash <(curl ...) or sh -c "$(wget ...)"
+var substitutedDownload = regexp.MustCompile(`\b(ba|z|da|k)?sh\b.*(\$\(|<\()\s*(curl|wget)\b`)
+
+// Matches a URL in a command
+var urlPattern = regexp.MustCompile(`(?i)\b(https?|ftp)://[^\s'"()|;<>]+`)
+
+// Report whether a command pipes a download straight into an interpreter
+func isPipeToShell(command string) bool {
+	downloading := false
+	atStart := true
+	for _, word := range shellWords(command) {
+		switch {
+		case word == "|":
+			atStart = true
+		case isCommandSeparator(word):
+			atStart, downloading = true, false
+		case !atStart || word == "sudo" || (strings.Contains(word, "=") && !strings.HasPrefix(word, "-")):
+		default:
+			program := strings.ToLower(filepath.Base(word))
+			if downloading && containsString(scriptInterpreters, program) {
+				return true
+			}
+			if containsString(downloaders, program) {
+				downloading = true
+			}
+			atStart = false
+		}
+	}
+	return substitutedDownload.MatchString(command)
+}
+
+// Warn about a command that runs a downloaded script, listing where it
+// comes from so the user can check it first. Reports whether it warned.
+func warnPipeToShell(command string) bool {
+	if !isPipeToShell(command) {
+		return false
+	}
+	fmt.Printf("%sWarning: this command downloads a script and runs it straight away.%s\n", colorRed, colorReset)
+	urls := urlPattern.FindAllString(command, -1)
+	if len(urls) == 0 {
+		fmt.Println("Check what it downloads before running it.")
+	}
+	for _, url := range urls {
+		fmt.Printf("Check the source before running it: %s\n", url)
+	}
+	fmt.Println()
+	return true
+}
+
+// Report whether a command contains a destructive operation
+func isDestructive(command string) bool {
+	for _, pattern := range destructivePatterns {
+		if pattern.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy text to clipboard based on OS
+func copyToClipboard(text string) error {
+	var cmd *exec.Cmd
+	
+	switch runtime.GOOS {
+	case "darwin": // macOS
+		cmd = exec.Command("pbcopy")
+	case "linux":
+		cmd = exec.Command("xclip", "-selection", "clipboard")
+	case "windows":
+		cmd = exec.Command("cmd", "/c", "echo", text, "|", "clip")
+		return cmd.Run()
+	default:
+		return fmt.Errorf("unsupported platform")
+	}
+	
+	// For non-Windows platforms
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// Read the clipboard contents, replaced in tests
+var readClipboard = func() (string, error) {
+	name, args, err := clipboardReadCommand(runtime.GOOS, os.Getenv)
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command(name, args...).Output()
+	return string(output), err
+}
+
+// Choose the program that prints the clipboard contents on this system
+func clipboardReadCommand(goos string, getenv func(string) string) (string, []string, error) {
+	switch {
+	case goos == "darwin":
+		return "pbpaste", nil, nil
+	case goos == "windows":
+		return "powershell", []string{"-NoProfile", "-Command", "Get-Clipboard"}, nil
+	case goos == "linux" && getenv("WAYLAND_DISPLAY") != "":
+		return "wl-paste", []string{"--no-newline"}, nil
+	case goos == "linux":
+		return "xclip", []string{"-selection", "clipboard", "-o"}, nil
+	}
+	return "", nil, fmt.Errorf("unsupported platform")
+}
+
+// Most clipboard text sent to the model, keeping the end where errors usually are
+const maxClipboardBytes = 4000
+
+// Values that look like credentials, redacted before text is sent to the model
+var secretValuePattern = regexp.MustCompile(`(?i)((?:token|secret|passw(?:or)?d|api[_-]?key|auth\w*|credential)["']?\s*[:=]\s*(?:bearer\s+)?)["']?[^\s"']{6,}["']?|\bbearer\s+[\w.~+/-]{8,}|\bsk-[\w-]{16,}|\bAKIA[0-9A-Z]{16}\b`)
+
+// Matches a $NAME or ${NAME} variable reference
+var envReference = regexp.MustCompile(`\$(\w+)|\$\{(\w+)\}`)
+
+// Variable names that suggest a secret value
+var secretNamePattern = regexp.MustCompile(`(?i)key|token|secret|passw(or)?d|credential|auth`)
+
+// Report whether a variable's value must not be sent: it is listed in
+// redact_env or its name suggests a secret
+func isSensitiveVar(name string) bool {
+	return containsString(options.RedactEnv, name) || secretNamePattern.MatchString(name)
+}
+
+// Replace variable references in a query with their values for --expand-env.
+// Unset and sensitive variables keep their $NAME reference, so the model
+// never sees the value and the command still reads it when it runs.
+func expandQueryEnv(query string, lookup func(string) (string, bool)) string {
+	return envReference.ReplaceAllStringFunc(query, func(ref string) string {
+		match := envReference.FindStringSubmatch(ref)
+		name := match[1] + match[2]
+		value, ok := lookup(name)
+		if !ok || isSensitiveVar(name) {
+			return ref
+		}
+		return value
+	})
+}
+
+// Replace credential-looking values and the active API key in text
+func redactSecrets(text string) string {
+	if activeAPIKey != "" {
+		text = strings.ReplaceAll(text, activeAPIKey, "[REDACTED]")
+	}
+	return secretValuePattern.ReplaceAllString(text, "${1}[REDACTED]")
+}
+
+// Text as written to local files such as history and --save-prompt, with
+// secrets redacted when redact_query is set. The API still gets the original.
+func loggedText(text string) string {
+	if options.RedactQuery {
+		return redactSecrets(text)
+	}
+	return text
+}
+
+// Save a query and its command to the history file, redacting the query if configured
+func recordHistory(query, command, output string) error {
+	return history.Record(historyFile, loggedText(query), command, output)
+}
+
+// Append the clipboard contents to a query as context, trimmed and redacted
+func withClipboardContext(query string, read func() (string, error)) (string, error) {
+	text, err := read()
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(strings.ToValidUTF8(text, ""))
+	if text == "" {
+		return "", errors.New("the clipboard is empty")
+	}
+	if len(text) > maxClipboardBytes {
+		text = "..." + tailUTF8(text, maxClipboardBytes)
+	}
+	return fmt.Sprintf("%s\n\nContext pasted by the user:\n<CLIPBOARD> %s </CLIPBOARD>", query, redactSecrets(text)), nil
+}
+
+// Returned when no tool can type into the terminal on this system
+var errPasteUnavailable = errors.New("pasting into the terminal is not available")
+
+// Choose the program that types text into the focused terminal: osascript on
+// macOS, wtype under Wayland (which blocks xdotool) and xdotool under X11
+func pasteTool(goos string, getenv func(string) string, text string) (string, []string, error) {
+	var name string
+	var args []string
+	switch {
+	case goos == "darwin":
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+		name, args = "osascript", []string{"-e", fmt.Sprintf(`tell application "System Events" to keystroke "%s"`, escaped)}
+	case goos == "linux" && getenv("WAYLAND_DISPLAY") != "":
+		name, args = "wtype", []string{"--", text}
+	case goos == "linux" && getenv("DISPLAY") != "":
+		name, args = "xdotool", []string{"type", "--clearmodifiers", "--", text}
+	default:
+		return "", nil, fmt.Errorf("%w: no graphical session found", errPasteUnavailable)
+	}
+	path, err := lookPath(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: install %s to enable it", errPasteUnavailable, name)
+	}
+	return path, args, nil
+}
+
+// Type the command at the shell prompt, falling back to the clipboard
+// when no paste tool is installed or permitted
+func copyPasteToTerminal(command string) error {
+	path, args, err := pasteTool(runtime.GOOS, os.Getenv, command)
+	if err == nil {
+		err = exec.Command(path, args...).Run()
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("%w: %v", errPasteUnavailable, err)
+	}
+	fmt.Printf("%s%v. Copying to the clipboard instead; paste it with your terminal's paste shortcut.%s\n", colorYellow, err, colorReset)
+	copyOrPrint(command)
+	return nil
+}
+
+// Returned when there is no clipboard to copy to, such as over SSH
+var errNoClipboard = errors.New("no clipboard is available in this session")
+
+// Report whether the clipboard can be written: the copy tool must be
+// installed and, on Linux, a graphical session must be running
+func clipboardAvailable(goos string, getenv func(string) string) bool {
+	if goos == "linux" && getenv("DISPLAY") == "" && getenv("WAYLAND_DISPLAY") == "" {
+		return false
+	}
+	_, err := lookPath(clipboardTool(goos))
+	return err == nil
+}
+
+// Values of the clipboard config key. Unset uses the tools and falls back
+// to OSC 52 when the terminal looks like it supports it.
+const (
+	clipboardTools = "tools" // Only pbcopy, xclip or clip
+	clipboardOSC52 = "osc52" // Always the OSC 52 terminal escape sequence
+)
+
+// Build the OSC 52 escape sequence that asks the terminal to put text on
+// the clipboard. Inside tmux it is wrapped so tmux passes it through.
+func osc52Sequence(text string, inTmux bool) string {
+	sequence := "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if inTmux {
+		return "\033Ptmux;\033" + sequence + "\033\\"
+	}
+	return sequence
+}
+
+// Report whether the terminal on stderr is likely to handle OSC 52: it
+// must be a terminal, and not a dumb one or the Linux console
+func osc52Likely(getenv func(string) string) bool {
+	switch getenv("TERM") {
+	case "", "dumb", "linux":
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Ask the terminal to copy text with OSC 52. Nothing confirms it worked.
+func copyOSC52(text string) error {
+	_, err := fmt.Fprint(os.Stderr, osc52Sequence(text, os.Getenv("TMUX") != ""))
+	return err
+}
+
+// Copy a command to the clipboard, or print it with a marker to copy by
+// hand when there is no clipboard. Reports whether it was copied.
+func copyOrPrint(command string) bool {
+	if options.Clipboard == clipboardOSC52 {
+		if err := copyOSC52(command); err == nil {
+			fmt.Printf("%sCommand sent to your terminal's clipboard!%s\n\n", colorGreen, colorReset)
+			return true
+		}
+	}
+
+	err := errNoClipboard
+	if options.Clipboard != clipboardOSC52 && clipboardAvailable(runtime.GOOS, os.Getenv) {
+		err = copyToClipboard(command)
+	}
+	if err == nil {
+		fmt.Printf("%sCommand copied to clipboard!%s\n\n", colorGreen, colorReset)
+		return true
+	}
+
+	// OSC 52 can't report failure, so the command is printed as well
+	if options.Clipboard == "" && osc52Likely(os.Getenv) && copyOSC52(command) == nil {
+		fmt.Printf("%sSent the command to your terminal's clipboard (OSC 52). If pasting doesn't work, copy it from here:%s\n", colorYellow, colorReset)
+		fmt.Printf("copy-me: %s\n\n", command)
+		return true
+	}
+	fmt.Printf("%sCould not copy the command (%v); copy it from here instead:%s\n", colorYellow, err, colorReset)
+	fmt.Printf("copy-me: %s\n\n", command)
+	return false
+}
+
+// Report whether a risk rating needs a typed "yes": dangerous always,
+// caution too under the cautious persona
+func needsTypedConfirm(risk string) bool {
+	return risk == aid.RiskDangerous || (options.ConfirmRisky && risk == aid.RiskCaution)
+}
+
+// Ask for a typed "yes" before running a command rated risky
+func confirmRisky(reader *bufio.Reader, risk string) bool {
+	return confirmTyped(reader, fmt.Sprintf("The model rated this command %s.", risk))
+}
+
+// Suggestions longer than this need a typed confirmation unless max_command_length is set
+const defaultMaxCommandLength = 300
+
+// Report whether a command is over max_command_length
+func commandTooLong(command string) bool {
+	return options.MaxCommandLength > 0 && utf8.RuneCountInString(command) > options.MaxCommandLength
+}
+
+// Ask for every typed confirmation a command needs before it runs. A
+// downloaded script always needs one, whatever the model rated it.
+func confirmBeforeRun(reader *bufio.Reader, command, risk string) bool {
+	if isPipeToShell(command) {
+		if !confirmTyped(reader, "This command runs a script downloaded from the internet.") {
+			return false
+		}
+	} else if needsTypedConfirm(risk) && !confirmRisky(reader, risk) {
+		return false
+	}
+	return !commandTooLong(command) || confirmLong(reader, command)
+}
+
+// Warn that a command is too long to vet at a glance
+func warnTooLong(command string) {
+	if commandTooLong(command) {
+		fmt.Printf("%sWarning: this command is %d characters long, over max_command_length (%d). Review it carefully.%s\n\n",
+			colorYellow, utf8.RuneCountInString(command), options.MaxCommandLength, colorReset)
+	}
+}
+
+// Ask for a typed "yes" before running a command over max_command_length
+func confirmLong(reader *bufio.Reader, command string) bool {
+	return confirmTyped(reader, fmt.Sprintf("This command is %d characters long.", utf8.RuneCountInString(command)))
+}
+
+// Explain why --yes must not run a command without asking, or return ""
+func autoRunBlocker(command, risk string) string {
+	switch {
+	case needsTypedConfirm(risk):
+		return "the model rated it " + risk
+	case isDestructive(command):
+		return "it looks destructive"
+	case isPipeToShell(command):
+		return "it runs a downloaded script"
+	case commandTooLong(command):
+		return fmt.Sprintf("it is longer than max_command_length (%d characters)", options.MaxCommandLength)
+	case len(disallowedPrograms(command)) > 0:
+		return "it uses programs outside allowed_commands"
+	case isStandaloneCd(command):
+		return "a cd on its own has no effect here"
+	}
+	return ""
+}
+
+// Show a warning and ask the user to type "yes" to go ahead
+func confirmTyped(reader *bufio.Reader, warning string) bool {
+	fmt.Printf("%s%s%s Type 'yes' to run it: ", colorRed, warning, colorReset)
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(strings.ToLower(answer)) == "yes"
+}
+
+// Runs a program attached to the terminal, replaceable for testing
+type ProgramRunner func(name string, args ...string) error
+
+var runProgram ProgramRunner = runAttached
+
+func runAttached(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// Find the program a command runs, skipping variable assignments and sudo
+func primaryBinary(command string) string {
+	for _, field := range strings.Fields(command) {
+		if field == "sudo" || (strings.Contains(field, "=") && !strings.HasPrefix(field, "=")) {
+			continue
+		}
+		return filepath.Base(field)
+	}
+	return ""
+}
+
+// Show the man page for a command's program, or its --help output without man
+func openDocs(command string) error {
+	binary := primaryBinary(command)
+	if binary == "" {
+		return fmt.Errorf("no program found in the command")
+	}
+	if _, err := lookPath("man"); err == nil {
+		if err := runProgram("man", binary); err == nil {
+			return nil
+		}
+	}
+	return runProgram(binary, "--help")
+}
+
+// Main function
+func main() {
+	// Exit with the code set below once deferred reports have run
+	exitCode := exitOK
+	defer func() {
+		// A panic must still crash loudly rather than exit with exitCode
+		if r := recover(); r != nil {
+			panic(r)
+		}
+		exit(exitCode)
+	}()
+
+	// Initialize config directory and files
+	err := initConfigFiles()
+	if err != nil {
+		fail(exitConfig, "Error initialising config: %v", err)
+	}
+
+	// Separate flags from the query
+	args, err := parseFlags(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			printHelp(os.Stdout)
+			exit(exitOK)
+		}
+		fail(exitUsage, "Error parsing flags: %v (see dingus-copilot --help)", err)
+	}
+
+	if options.NoColor || os.Getenv("NO_COLOR") != "" {
+		disableColor()
+	}
+
+	// In eval mode, send every diagnostic to stderr and keep the real
+	// stdout for the command alone
+	if options.Eval {
+		evalStdout = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
+	// Apply a history file override before any subcommand reads history
+	env := loadEnvSettings()
+	err = selectHistoryFile(env)
+	if err != nil {
+		fail(exitConfig, "Error creating history file directory: %v", err)
+	}
+
+	// Check if this is a version command
+	if options.Version || (len(args) == 1 && args[0] == "version") {
+		fmt.Println(versionString())
+		return
+	}
+
+	// Check if this is a help command. A query such as "help me find large
+	// files" is sent as a query instead.
+	if len(args) == 1 && args[0] == "help" {
+		printHelp(os.Stdout)
+		return
+	}
+
+	// Clear the banner acknowledgement so the next run shows it again
+	if options.ResetAck {
+		err := setConfigValue("acknowledged", nil)
+		if err != nil {
+			fail(exitConfig, "Error resetting acknowledgement: %v", err)
+		}
+		fmt.Printf("%sThe banner will be shown again on the next run.%s\n", colorGreen, colorReset)
+		return
+	}
+
+	// Check if the config file should be repaired
+	if options.RepairConfig {
+		err := repairConfig()
+		if err != nil {
+			fail(exitConfig, "Error repairing config: %v", err)
+		}
+		fmt.Printf("%sConfiguration repaired successfully!%s\n", colorGreen, colorReset)
+		return
+	}
+
+	// Check if this is a cleanup command. Only a bare "cleanup" is one, so
+	// "cleanup old docker images" is sent as a query.
+	if len(args) == 1 && args[0] == "cleanup" {
+		err := cleanupConfigFiles()
+		if err != nil {
+			fail(exitFailure, "Error cleaning up config files: %v", err)
+		}
+		fmt.Printf("%sConfiguration files removed successfully!%s\n", colorGreen, colorReset)
+		return
+	}
+
+	// Check if this is a completion command. It takes a single shell, so
+	// "completion script for git" is sent as a query.
+	if len(args) >= 1 && len(args) <= 2 && args[0] == "completion" {
+		if len(args) != 2 {
+			fail(exitUsage, "Usage: dingus-copilot completion bash|zsh")
+		}
+		script, err := completionScript(args[1])
+		if err != nil {
+			fail(exitUsage, "Error: %v", err)
+		}
+		fmt.Print(script)
+		return
+	}
+
+	// Check if this is an export command. Anything after the flags makes
+	// it a query instead, such as "export PATH to include ~/bin".
+	if len(args) >= 1 && args[0] == "export" {
+		err := runExport(args[1:])
+		if err != errNotSubcommand {
+			if err != nil {
+				fail(exitFailure, "Error exporting history: %v", err)
+			}
+			return
+		}
+	}
+
+	// Check if this is an update command. Only a bare "update" or
+	// "update --check" is one, so "update all pip packages" is sent as a query.
+	if len(args) >= 1 && args[0] == "update" && (len(args) == 1 || len(args) == 2 && args[1] == "--check") {
+		err := runUpdate(len(args) == 2)
+		if err != nil {
+			fail(exitFailure, "Error checking for updates: %v", err)
+		}
+		return
+	}
+
+	// A leading @model picks the model for this query only
+	model, args := inlineModel(args)
+	if model != "" {
+		options.Model = model
+	}
+
+	// Check if a query was provided, treating blank arguments as none so no
+	// API call is spent on an empty prompt
+	if strings.TrimSpace(strings.Join(args, " ")) == "" && !options.Interactive {
+		printHelp(os.Stdout)
+		exit(exitUsage)
+	}
+	
+	// Join all positional arguments as the query and fill any placeholders
+	query, err := renderQuery(strings.Join(args, " "), options.Args)
+	if err != nil {
+		fail(exitUsage, "Error: %v", err)
+	}
+
+	if options.Trace {
+		defer tracer.Report(os.Stderr)
+	}
+
+	// Load optional settings, letting flags override them
+	start := time.Now()
+	config, err := loadConfig()
+	if err != nil {
+		fail(exitConfig, "Error loading config: %v", err)
+	}
+	err = resolveOptions(config, env)
+	if err != nil {
+		fail(exitConfig, "Error in options: %v", err)
+	}
+	tracer.Track("config load", start)
+	if provider := aid.Providers[options.Provider]; model != "" && !provider.KnowsModel(model) {
+		fail(exitUsage, "Error: unknown model %q for %s (use one of %s, or --model for others)",
+			model, provider.DisplayName, strings.Join(provider.Models, ", "))
+	}
+
+	// Check if this is a config sources command, which shows the resolved settings
+	if len(args) == 2 && args[0] == "config" && args[1] == "sources" {
+		err := showConfigSources(os.Stdout, config, env)
+		if err != nil {
+			fail(exitFailure, "Error: %v", err)
+		}
+		return
+	}
+
+	// Check if this is a doctor command, which checks the resolved settings.
+	// Other words after it make it a query, such as "doctor the png headers".
+	if len(args) >= 1 && args[0] == "doctor" {
+		failures, err := runDoctor(os.Stdout, args[1:], env)
+		if err != errNotSubcommand {
+			if err != nil {
+				fail(exitUsage, "Error: %v", err)
+			}
+			if failures > 0 {
+				exit(exitFailure)
+			}
+			return
+		}
+	}
+
+	// Show the deployment's disclaimer until the user acknowledges it once
+	if config.Banner != "" && !config.Acknowledged {
+		acknowledged, err := acknowledgeBanner(stdin, config.Banner)
+		if err != nil {
+			fail(exitConfig, "Error saving acknowledgement: %v", err)
+		}
+		if !acknowledged {
+			fmt.Println("The banner must be acknowledged before using dingus-copilot.")
+			exitCode = exitDeclined
+			return
+		}
+	}
+
+	// Check if this is a history command, which can run what it picks.
+	// Other words after it make it a query, such as "history of git tags".
+	if len(args) >= 1 && args[0] == "history" {
+		code, err := runHistory(args[1:])
+		if err != errNotSubcommand {
+			if err != nil {
+				fail(code, "Error: %v", err)
+			}
+			exitCode = code
+			return
+		}
+	}
+
+	// Check if this is a last command, which needs the resolved history file
+	if query == "last" {
+		err := showLast()
+		if err != nil {
+			fail(exitFailure, "Error reading history: %v", err)
+		}
+		return
+	}
+
+	// Try the environment first, then key_command, then the selected
+	// provider's key in the config file
+	provider := aid.Providers[options.Provider]
+	keyFromEnv := false
+	if apiKey := env["OPENAI_API_KEY"]; apiKey != "" && provider.Name == "openai" {
+		activeAPIKey, keyFromEnv = apiKey, true
+		options.KeyCommand = ""
+	} else if options.KeyCommand == "" {
+		activeAPIKey, err = loadKey(provider.Name)
+	}
+	// Local servers need no key, though a saved one is still sent, and
+	// key_command supplies one for each call
+	promptable := !keyFromEnv && !provider.NoKey && options.KeyCommand == ""
+	if promptable && (err != nil || activeAPIKey == "") {
+		// If API key is not found or empty, ask user for it and save it
+		err = promptForAPIKey(fmt.Sprintf("Enter your %s API Key: ", provider.DisplayName))
+		if err != nil {
+			fail(exitConfig, "Error: %v", err)
+		}
+	} else if promptable && isKeyMarkedInvalid(activeAPIKey) {
+		// Skip a round-trip that is known to fail with the saved key
+		fmt.Printf("%sYour saved %s API key was rejected previously.%s\n", colorYellow, provider.DisplayName, colorReset)
+		err = promptForAPIKey(fmt.Sprintf("Enter a new %s API Key: ", provider.DisplayName))
+		if err != nil {
+			fail(exitConfig, "Error: %v", err)
+		}
+	}
+
+	// Load history from previous runs for context
+	start = time.Now()
+	err = history.Load(historyFile)
+	if err != nil {
+		fmt.Printf("Error loading history: %v\n", err)
+	}
+	tracer.Track("history load", start)
+
+	rateLimiter = aid.NewRateLimiter(config.RateLimitRPM, rateLimitFile)
+	rateLimiter.OnWait = func(delay time.Duration) {
+		fmt.Printf("%sRate limit reached, waiting %s...%s\n", colorYellow, delay.Round(time.Second), colorReset)
+	}
+
+	// Check if this is a batch command. It takes a single file, so "batch
+	// rename photos by date" is sent as a query.
+	if len(args) >= 1 && len(args) <= 2 && args[0] == "batch" {
+		if len(args) != 2 {
+			fail(exitUsage, "Usage: dingus-copilot batch <file>")
+		}
+		err = runBatch(args[1])
+		if err != nil {
+			fail(errorExitCode(err), "Error running batch: %v", err)
+		}
+		return
+	}
+
+	// Check if this is a fix command. A query that starts with "fix", such
+	// as "fix permissions on ~/.ssh", is sent as a query instead.
+	if len(args) == 1 && args[0] == "fix" {
+		exitCode = fixLastCommand(stdin, os.Getenv)
+		return
+	}
+
+	// Interactive mode asks for its own queries
+	if options.Interactive {
+		stats := runInteractive(stdin)
+		if options.Stats {
+			fmt.Print(stats.summary(time.Now()))
+		}
+		return
+	}
+
+	// Questions get an explanation rather than a command to run
+	ask := suggestCommand
+	explaining := isQuestion(query)
+	if explaining {
+		ask = getExplanation
+	}
+	if options.RawPrompt {
+		ask = getRawReply
+	}
+
+	// Pasted context and expanded variables go to the model but not into history
+	prompt := query
+	if options.ExpandEnv {
+		prompt = expandQueryEnv(query, os.LookupEnv)
+	}
+	if options.FromClipboard {
+		prompt, err = withClipboardContext(prompt, readClipboard)
+		if err != nil {
+			fail(exitFailure, "Error reading clipboard: %v", err)
+		}
+	}
+
+	// Get the suggested command from OpenAI and token usage
+	suggestion, err := ask(prompt)
+	if errors.Is(err, aid.ErrAPIKeyInvalid) && keyFromEnv {
+		fail(exitAPI, "Error: the OPENAI_API_KEY from your environment or .env file was rejected (401 Unauthorized)")
+	}
+	if errors.Is(err, aid.ErrAPIKeyInvalid) && options.KeyCommand != "" {
+		fail(exitAPI, "Error: the key from key_command was rejected (401 Unauthorized)")
+	}
+	for errors.Is(err, aid.ErrAPIKeyInvalid) {
+		// Offer to replace a revoked or mistyped key and try again
+		markKeyInvalid(activeAPIKey)
+		fmt.Printf("%sYour %s API key was rejected (401 Unauthorized).%s\n", colorYellow, provider.DisplayName, colorReset)
+		if promptErr := promptForAPIKey(fmt.Sprintf("Enter a new %s API Key (or press Enter to quit): ", provider.DisplayName)); promptErr != nil {
+			fail(exitConfig, "Error: %v", promptErr)
+		}
+		suggestion, err = ask(prompt)
+	}
+	if err != nil {
+		fail(errorExitCode(err), "Error getting command suggestion: %v%s", err, errorHint(err))
+	}
+
+	// A raw reply is printed exactly as the model sent it
+	if options.RawPrompt {
+		fmt.Println(suggestion.Text)
+		if showCost() {
+			fmt.Printf("%sQuery cost: %s%s\n", colorPurple, formatCost(calculateCost(suggestion.PromptTokens, suggestion.CompletionTokens)), colorReset)
+		}
+		return
+	}
+
+	// An explanation has nothing to run, so show it and stop
+	if explaining {
+		fmt.Printf("\n%s\n\n", renderMarkdown(suggestion.Text))
+		if showCost() {
+			fmt.Printf("%sQuery cost: %s%s\n", colorPurple, formatCost(calculateCost(suggestion.PromptTokens, suggestion.CompletionTokens)), colorReset)
+		}
+		return
+	}
+	suggestedCommand := normalizeSuggestion(suggestion.Text)
+	promptTokens, completionTokens := suggestion.PromptTokens, suggestion.CompletionTokens
+
+	// Optionally summarise the command's effect with a second, cheaper call
+	summary := ""
+	if config.ShowSummary && !options.Steps {
+		response, err := getCommandSummary(suggestedCommand)
+		promptTokens += response.PromptTokens
+		completionTokens += response.CompletionTokens
+		if err != nil {
+			fmt.Printf("Error getting command summary: %v\n", err)
 		} else {
-			// Output the result
-			fmt.Printf("\n%sCommand output:%s\n%s\n", colorBold, colorReset, output)
+			summary = response.Text
 		}
+	}
+
+	// Calculate the cost
+	cost := calculateCost(promptTokens, completionTokens)
+
+	// In eval mode only the command goes to stdout for the calling shell to run
+	if options.Eval {
+		if showCost() {
+			fmt.Printf("%sQuery cost: %s%s\n", colorPurple, formatCost(cost), colorReset)
+		}
+		command := suggestedCommand
+		if options.Steps {
+			command = strings.Join(parseSteps(suggestedCommand), "\n")
+		}
+		if blocked := disallowedPrograms(command); len(blocked) > 0 {
+			fail(exitDeclined, "Error: %s not in allowed_commands, so the command will not be run", strings.Join(blocked, ", "))
+		}
+		// The shell runs whatever is printed without asking, so ask here
+		// for the typed confirmations the command would otherwise need
+		risk := aid.NormalizeRisk(suggestion.Risk)
+		if autoRunBlocker(command, risk) != "" && !isStandaloneCd(command) {
+			fmt.Printf("Suggested command: %s\n\n", command)
+			warnTooLong(command)
+			typed := warnPipeToShell(command) || needsTypedConfirm(risk)
+			if isDestructive(command) && !typed && !confirmTyped(stdin, "This command looks destructive.") ||
+				!confirmBeforeRun(stdin, command, risk) {
+				fmt.Println("Command not executed.")
+				exitCode = exitDeclined
+				return
+			}
+		}
+		fmt.Fprintln(evalStdout, command)
+		if !options.NoHistory {
+			if err := recordHistory(query, command, ""); err != nil {
+				fmt.Printf("Error saving history: %v\n", err)
+			}
+		}
+		return
+	}
+
+	// In steps mode, walk through each command in turn
+	if options.Steps {
+		steps := parseSteps(suggestedCommand)
+		if len(steps) == 0 {
+			fail(exitAPI, "Error: no numbered commands found in response:\n%s", suggestedCommand)
+		}
+		fmt.Printf("\n%s%sSuggested steps:%s\n", colorBold, colorYellow, colorReset)
+		for i, step := range steps {
+			fmt.Printf("  %d. %s%s%s\n", i+1, colorCyan, step, colorReset)
+		}
+		if showCost() {
+			fmt.Printf("\n%sQuery cost: %s%s\n", colorPurple, formatCost(cost), colorReset)
+		}
+
+		// Encourage review when the model was unsure
+		if hint := confidenceHint(suggestion.Confidence); hint != "" {
+			fmt.Printf("\n%s%s%s\n", colorYellow, hint, colorReset)
+		}
+		exitCode = runSteps(stdin, query, steps, aid.NormalizeRisk(suggestion.Risk))
+		return
+	}
+
+	// Output the suggested command with decoration, keeping the line
+	// breaks of a multi-line command
+	if strings.Contains(suggestedCommand, "\n") {
+		printMultiLine("Suggested command:", suggestedCommand)
+	} else {
+		fmt.Printf("\n%s%s%sSuggested command:%s %s%s%s%s%s\n\n",
+			colorBold, colorYellow, colorBold,
+			colorReset,
+			colorCyan, colorBold,
+			suggestedCommand,
+			colorReset, colorReset)
+	}
 		
-		// Add to command history
-		history.Add(suggestedCommand, output)
-		
+	// Output the token usage and cost in purple
+	if showCost() {
+		fmt.Printf("%sQuery cost: %s%s\n\n", colorPurple, formatCost(cost), colorReset)
+	}
+
+	// Explain why a bare cd suggestion would appear to do nothing
+	if isStandaloneCd(suggestedCommand) {
+		fmt.Printf("%s%s%s\n\n", colorYellow, cdNotice, colorReset)
+	}
+
+	// Encourage review when the model was unsure
+	if hint := confidenceHint(suggestion.Confidence); hint != "" {
+		fmt.Printf("%s%s%s\n\n", colorYellow, hint, colorReset)
+	}
+
+	// Surface syntax problems the model may have introduced
+	if config.Shellcheck && runtime.GOOS != "windows" {
+		warnings, err := validateCommand(suggestedCommand)
+		if err != nil {
+			fmt.Printf("Error running shellcheck: %v\n", err)
+		}
+		for _, warning := range warnings {
+			fmt.Printf("%sshellcheck: %s%s\n", colorYellow, warning, colorReset)
+		}
+		if len(warnings) > 0 {
+			fmt.Println()
+		}
+	}
+
+	// In learn mode, quiz the user before revealing an explanation
+	if options.Learn {
+		if err := runQuiz(stdin, suggestedCommand, getCommandBreakdown); err != nil {
+			fmt.Printf("Error getting an explanation: %v\n", err)
+		}
+	} else if options.Explain {
+		explanation, err := getCommandBreakdown(suggestedCommand)
+		if err != nil {
+			fmt.Printf("Error getting an explanation: %v\n", err)
+		} else {
+			printExplanation(explanation)
+		}
+	}
+
+	// Show what the command will do above the prompt
+	if summary != "" {
+		fmt.Printf("%sThis will:%s %s\n\n", colorBold, colorReset, summary)
+	}
+
+	// Flag commands too long to vet at a glance
+	warnTooLong(suggestedCommand)
+
+	// Downloads piped into a shell are never run without a typed "yes"
+	warnPipeToShell(suggestedCommand)
+
+	// With --yes, run without asking unless a guard needs the user
+	risk := aid.NormalizeRisk(suggestion.Risk)
+	if options.Yes && isPipeToShell(suggestedCommand) {
+		fmt.Printf("%sNot running: --yes never runs a downloaded script.%s\n", colorRed, colorReset)
+		exitCode = exitDeclined
+		return
+	}
+	if options.Yes {
+		reason := autoRunBlocker(suggestedCommand, risk)
+		if reason == "" {
+			exitCode = commandExitCode(runWithFixes(query, suggestedCommand))
+			return
+		}
+		fmt.Printf("%sNot running automatically: %s.%s\n", colorYellow, reason, colorReset)
+	}
+
+	// Ask if the user wants to run the command, showing its docs as often as asked
+	// The prompt is coloured by the model's risk rating
+	reader := stdin
+	confirm := ""
+	for {
+		question := "Do you want to run this command? (y/n/c/t/a/o/p/s/l - 'c' to copy to clipboard, 't' to type it at your prompt, 'a' to append to the command, 'o' to open its docs, 'p' to preview variable expansion, 's' for a simpler version, 'l' for a more robust one): "
+		blocked := disallowedPrograms(suggestedCommand)
+		if len(blocked) > 0 {
+			// Only copying is offered when the allowlist forbids running it
+			fmt.Printf("%sRunning is disabled: %s not in allowed_commands.%s\n", colorYellow, strings.Join(blocked, ", "), colorReset)
+			question = "Copy this command? (c/t/o/p/s/l/n - 'c' to copy to clipboard, 't' to type it at your prompt, 'o' to open its docs, 'p' to preview variable expansion, 's' for a simpler version, 'l' for a more robust one): "
+		}
+		fmt.Printf("%sRisk: %s.%s %s", riskColor(risk), risk, colorReset, question)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			fail(exitFailure, "Error reading confirmation: %v", err)
+		}
+		confirm = strings.TrimSpace(strings.ToLower(answer))
+		if len(blocked) > 0 && (confirm == "y" || confirm == "a") {
+			confirm = "n"
+		}
+
+		// Replace the suggestion with a refined one and ask again
+		if instruction, ok := refinements[confirm]; ok {
+			refined, err := getRefinement(query, suggestedCommand, instruction)
+			promptTokens += refined.PromptTokens
+			completionTokens += refined.CompletionTokens
+			if err != nil {
+				fmt.Printf("Error refining the command: %v\n\n", err)
+				continue
+			}
+			suggestedCommand, risk = normalizeSuggestion(refined.Text), aid.NormalizeRisk(refined.Risk)
+			if strings.Contains(suggestedCommand, "\n") {
+				printMultiLine("Refined command:", suggestedCommand)
+			} else {
+				fmt.Printf("\n%s%sRefined command:%s %s%s%s\n\n", colorBold, colorYellow, colorReset, colorCyan, suggestedCommand, colorReset)
+			}
+			warnPipeToShell(suggestedCommand)
+			if showCost() {
+				fmt.Printf("%sRefinement cost: %s (total %s)%s\n\n", colorPurple,
+					formatCost(calculateCost(refined.PromptTokens, refined.CompletionTokens)), formatCost(calculateCost(promptTokens, completionTokens)), colorReset)
+			}
+			continue
+		}
+
+		// Show what variables expand to without running anything
+		if confirm == "p" {
+			expanded, substitutions := expandPreview(suggestedCommand, os.Getenv)
+			fmt.Printf("\n%sExpanded:%s %s\n", colorBold, colorReset, expanded)
+			for _, sub := range substitutions {
+				fmt.Printf("%sNot expanded: %s runs only when the command runs.%s\n", colorYellow, sub, colorReset)
+			}
+			fmt.Println()
+			continue
+		}
+
+		if confirm != "o" {
+			break
+		}
+		if err := openDocs(suggestedCommand); err != nil {
+			fmt.Printf("Error opening docs: %v\n", err)
+		}
+		fmt.Println()
+	}
+
+	switch confirm {
+	case "y":
+		// A cd in a subshell has no effect, so offer to copy it instead
+		if isStandaloneCd(suggestedCommand) {
+			fmt.Print("Running cd here won't change your shell's directory. Copy it to the clipboard instead? (y/n): ")
+			answer, err := reader.ReadString('\n')
+			if err != nil {
+				fail(exitFailure, "Error reading confirmation: %v", err)
+			}
+			if strings.TrimSpace(strings.ToLower(answer)) == "y" {
+				copyOrPrint(suggestedCommand)
+			}
+			fmt.Println("Command not executed.")
+			exitCode = exitDeclined
+			return
+		}
+
+		if !confirmBeforeRun(reader, suggestedCommand, risk) {
+			fmt.Println("Command not executed.")
+			exitCode = exitDeclined
+			return
+		}
+
+		// Run the suggested command, exiting with its code
+		exitCode = commandExitCode(runWithFixes(query, suggestedCommand))
+
+	case "a":
+		// Append a suffix such as a pipe or redirect before running
+		fmt.Print("Append to command: ")
+		suffix, err := reader.ReadString('\n')
+		if err != nil {
+			fail(exitFailure, "Error reading suffix: %v", err)
+		}
+		command := appendToCommand(suggestedCommand, suffix)
+		fmt.Printf("%sCommand:%s %s%s%s\n", colorBold, colorReset, colorCyan, command, colorReset)
+		warnPipeToShell(command)
+
+		if isDestructive(suffix) {
+			fmt.Printf("%sWarning: the appended text looks destructive.%s Run anyway? (y/n): ", colorYellow, colorReset)
+			answer, err := reader.ReadString('\n')
+			if err != nil {
+				fail(exitFailure, "Error reading confirmation: %v", err)
+			}
+			if strings.TrimSpace(strings.ToLower(answer)) != "y" {
+				fmt.Println("Command not executed.")
+				exitCode = exitDeclined
+				return
+			}
+		}
+		if !confirmBeforeRun(reader, command, risk) {
+			fmt.Println("Command not executed.")
+			exitCode = exitDeclined
+			return
+		}
+		exitCode = commandExitCode(runWithFixes(query, command))
+
 	case "c":
-		// copy to clipboard
-		err = copyToClipboard(suggestedCommand)
-		if err == nil {
-			fmt.Printf("%sCommand copied to clipboard!%s\n\n", colorGreen, colorReset)
+		// copy to clipboard, or print it where there is none
+		copyOrPrint(suggestedCommand)
+
+		// The copied command is likely run elsewhere, so optionally keep it as context
+		if config.RecordOnCopy && !options.NoHistory {
+			if err := recordHistory(query, suggestedCommand, ""); err != nil {
+				fmt.Printf("Error saving history: %v\n", err)
+			}
 		}
 		
 		fmt.Println("Command not executed.")
+	case "t":
+		// Type the command at the shell prompt once this program exits
+		if err := copyPasteToTerminal(suggestedCommand); err != nil {
+			fmt.Printf("Error copying to clipboard: %v\n", err)
+		}
 	default:
 		fmt.Println("Command not executed.")
+		exitCode = exitDeclined
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Record the programs run instead of running them, failing those in fail
+func stubRunProgram(t *testing.T, fail ...string) *[]string {
+	saved := runProgram
+	t.Cleanup(func() { runProgram = saved })
+	var calls []string
+	runProgram = func(name string, args ...string) error {
+		calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+		for _, f := range fail {
+			if f == name {
+				return errors.New("exit status 16")
+			}
+		}
+		return nil
+	}
+	return &calls
+}
+
+func TestPrimaryBinary(t *testing.T) {
+	tests := map[string]string{
+		"tar -xzf a.tgz":              "tar",
+		"sudo LC_ALL=C /usr/bin/sort": "sort",
+		"FOO=1":                       "",
+		"":                            "",
+	}
+	for command, want := range tests {
+		if got := primaryBinary(command); got != want {
+			t.Errorf("primaryBinary(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestOpenDocs(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed []string
+		fail      []string
+		want      []string
+	}{
+		{"man page", []string{"man"}, nil, []string{"man tar"}},
+		{"no man", nil, nil, []string{"tar --help"}},
+		{"no man page", []string{"man"}, []string{"man"}, []string{"man tar", "tar --help"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubLookPath(t, tt.installed...)
+			calls := stubRunProgram(t, tt.fail...)
+			result := newTestEnv(t, "sudo tar -xzf backup.tgz").run("o\nn\n", "unpack the backup")
+			if !reflect.DeepEqual(*calls, tt.want) {
+				t.Errorf("ran %q, want %q", *calls, tt.want)
+			}
+			// The prompt is shown again after the docs
+			if n := strings.Count(result.stdout, "Do you want to run this command?"); n != 2 {
+				t.Errorf("prompted %d times, want 2:\n%s", n, result.stdout)
+			}
+			if result.code != exitDeclined {
+				t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+// Install the shell and clipboard tool doctor looks for
+func stubTools(t *testing.T) {
+	stubLookPath(t, aid.SelectShell(runtime.GOOS).Path, clipboardTool(runtime.GOOS))
+}
+
+func TestPrintChecks(t *testing.T) {
+	saved := [...]string{colorReset, colorGreen, colorRed}
+	t.Cleanup(func() { colorReset, colorGreen, colorRed = saved[0], saved[1], saved[2] })
+	colorReset, colorGreen, colorRed = "", "", ""
+
+	var out strings.Builder
+	failures := printChecks(&out, []doctorCheck{
+		{"first", func() error { return nil }},
+		{"second", func() error { return errors.New("broken") }},
+	})
+	if failures != 1 {
+		t.Errorf("failures = %d, want 1", failures)
+	}
+	assertContains(t, out.String(), "[ok]   first", "[fail] second: broken", "1 check(s) failed.")
+
+	out.Reset()
+	if failures := printChecks(&out, []doctorCheck{{"first", func() error { return nil }}}); failures != 0 {
+		t.Errorf("failures = %d, want 0", failures)
+	}
+	assertContains(t, out.String(), "Everything looks good.")
+}
+
+func TestDoctorPasses(t *testing.T) {
+	stubTools(t)
+	e := newTestEnv(t)
+	result := e.run("", "doctor")
+	if result.code != exitOK {
+		t.Errorf("exit code = %d, want %d:\n%s", result.code, exitOK, result.stdout)
+	}
+	assertContains(t, result.stdout,
+		"[ok]   Config directory is writable",
+		"[ok]   OpenAI API key is set",
+		"[ok]   Shell is installed",
+		"[ok]   Clipboard tool is installed",
+		"[ok]   API is reachable at "+e.env["OPENAI_BASE_URL"],
+		"Everything looks good.")
+	assertNotContains(t, result.stdout, "API key is accepted")
+}
+
+func TestDoctorFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, e *testEnv)
+		failed string
+	}{
+		{"missing key", func(t *testing.T, e *testEnv) {
+			stubTools(t)
+			e.env["OPENAI_API_KEY"] = ""
+		}, "[fail] OpenAI API key is set: no key found"},
+		{"failing key_command", func(t *testing.T, e *testEnv) {
+			stubTools(t)
+			e.env["OPENAI_API_KEY"] = ""
+			e.writeConfig(`{"key_command": "exit 1"}`)
+		}, "[fail] OpenAI API key is set: " + aid.ErrAPIKeyMissing.Error() + ": key_command failed"},
+		{"missing tools", func(t *testing.T, e *testEnv) {
+			stubLookPath(t)
+		}, "[fail] Clipboard tool is installed"},
+		{"unreachable API", func(t *testing.T, e *testEnv) {
+			stubTools(t)
+			e.env["OPENAI_BASE_URL"] = "http://127.0.0.1:1"
+		}, "[fail] API is reachable at http://127.0.0.1:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			tt.setup(t, e)
+			result := e.run("", "doctor")
+			if result.code != exitFailure {
+				t.Errorf("exit code = %d, want %d", result.code, exitFailure)
+			}
+			assertContains(t, result.stdout, tt.failed, "check(s) failed.")
+			if len(e.api.requests) != 0 {
+				t.Errorf("made %d chat requests", len(e.api.requests))
+			}
+		})
+	}
+}
+
+func TestDoctorCheckKey(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusUnauthorized} {
+		stubTools(t)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				w.WriteHeader(status)
+			}
+		}))
+		e := newTestEnv(t)
+		e.env["OPENAI_BASE_URL"] = server.URL
+		result := e.run("", "doctor", "--check-key")
+		server.Close()
+		if status == http.StatusOK {
+			assertContains(t, result.stdout, "[ok]   API key is accepted")
+			if result.code != exitOK {
+				t.Errorf("exit code = %d, want %d", result.code, exitOK)
+			}
+		} else {
+			assertContains(t, result.stdout, "[fail] API key is accepted: "+aid.ErrAPIKeyInvalid.Error())
+			if result.code != exitFailure {
+				t.Errorf("exit code = %d, want %d", result.code, exitFailure)
+			}
+		}
+	}
+}
+
+func TestDoctorQuery(t *testing.T) {
+	e := newTestEnv(t, "file a.png")
+	result := e.run("n\n", "doctor", "the", "png", "headers")
+	assertNotContains(t, result.stdout, "[ok]")
+	if prompts := e.api.prompts(); len(prompts) != 1 || !strings.Contains(prompts[0], "doctor the png headers") {
+		t.Errorf("prompts = %q, want the words sent as a query", prompts)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	data := `# settings
+OPENAI_API_KEY=sk-abc
+export DINGUS_MODEL = gpt-4o
+OPENAI_BASE_URL="http://localhost:8080/v1"
+QUOTED='a # b'
+TRAILING=value # comment
+EMPTY=
+not a setting
+=missing key
+`
+	want := map[string]string{
+		"OPENAI_API_KEY":  "sk-abc",
+		"DINGUS_MODEL":    "gpt-4o",
+		"OPENAI_BASE_URL": "http://localhost:8080/v1",
+		"QUOTED":          "a # b",
+		"TRAILING":        "value",
+		"EMPTY":           "",
+	}
+	if got := parseDotEnv(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDotEnv = %v, want %v", got, want)
+	}
+}
+
+func TestDotEnvPrecedence(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"model": "gpt-4o"}`)
+	write := func(path, data string) {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	model := func() interface{} {
+		e.run("n\n", "list files")
+		return e.api.requests[len(e.api.requests)-1]["model"]
+	}
+
+	write(e.configPath(".env"), "DINGUS_MODEL=gpt-4.1\n")
+	if got := model(); got != "gpt-4.1" {
+		t.Errorf("model = %v, want the home .env over config.json", got)
+	}
+	projectEnv := filepath.Join(e.dir, ".env")
+	write(projectEnv, "DINGUS_MODEL=gpt-4.1-mini\n")
+	if got := model(); got != "gpt-4.1-mini" {
+		t.Errorf("model = %v, want the project .env over the home one", got)
+	}
+	e.env["DINGUS_MODEL"] = "o4-mini"
+	if got := model(); got != "o4-mini" {
+		t.Errorf("model = %v, want the environment over .env files", got)
+	}
+}
+
+func TestDotEnvKey(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.env["OPENAI_API_KEY"] = ""
+	if err := os.WriteFile(filepath.Join(e.dir, ".env"), []byte("OPENAI_API_KEY=sk-dotenv\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	e.run("n\n", "list files")
+	if len(e.api.keys) != 1 || e.api.keys[0] != "sk-dotenv" {
+		t.Errorf("keys sent = %q, want the .env key", e.api.keys)
+	}
+}
+
+func TestDotEnvBaseURLNeedsKey(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	serverURL := e.env["OPENAI_BASE_URL"]
+	e.env["OPENAI_BASE_URL"], e.env["OPENAI_API_KEY"] = "", ""
+	e.writeConfig(`{"keys": {"openai": "sk-config"}}`)
+	write := func(path, data string) {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(e.configPath(".env"), "OPENAI_BASE_URL="+serverURL+"\n")
+	projectEnv := filepath.Join(e.dir, ".env")
+
+	// The config key must not go to a server named by a project .env
+	write(projectEnv, "OPENAI_BASE_URL=http://127.0.0.1:1/v1\n")
+	result := e.run("n\n", "list files")
+	if len(e.api.keys) != 1 || e.api.keys[0] != "sk-config" {
+		t.Fatalf("keys sent = %q, want the config key sent to the home .env URL:\n%s", e.api.keys, result.stderr)
+	}
+	assertContains(t, result.stderr, "ignoring OPENAI_BASE_URL=http://127.0.0.1:1/v1 from ./.env")
+
+	// A project .env that brings its own key may choose its endpoint
+	write(projectEnv, "OPENAI_API_KEY=sk-project\nOPENAI_BASE_URL="+serverURL+"\n")
+	write(e.configPath(".env"), "OPENAI_BASE_URL=http://127.0.0.1:1/v1\n")
+	result = e.run("n\n", "list files")
+	if len(e.api.keys) != 2 || e.api.keys[1] != "sk-project" {
+		t.Errorf("keys sent = %q, want the project key sent to the project URL:\n%s", e.api.keys, result.stderr)
+	}
+	assertNotContains(t, result.stderr, "ignoring OPENAI_BASE_URL")
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestDroppedConnectionRetried(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.api.drops = 1
+	result := e.run("n\n", "list files")
+	if result.code != exitDeclined {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stderr, "Connection dropped, retrying (1/2)...")
+	assertContains(t, result.stdout, "Suggested command: ls")
+	if len(e.api.requests) != 2 {
+		t.Errorf("made %d API requests, want one retry", len(e.api.requests))
+	}
+}
+
+func TestDroppedConnectionError(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"retries": 0}`)
+	e.api.drops = 1
+	result := e.run("n\n", "list files")
+	if result.code != exitAPI {
+		t.Errorf("exit code = %d, want %d", result.code, exitAPI)
+	}
+	assertContains(t, result.stderr, "connection dropped before the response was complete", "please retry")
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestEmptyQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+		sent int
+	}{
+		{"empty string", []string{""}, exitUsage, 0},
+		{"whitespace", []string{"   ", "\t"}, exitUsage, 0},
+		{"valid query", []string{"  list files "}, exitDeclined, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, "ls")
+			result := e.run("n\n", tt.args...)
+			if result.code != tt.code {
+				t.Errorf("exit code = %d, want %d", result.code, tt.code)
+			}
+			if len(e.api.requests) != tt.sent {
+				t.Errorf("made %d API requests, want %d", len(e.api.requests), tt.sent)
+			}
+			if tt.sent == 0 {
+				assertContains(t, result.stdout, "Usage")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestEvalPrintsOnlyTheCommand(t *testing.T) {
+	e := newTestEnv(t, "ls -la")
+	result := e.run("", "--eval", "list files")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	if result.stdout != "ls -la\n" {
+		t.Errorf("stdout = %q, want only the command", result.stdout)
+	}
+	assertContains(t, result.stderr, "Query cost:")
+	if entries := e.readHistory(); len(entries) != 1 || entries[0].Command != "ls -la" {
+		t.Errorf("history = %+v, want the printed command", entries)
+	}
+}
+
+func TestEvalConfirmsDestructive(t *testing.T) {
+	tests := []struct {
+		input  string
+		code   int
+		stdout string
+	}{
+		{"no\n", exitDeclined, ""},
+		{"yes\n", exitOK, "rm -rf build\n"},
+	}
+	for _, tt := range tests {
+		result := newTestEnv(t, "rm -rf build").run(tt.input, "--eval", "delete the build output")
+		if result.code != tt.code || result.stdout != tt.stdout {
+			t.Errorf("answering %q: exit code %d, stdout %q, want %d, %q", tt.input, result.code, result.stdout, tt.code, tt.stdout)
+		}
+		assertContains(t, result.stderr, "This command looks destructive.")
+	}
+}
+
+func TestEvalConfirmsRisky(t *testing.T) {
+	e := newTestEnv(t, "chmod 777 /srv")
+	e.api.risk = "dangerous"
+	result := e.run("n\n", "--eval", "open up /srv")
+	if result.code != exitDeclined || result.stdout != "" {
+		t.Errorf("exit code %d, stdout %q, want the command withheld", result.code, result.stdout)
+	}
+	assertContains(t, result.stderr, "Suggested command: chmod 777 /srv", "Command not executed.")
+}
+
+func TestCompletionDefinesEvalFunction(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh"} {
+		result := newTestEnv(t).run("", "completion", shell)
+		if result.code != exitOK {
+			t.Errorf("%s: exit code = %d", shell, result.code)
+		}
+		assertContains(t, result.stdout, "dingus-eval() {", `dingus-copilot --eval "$@"`)
+	}
+	if result := newTestEnv(t).run("", "completion", "fish"); result.code != exitUsage {
+		t.Errorf("fish: exit code = %d, want %d", result.code, exitUsage)
+	}
+
+	e := newTestEnv(t, "git completion")
+	e.run("n\n", "completion", "script", "for", "git")
+	if len(e.api.requests) != 1 {
+		t.Errorf("made %d API requests, want the query sent", len(e.api.requests))
+	}
+}
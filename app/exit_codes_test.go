@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		setup func(e *testEnv)
+		input string
+		args  []string
+		want  int
+	}{
+		{"command succeeds", "true", nil, "y\n", []string{"succeed"}, exitOK},
+		{"command's own code", "exit 7", nil, "y\n", []string{"fail with seven"}, 7},
+		{"unknown flag", "ls", nil, "", []string{"--no-such-flag", "list files"}, exitUsage},
+		{"rejected key", "ls", func(e *testEnv) { e.api.badKey = e.env["OPENAI_API_KEY"] }, "", []string{"list files"}, exitAPI},
+		{"broken config", "ls", func(e *testEnv) { e.writeConfig("{") }, "", []string{"list files"}, exitConfig},
+		{"declined", "ls", nil, "n\n", []string{"list files"}, exitDeclined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, tt.reply)
+			if tt.setup != nil {
+				tt.setup(e)
+			}
+			if result := e.run(tt.input, tt.args...); result.code != tt.want {
+				t.Errorf("exit code = %d, want %d:\n%s", result.code, tt.want, result.stderr)
+			}
+		})
+	}
+}
+
+func TestExitCodesInHelp(t *testing.T) {
+	result := newTestEnv(t).run("", "--help")
+	for _, e := range exitCodeHelp {
+		assertContains(t, result.stdout, fmt.Sprintf("%-36d %s", e.Code, e.Description))
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestExpandQueryEnv(t *testing.T) {
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+	options.RedactEnv = []string{"INTERNAL_HOST"}
+	env := map[string]string{"LOG_DIR": "/var/log/app", "GITHUB_TOKEN": "ghp_secret", "INTERNAL_HOST": "db.corp", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"list $LOG_DIR", "list /var/log/app"},
+		{"tail ${LOG_DIR}/error.log", "tail /var/log/app/error.log"},
+		{"push with $GITHUB_TOKEN", "push with $GITHUB_TOKEN"},
+		{"ping $INTERNAL_HOST", "ping $INTERNAL_HOST"},
+		{"print $UNSET and [$EMPTY]", "print $UNSET and []"},
+	}
+	for _, tt := range tests {
+		if got := expandQueryEnv(tt.query, lookup); got != tt.want {
+			t.Errorf("expandQueryEnv(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestExpandEnvFlag(t *testing.T) {
+	t.Setenv("DEPLOY_DIR", "/srv/releases")
+	t.Setenv("DB_PASSWORD", "hunter22")
+	t.Setenv("BUILD_HOST", "build-7.corp")
+	query := "list $DEPLOY_DIR on $BUILD_HOST using $DB_PASSWORD"
+
+	e := newTestEnv(t, "ls")
+	e.run("n\n", query)
+	assertContains(t, e.api.prompts()[0], query)
+
+	e = newTestEnv(t, "ls")
+	e.writeConfig(`{"redact_env": ["BUILD_HOST"]}`)
+	e.run("y\n", "--expand-env", query)
+	prompt := e.api.prompts()[0]
+	assertContains(t, prompt, "list /srv/releases on $BUILD_HOST using $DB_PASSWORD")
+	assertNotContains(t, prompt, "hunter22", "build-7.corp")
+	if entries := e.readHistory(); len(entries) != 1 || entries[0].Query != query {
+		t.Errorf("history = %+v, want the query as typed", entries)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+var exportEntries = []aid.HistoryEntry{
+	{Query: "list files\nby size", Command: "ls -S"},
+	{Command: "echo '```'"},
+}
+
+func TestExportHistoryShell(t *testing.T) {
+	got, err := exportHistory(exportEntries, "sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "#!/usr/bin/env bash\n# Commands exported from dingus-copilot history\n\n# list files by size\nls -S\n\necho '```'\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExportHistoryMarkdown(t *testing.T) {
+	got, err := exportHistory(exportEntries, "md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# dingus-copilot history\n\n## list files by size\n\n```bash\nls -S\n```\n\n## (no query recorded)\n\n````bash\necho '```'\n````\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExportHistoryUnknownFormat(t *testing.T) {
+	if _, err := exportHistory(exportEntries, "csv"); err == nil {
+		t.Error("exporting as csv succeeded")
+	}
+}
+
+func TestExportSubcommand(t *testing.T) {
+	e := newTestEnv(t)
+	e.writeHistory(exportEntries...)
+	result := e.run("", "export", "--format", "md", "-o", "out.md")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, "Exported 2 commands to out.md")
+	data, err := os.ReadFile(filepath.Join(e.dir, "out.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, string(data), "## list files by size")
+
+	result = e.run("", "export")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	info, err := os.Stat(filepath.Join(e.dir, "dingus-copilot-history.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0755 {
+		t.Errorf("script mode = %v, want it executable", info.Mode().Perm())
+	}
+}
+
+func TestExportEmptyHistory(t *testing.T) {
+	result := newTestEnv(t).run("", "export")
+	if result.code != exitFailure {
+		t.Errorf("exit code = %d, want %d", result.code, exitFailure)
+	}
+	assertContains(t, result.stderr, "no history to export")
+}
+
+func TestExportWithWordsIsAQuery(t *testing.T) {
+	e := newTestEnv(t, `export PATH="$HOME/bin:$PATH"`)
+	e.writeHistory(exportEntries...)
+	result := e.run("n\n", "export", "PATH", "to", "include", "~/bin")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want the words sent as a query\n%s", len(e.api.requests), result.stdout)
+	}
+	assertContains(t, e.api.prompts()[0], "export PATH to include ~/bin")
+	if _, err := os.Stat(filepath.Join(e.dir, "dingus-copilot-history.sh")); !os.IsNotExist(err) {
+		t.Errorf("history was exported (%v)", err)
+	}
+}
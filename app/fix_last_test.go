@@ -0,0 +1,102 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestLastShellCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantStatus int
+		wantErr    string
+	}{
+		{"recorded", map[string]string{"DINGUS_LAST_COMMAND": " gti status ", "DINGUS_LAST_STATUS": "127"}, 127, ""},
+		{"no hook", map[string]string{}, 0, "no command has been recorded"},
+		{"bad status", map[string]string{"DINGUS_LAST_COMMAND": "gti status", "DINGUS_LAST_STATUS": "oops"}, 0, `invalid DINGUS_LAST_STATUS "oops"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, status, err := lastShellCommand(func(name string) string { return tt.env[name] })
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatal("err = nil")
+				}
+				assertContains(t, err.Error(), tt.wantErr)
+				return
+			}
+			if err != nil || command != "gti status" || status != tt.wantStatus {
+				t.Errorf("lastShellCommand = %q, %d, %v", command, status, err)
+			}
+		})
+	}
+}
+
+func TestFixLast(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	e := newTestEnv(t, "echo fixed-$((1+1))")
+	e.env["DINGUS_LAST_COMMAND"] = "gti status"
+	e.env["DINGUS_LAST_STATUS"] = "127"
+	result := e.run("y\n", "fix")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+	}
+	assertContains(t, result.stdout, "Last command (exit status 127): gti status", "Suggested fix: echo fixed-$((1+1))", "fixed-2\n")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want one fix", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[0], "gti status", "exit status 127")
+	// The fix is asked for as a suggest_command reply so it comes with a risk rating
+	if _, ok := e.api.requests[0]["response_format"]; !ok {
+		t.Error("fix request did not ask for a suggest_command reply")
+	}
+}
+
+func TestFixLastRisky(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	e := newTestEnv(t, "echo fixed-$((1+1))")
+	e.api.risk = aid.RiskDangerous
+	e.env["DINGUS_LAST_COMMAND"] = "gti status"
+	e.env["DINGUS_LAST_STATUS"] = "1"
+	result := e.run("y\ny\n", "fix")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+	}
+	assertNotContains(t, result.stdout, "fixed-2\n")
+}
+
+func TestFixLastNothingToFix(t *testing.T) {
+	e := newTestEnv(t, "true")
+	e.env["DINGUS_LAST_COMMAND"] = "make"
+	e.env["DINGUS_LAST_STATUS"] = "0"
+	result := e.run("", "fix")
+	assertContains(t, result.stdout, "The last command succeeded, so there is nothing to fix: make")
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests", len(e.api.requests))
+	}
+
+	e = newTestEnv(t, "true")
+	result = e.run("", "fix")
+	if result.code != exitUsage {
+		t.Errorf("exit code = %d, want %d", result.code, exitUsage)
+	}
+	assertContains(t, result.stderr, "dingus-copilot completion bash")
+}
+
+func TestFixQuery(t *testing.T) {
+	e := newTestEnv(t, "chmod 700 ~/.ssh")
+	e.env["DINGUS_LAST_COMMAND"] = "gti status"
+	e.env["DINGUS_LAST_STATUS"] = "127"
+	result := e.run("n\n", "fix permissions on ~/.ssh")
+	assertContains(t, result.stdout, "Suggested command: chmod 700 ~/.ssh")
+	assertNotContains(t, result.stdout, "Last command")
+	assertContains(t, e.api.prompts()[0], "fix permissions on ~/.ssh")
+	assertNotContains(t, e.api.prompts()[0], "gti status")
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestFlagsBeforeQuery(t *testing.T) {
+	e := newTestEnv(t, "find . -name foo")
+	result := e.run("n\n", "--model", "gpt-4o", "find -name foo")
+	if result.code != exitDeclined {
+		t.Fatalf("exit code = %d, want %d:\n%s", result.code, exitDeclined, result.stderr)
+	}
+	if model := e.api.requests[0]["model"]; model != "gpt-4o" {
+		t.Errorf("model = %v, want gpt-4o", model)
+	}
+	assertContains(t, e.api.prompts()[0], "find -name foo")
+	assertNotContains(t, e.api.prompts()[0], "--model")
+}
+
+func TestQueryAfterDashes(t *testing.T) {
+	e := newTestEnv(t, "echo done")
+	result := e.run("n\n", "--", "-rf", "explain what this flag means")
+	if result.code != exitDeclined {
+		t.Fatalf("exit code = %d, want %d:\n%s", result.code, exitDeclined, result.stderr)
+	}
+	assertContains(t, e.api.prompts()[0], "-rf explain what this flag means")
+}
+
+func TestUnknownFlag(t *testing.T) {
+	e := newTestEnv(t)
+	result := e.run("", "-rf", "list files")
+	if result.code != exitUsage {
+		t.Errorf("exit code = %d, want %d", result.code, exitUsage)
+	}
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests, want none", len(e.api.requests))
+	}
+}
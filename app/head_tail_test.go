@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHeadLimitsShownAndStoredOutput(t *testing.T) {
+	e := newTestEnv(t, "seq 1 100")
+	outputFile := filepath.Join(t.TempDir(), "out.txt")
+	result := e.run("y\n", "--head", "3", "--output-file", outputFile, "count to 100")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, "1\n2\n3\n... 97 lines omitted ...\n")
+	assertNotContains(t, result.stdout, "\n4\n", "\n100\n")
+
+	history := e.readHistory()
+	if len(history) != 1 || !strings.HasPrefix(history[0].Output, "1\n2\n3\n... 97 lines omitted") {
+		t.Errorf("history = %+v, want only the first 3 lines stored", history)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "\n"); got != 100 {
+		t.Errorf("output file has %d lines, want all 100", got)
+	}
+	info, err := os.Stat(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("output file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestTailLimitsOutput(t *testing.T) {
+	e := newTestEnv(t, "seq 1 100")
+	result := e.run("y\n", "--tail", "2", "count to 100")
+	assertContains(t, result.stdout, "... 98 lines omitted ...\n99\n100\n")
+}
+
+func TestHeadRejectsNegative(t *testing.T) {
+	result := newTestEnv(t, "seq 1 100").run("", "--head", "-1", "count to 100")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, "--head and --tail must not be negative")
+}
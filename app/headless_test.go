@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestClipboardAvailable(t *testing.T) {
+	stubLookPath(t, "xclip", "pbcopy")
+	tests := []struct {
+		goos string
+		env  map[string]string
+		want bool
+	}{
+		{"linux", map[string]string{}, false},
+		{"linux", map[string]string{"DISPLAY": ":0"}, true},
+		{"linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, true},
+		{"darwin", map[string]string{}, true},
+		{"windows", map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		getenv := func(key string) string { return tt.env[key] }
+		if got := clipboardAvailable(tt.goos, getenv); got != tt.want {
+			t.Errorf("clipboardAvailable(%s, %v) = %v, want %v", tt.goos, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestCopyHeadless(t *testing.T) {
+	stubLookPath(t)
+	e := newTestEnv(t, "ls -la")
+	e.env["DISPLAY"] = ""
+	e.env["WAYLAND_DISPLAY"] = ""
+	e.env["TERM"] = "dumb"
+	result := e.run("c\n", "list files")
+	assertContains(t, result.stdout,
+		"Could not copy the command ("+errNoClipboard.Error()+"); copy it from here instead:",
+		"copy-me: ls -la\n")
+	assertNotContains(t, result.stdout, "Command copied to clipboard!")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestHelpMentionsEveryFlag(t *testing.T) {
+	for _, args := range [][]string{{"--help"}, {"help"}} {
+		result := newTestEnv(t).run("", args...)
+		if result.code != exitOK {
+			t.Errorf("%s: exit code = %d, want %d", args[0], result.code, exitOK)
+		}
+		newFlagSet().VisitAll(func(f *flag.Flag) {
+			assertContains(t, result.stdout, "--"+f.Name)
+		})
+		for _, sub := range subcommands {
+			assertContains(t, result.stdout, sub.Usage)
+		}
+		for _, example := range helpExamples {
+			assertContains(t, result.stdout, example)
+		}
+	}
+}
+
+func TestNoQueryShowsHelp(t *testing.T) {
+	result := newTestEnv(t).run("")
+	if result.code != exitUsage {
+		t.Errorf("exit code = %d, want %d", result.code, exitUsage)
+	}
+	assertContains(t, result.stdout, "--model")
+}
+
+func TestHelpQueryIsSentToTheModel(t *testing.T) {
+	e := newTestEnv(t, "du -ah . | sort -rh | head")
+	result := e.run("n\n", "help", "me", "find", "large", "files")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want the query sent", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[0], "help me find large files")
+	assertNotContains(t, result.stdout, "--model")
+}
+
+func TestCleanupQueryIsSentToTheModel(t *testing.T) {
+	e := newTestEnv(t, "docker image prune -a")
+	e.writeConfig(`{"model": "gpt-4o"}`)
+	e.run("n\n", "cleanup", "old", "docker", "images")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want the query sent", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[0], "cleanup old docker images")
+	if _, err := os.Stat(e.configPath("config.json")); err != nil {
+		t.Errorf("config after the query: %v, want it kept", err)
+	}
+
+	result := e.run("", "cleanup")
+	assertContains(t, result.stdout, "Configuration files removed successfully!")
+	if _, err := os.Stat(e.configPath("")); !os.IsNotExist(err) {
+		t.Errorf("config directory after cleanup: %v, want it removed", err)
+	}
+}
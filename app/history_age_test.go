@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestHistoryMaxAge(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	e := newTestEnv(t, "true", "ls")
+	e.writeConfig(`{"history_max_age_minutes": 30}`)
+	now := time.Now()
+	e.writeHistory(
+		aid.HistoryEntry{Command: "make old-target", Time: now.Add(-2 * time.Hour)},
+		aid.HistoryEntry{Command: "make recent-target", Time: now.Add(-5 * time.Minute)},
+	)
+
+	// Running a command rewrites history, which must keep the old entry
+	e.run("y\n", "do nothing")
+	e.run("n\n", "list files")
+	for _, prompt := range e.api.prompts() {
+		assertContains(t, prompt, "make recent-target")
+		assertNotContains(t, prompt, "make old-target")
+	}
+	if entries := e.readHistory(); len(entries) != 3 || entries[0].Command != "make old-target" {
+		t.Errorf("history = %+v, want the old entry kept on disk", entries)
+	}
+}
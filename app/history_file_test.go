@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestHistoryFileOverride(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	for _, viaEnv := range []bool{false, true} {
+		e := newTestEnv(t, "echo hi")
+		path := filepath.Join(e.dir, "pane", "history.json")
+		args := []string{"--history-file", path, "say hi"}
+		if viaEnv {
+			e.env["DINGUS_HISTORY_FILE"] = path
+			args = args[2:]
+		}
+
+		// The file and its directory are created on first use
+		if result := e.run("y\n", args...); result.code != exitOK {
+			t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+		}
+		e.run("n\n", args...)
+		assertContains(t, e.api.prompts()[1], "COMMAND 1: echo hi")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entries []aid.HistoryEntry
+		if err := json.Unmarshal(data, &entries); err != nil || len(entries) != 1 {
+			t.Errorf("override history = %s (%v), want one entry", data, err)
+		}
+		if entries := e.readHistory(); len(entries) != 0 {
+			t.Errorf("default history = %+v, want it unused", entries)
+		}
+	}
+}
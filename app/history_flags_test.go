@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestNoHistory(t *testing.T) {
+	e := newTestEnv(t, "echo secret")
+	e.writeHistory(aid.HistoryEntry{Command: "pwd", Output: "/home"})
+	result := e.run("y\n", "--no-history", "print the secret")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	if got := len(e.readHistory()); got != 1 {
+		t.Errorf("history has %d entries, want it left at 1", got)
+	}
+	// Existing history is still sent as context
+	assertContains(t, e.api.prompts()[0], "COMMAND 1: pwd")
+
+	e.run("y\n", "print the secret")
+	if got := len(e.readHistory()); got != 2 {
+		t.Errorf("history has %d entries, want a normal run to add one", got)
+	}
+}
+
+func TestFresh(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeHistory(aid.HistoryEntry{Command: "cd /srv/app", Output: ""})
+	e.run("n\n", "--fresh", "list files")
+	assertNotContains(t, e.api.prompts()[0], "Recent command history", "cd /srv/app")
+
+	e.run("n\n", "list files")
+	assertContains(t, e.api.prompts()[1], "Recent command history", "COMMAND 1: cd /srv/app")
+}
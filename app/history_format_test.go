@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestHistoryFormatConfig(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"", "COMMAND 1: pwd\nOUTPUT 1: /home/me"},
+		{aid.HistoryFormatVerbose, "COMMAND 1: pwd\nOUTPUT 1: /home/me"},
+		{aid.HistoryFormatCompact, "$ pwd\n/home/me"},
+		{aid.HistoryFormatChat, "User: where am I\nAssistant: pwd\nOutput: /home/me"},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "ls")
+		e.writeConfig(`{"history_format": "` + tt.format + `"}`)
+		e.writeHistory(aid.HistoryEntry{Query: "where am I", Command: "pwd", Output: "/home/me"})
+		e.run("n\n", "list files")
+		if len(e.api.requests) != 1 {
+			t.Fatalf("%q: made %d API requests", tt.format, len(e.api.requests))
+		}
+		assertContains(t, e.api.prompts()[0], tt.want)
+	}
+}
+
+func TestUnknownHistoryFormat(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"history_format": "xml"}`)
+	result := e.run("n\n", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, `unknown history_format "xml"`)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+var pickerHistory = []aid.HistoryEntry{
+	{Query: "say first", Command: "echo first"},
+	{Query: "say second", Command: "echo second", Pinned: true},
+}
+
+func TestHistoryLabel(t *testing.T) {
+	tests := []struct {
+		entry aid.HistoryEntry
+		want  string
+	}{
+		{aid.HistoryEntry{Command: "ls"}, "ls"},
+		{aid.HistoryEntry{Query: "list\nfiles", Command: "ls  -la"}, "ls -la  # list files"},
+		{aid.HistoryEntry{Command: "pwd", Pinned: true}, "[pinned] pwd"},
+	}
+	for _, tt := range tests {
+		if got := historyLabel(tt.entry); got != tt.want {
+			t.Errorf("historyLabel(%+v) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
+
+// Run f with stdout sent to a file, returning what it printed
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdout")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = saved }()
+	f()
+	file.Close()
+	data, _ := os.ReadFile(path)
+	return string(data)
+}
+
+func TestActOnHistory(t *testing.T) {
+	stubLookPath(t)
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("TERM", "dumb")
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+
+	var offered []aid.HistoryEntry
+	selector := func(entries []aid.HistoryEntry) (int, error) {
+		offered = entries
+		return 1, nil
+	}
+	var code int
+	var err error
+	out := captureStdout(t, func() {
+		code, err = actOnHistory(pickerHistory, selector, bufio.NewReader(strings.NewReader("c\n")))
+	})
+	if err != nil || code != exitOK {
+		t.Errorf("actOnHistory = %d, %v, want %d", code, err, exitOK)
+	}
+	if !reflect.DeepEqual(offered, pickerHistory) {
+		t.Errorf("selector was offered %+v", offered)
+	}
+	assertContains(t, out, "echo second", "'p' to unpin", "copy-me: echo second")
+}
+
+func TestActOnHistoryNothingPicked(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector historySelector
+		want     int
+	}{
+		{"cancelled", func([]aid.HistoryEntry) (int, error) { return -1, nil }, exitDeclined},
+		{"failed", func([]aid.HistoryEntry) (int, error) { return -1, errors.New("broken") }, exitUsage},
+	}
+	for _, tt := range tests {
+		var code int
+		out := captureStdout(t, func() {
+			code, _ = actOnHistory(pickerHistory, tt.selector, bufio.NewReader(strings.NewReader("y\n")))
+		})
+		if code != tt.want {
+			t.Errorf("%s: exit code = %d, want %d", tt.name, code, tt.want)
+		}
+		assertNotContains(t, out, "Run it again?")
+	}
+}
+
+func TestHistoryNumbered(t *testing.T) {
+	e := newTestEnv(t)
+	e.writeHistory(pickerHistory...)
+	result := e.run("1\ny\n", "history")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout,
+		"  1  echo first  # say first\n",
+		"  2  [pinned] echo second  # say second\n",
+		"Run it again? (y/n/c/p - 'c' to copy, 'p' to pin)",
+		"first\n")
+	if entries := e.readHistory(); len(entries) != 3 || entries[2].Command != "echo first" {
+		t.Errorf("history = %+v, want the rerun recorded", entries)
+	}
+}
+
+func TestHistoryFzfFallback(t *testing.T) {
+	stubLookPath(t)
+	e := newTestEnv(t)
+	e.writeHistory(pickerHistory...)
+	result := e.run("\n", "history", "--fzf")
+	assertContains(t, result.stdout, "fzf was not found; showing a numbered list instead.", "  1  echo first")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d after cancelling", result.code, exitDeclined)
+	}
+}
+
+func TestHistoryFzf(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake fzf is a shell script")
+	}
+	// Stands in for fzf, picking the entry with index 1
+	fzf := filepath.Join(t.TempDir(), "fzf")
+	if err := os.WriteFile(fzf, []byte("#!/bin/sh\ngrep '^1\t'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	saved := lookPath
+	t.Cleanup(func() { lookPath = saved })
+	lookPath = func(file string) (string, error) { return fzf, nil }
+
+	e := newTestEnv(t)
+	e.writeHistory(pickerHistory...)
+	result := e.run("p\n", "history", "--fzf")
+	assertContains(t, result.stdout, "Command: echo second", "Unpinned: echo second")
+	assertNotContains(t, result.stdout, "Entry number")
+	if entries := e.readHistory(); len(entries) != 2 || entries[1].Pinned {
+		t.Errorf("history = %+v, want the second entry unpinned", entries)
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	e := newTestEnv(t, "man history")
+	e.run("n\n", "history", "of", "the", "unix", "shell")
+	if prompts := e.api.prompts(); len(prompts) != 1 || !strings.Contains(prompts[0], "history of the unix shell") {
+		t.Errorf("prompts = %q, want the words sent as a query", prompts)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestInlineModel(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantModel string
+		wantRest  []string
+	}{
+		{[]string{"@gpt-4o", "complex", "task"}, "gpt-4o", []string{"complex", "task"}},
+		{[]string{"@gpt-4o complex task"}, "gpt-4o", []string{"complex task"}},
+		{[]string{"list", "@files"}, "", []string{"list", "@files"}},
+		{[]string{"@", "list files"}, "", []string{"@", "list files"}},
+		{nil, "", nil},
+	}
+	for _, tt := range tests {
+		model, rest := inlineModel(tt.args)
+		if model != tt.wantModel || !reflect.DeepEqual(rest, tt.wantRest) {
+			t.Errorf("inlineModel(%q) = %q, %q, want %q, %q", tt.args, model, rest, tt.wantModel, tt.wantRest)
+		}
+	}
+}
+
+func TestInlineModelQuery(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "@gpt-4o", "list files")
+	if got := e.api.requests[0]["model"]; got != "gpt-4o" {
+		t.Errorf("model = %v, want gpt-4o", got)
+	}
+	assertContains(t, e.api.prompts()[0], "list files")
+	assertNotContains(t, e.api.prompts()[0], "@gpt-4o")
+
+	// The next query goes back to the configured model
+	e.run("n\n", "list files")
+	if got := e.api.requests[1]["model"]; got != aid.DefaultModel {
+		t.Errorf("model = %v, want %s", got, aid.DefaultModel)
+	}
+}
+
+func TestInlineModelAfterDashes(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "--", "@gpt-4o", "mention in a commit message")
+	if got := e.api.requests[0]["model"]; got != aid.DefaultModel {
+		t.Errorf("model = %v, want %s", got, aid.DefaultModel)
+	}
+	assertContains(t, e.api.prompts()[0], "@gpt-4o mention in a commit message")
+}
+
+func TestInlineModelUnknown(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	result := e.run("n\n", "@gpt-9000", "list files")
+	if result.code != exitUsage {
+		t.Errorf("exit code = %d, want %d", result.code, exitUsage)
+	}
+	assertContains(t, result.stderr, `unknown model "gpt-9000" for OpenAI`)
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests for an unknown model", len(e.api.requests))
+	}
+}
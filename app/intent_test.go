@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestIsQuestion(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"what does chmod 755 mean?", true},
+		{"What is a symlink", true},
+		{"explain the difference between tar and zip", true},
+		{"why is my disk full", true},
+		{"how do I find large files", false},
+		{"how to list open ports", false},
+		{"find files modified today", false},
+		{"whatever happened to ls", false},
+	}
+	for _, tt := range tests {
+		if got := isQuestion(tt.query); got != tt.want {
+			t.Errorf("isQuestion(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQuestionIsAnswered(t *testing.T) {
+	e := newTestEnv(t, "It gives the owner full access and everyone else read and execute.")
+	result := e.run("", "what does chmod 755 mean?")
+	if result.code != exitOK {
+		t.Errorf("exit code = %d, want %d", result.code, exitOK)
+	}
+	if _, structured := e.api.requests[0]["response_format"]; structured {
+		t.Error("a question asked for a command")
+	}
+	assertContains(t, result.stdout, "It gives the owner full access")
+	assertNotContains(t, result.stdout, "Suggested command:", "Do you want to run")
+}
+
+func TestCommandRequestIsSuggested(t *testing.T) {
+	e := newTestEnv(t, "find . -size +100M")
+	result := e.run("n\n", "how do I find large files")
+	if _, structured := e.api.requests[0]["response_format"]; !structured {
+		t.Error("a command request did not ask for a command")
+	}
+	assertContains(t, result.stdout, "Suggested command:", "find . -size +100M")
+}
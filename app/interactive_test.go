@@ -0,0 +1,58 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestIsInteractive(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"top", true},
+		{"sudo vim /etc/hosts", true},
+		{"git log | less", true},
+		{"ssh host uptime", true},
+		{"ls -la", false},
+		{"echo vim", false},
+	}
+	for _, tt := range tests {
+		if got := isInteractive(tt.command); got != tt.want {
+			t.Errorf("isInteractive(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestInteractiveCommandsConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	tests := []struct {
+		command  string
+		attached bool
+	}{
+		{"printf 'attached\n'", true},
+		{"echo captured", false},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, tt.command)
+		e.writeConfig(`{"interactive_commands": ["printf"]}`)
+		result := e.run("y\n", "print something")
+		if result.code != exitOK {
+			t.Fatalf("%s: exit code = %d:\n%s", tt.command, result.code, result.stderr)
+		}
+
+		// Attached commands write to the terminal directly and are not recorded
+		entries := e.readHistory()
+		if tt.attached {
+			assertContains(t, result.stdout, "attached\n")
+			if len(entries) != 0 {
+				t.Errorf("%s: history = %+v, want nothing captured", tt.command, entries)
+			}
+		} else if len(entries) != 1 || strings.TrimSpace(entries[0].Output) != "captured" {
+			t.Errorf("%s: history = %+v, want the output captured", tt.command, entries)
+		}
+	}
+}
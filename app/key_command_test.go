@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Write a credential helper script printing output, counting its runs in
+// a file next to it
+func writeKeyCommand(t *testing.T, output string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := filepath.Join(dir, "get-key")
+	content := "#!/bin/sh\necho run >> " + runs + "\nprintf '%s\\n' '" + output + "'\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script, runs
+}
+
+func TestKeyPattern(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"sk-proj-0123456789abcdef", true},
+		{"eyJhbGciOiJIUzI1NiJ9.e30.sig", true},
+		{"short-key", false},
+		{"error: not logged in to the vault", false},
+		{"sk-0123456789abcdef\nsk-0123456789abcdef", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := keyPattern.MatchString(tt.key); got != tt.want {
+			t.Errorf("keyPattern.MatchString(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestKeyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	const key = "sk-fresh-0123456789abcdef"
+	script, runs := writeKeyCommand(t, key)
+	// A failing command and its fix make two calls in one run
+	e := newTestEnv(t, "exit 1", "true")
+	e.env["OPENAI_API_KEY"] = ""
+	e.writeConfig(`{"key_command": "` + script + `"}`)
+
+	result := e.run("y\ny\n", "--auto-fix", "check it")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+	}
+	assertNotContains(t, result.stdout, "Enter your OpenAI API Key")
+	if len(e.api.keys) != 2 {
+		t.Fatalf("made %d API requests, want a suggestion and a fix", len(e.api.keys))
+	}
+	for _, sent := range e.api.keys {
+		if sent != key {
+			t.Errorf("sent key %q, want %q", sent, key)
+		}
+	}
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(data) / len("run\n"); got != len(e.api.keys) {
+		t.Errorf("key_command ran %d times for %d requests, want once for each", got, len(e.api.keys))
+	}
+	config, err := os.ReadFile(e.configPath("config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNotContains(t, string(config), key)
+}
+
+func TestKeyCommandInvalidKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	const output = "error: vault session expired"
+	script, _ := writeKeyCommand(t, output)
+	e := newTestEnv(t, "ls")
+	e.env["OPENAI_API_KEY"] = ""
+	e.writeConfig(`{"key_command": "` + script + `"}`)
+
+	result := e.run("n\n", "list files")
+	if result.code != exitAPI {
+		t.Errorf("exit code = %d, want %d", result.code, exitAPI)
+	}
+	assertContains(t, result.stderr, "key_command output does not look like an API key")
+	assertNotContains(t, result.stderr, output)
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests without a valid key", len(e.api.requests))
+	}
+}
+
+func TestKeyCommandEnvironmentFirst(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	script, runs := writeKeyCommand(t, "sk-fresh-0123456789abcdef")
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"key_command": "` + script + `"}`)
+	e.run("n\n", "list files")
+	if len(e.api.keys) != 1 || e.api.keys[0] != e.env["OPENAI_API_KEY"] {
+		t.Errorf("sent keys %q, want the environment's", e.api.keys)
+	}
+	if _, err := os.Stat(runs); err == nil {
+		t.Error("key_command ran though OPENAI_API_KEY was set")
+	}
+}
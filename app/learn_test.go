@@ -0,0 +1,43 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLearnQuiz(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	e := newTestEnv(t, "echo hello", "Prints hello to standard output.")
+	result := e.run("prints a greeting\ny\n", "--learn", "greet me")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want a suggestion and an explanation", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[1], "echo hello")
+
+	// The guess is asked for before the explanation is revealed, and the
+	// command can still be run afterwards
+	out := result.stdout
+	quiz := strings.Index(out, "What do you think this command does?")
+	reveal := strings.Index(out, "Prints hello to standard output.")
+	run := strings.Index(out, "Do you want to run this command?")
+	if quiz < 0 || reveal < quiz || run < reveal {
+		t.Errorf("want the quiz, then the reveal, then the run prompt:\n%s", out)
+	}
+	assertContains(t, out, "Your answer: prints a greeting", "hello\n")
+	if entries := e.readHistory(); len(entries) != 1 {
+		t.Errorf("history = %+v, want the command run", entries)
+	}
+}
+
+func TestLearnQuizSkipped(t *testing.T) {
+	e := newTestEnv(t, "echo hello", "Prints hello to standard output.")
+	result := e.run("\nn\n", "--learn", "greet me")
+	assertContains(t, result.stdout, "Prints hello to standard output.")
+	assertNotContains(t, result.stdout, "Your answer:")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLengthFlags(t *testing.T) {
+	shortRule := "- Keep the command to one short line"
+	longRule := "- The command does not need to be a one-liner"
+	tests := []struct {
+		args      []string
+		maxTokens float64
+		rule      string
+	}{
+		{nil, defaultMaxTokens, ""},
+		{[]string{"--short"}, shortMaxTokens, shortRule},
+		{[]string{"--long"}, longMaxTokens, longRule},
+		{[]string{"--long", "--max-tokens", "900"}, 900, longRule},
+		{[]string{"--max-tokens", "40"}, 40, ""},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "ls")
+		e.run("n\n", append(tt.args, "list files")...)
+		name := strings.Join(tt.args, " ")
+		if got := e.api.requests[0]["max_tokens"]; got != tt.maxTokens {
+			t.Errorf("%s: max_tokens = %v, want %v", name, got, tt.maxTokens)
+		}
+		prompt := e.api.prompts()[0]
+		for _, rule := range []string{shortRule, longRule} {
+			if want := rule == tt.rule; strings.Contains(prompt, rule) != want {
+				t.Errorf("%s: prompt has %q = %v, want %v", name, rule, !want, want)
+			}
+		}
+	}
+}
+
+func TestLengthFlagsInvalid(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--short", "--long"}, "--short and --long cannot be used together"},
+		{[]string{"--max-tokens", "-1"}, "--max-tokens must not be negative"},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "ls")
+		result := e.run("", append(tt.args, "list files")...)
+		if result.code != exitConfig {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, result.code, exitConfig)
+		}
+		assertContains(t, result.stderr, tt.want)
+	}
+}
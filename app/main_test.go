@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+// Passed through panic by the exit seam so runMain can stop main
+type exitPanic struct{ code int }
+
+// A fake chat completions API answering with queued replies. The last
+// reply is repeated once the queue runs out.
+type fakeAPI struct {
+	mu       sync.Mutex
+	replies  []string
+	risk     string
+	drops    int    // Requests cut off mid-response before any is answered
+	badKey   string // API key answered with 401 Unauthorized
+	requests []map[string]interface{}
+	keys     []string // API key sent with each request
+	logprob  float64  // Log probability of the first token, sent when logprobs are requested
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, body)
+	f.keys = append(f.keys, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if f.badKey != "" && r.Header.Get("Authorization") == "Bearer "+f.badKey {
+		f.mu.Unlock()
+		http.Error(w, `{"error": {"message": "Incorrect API key provided"}}`, http.StatusUnauthorized)
+		return
+	}
+	reply := ""
+	if len(f.replies) > 0 {
+		reply = f.replies[0]
+		if len(f.replies) > 1 {
+			f.replies = f.replies[1:]
+		}
+	}
+	risk, logprob := f.risk, f.logprob
+	drop := f.drops > 0
+	if drop {
+		f.drops--
+	}
+	f.mu.Unlock()
+	if drop {
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte(`{"choices": [`))
+		return
+	}
+	if risk == "" {
+		risk = "safe"
+	}
+
+	// A suggest_command reply is split into tokens so that the command's
+	// first token carries the log probability
+	tokens, commandToken := []string{reply}, 0
+	if _, structured := body["response_format"]; structured {
+		command, _ := json.Marshal(reply)
+		rating, _ := json.Marshal(risk)
+		tokens, commandToken = []string{`{"command":"`, string(command[1:]), `,"risk":` + string(rating) + `}`}, 1
+	}
+	choice := map[string]interface{}{"message": map[string]interface{}{"content": strings.Join(tokens, "")}}
+	if body["logprobs"] == true {
+		var content []interface{}
+		for i, token := range tokens {
+			p := 0.0
+			if i == commandToken {
+				p = logprob
+			}
+			content = append(content, map[string]interface{}{"token": token, "logprob": p})
+		}
+		choice["logprobs"] = map[string]interface{}{"content": content}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{choice},
+		"usage":   map[string]interface{}{"prompt_tokens": 100, "completion_tokens": 10},
+	})
+}
+
+// The user message of each request made so far
+func (f *fakeAPI) prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var prompts []string
+	for _, request := range f.requests {
+		messages, _ := request["messages"].([]interface{})
+		last, _ := messages[len(messages)-1].(map[string]interface{})
+		content, _ := last["content"].(string)
+		prompts = append(prompts, content)
+	}
+	return prompts
+}
+
+// A temporary home directory and fake API for running main in-process
+type testEnv struct {
+	t    *testing.T
+	home string
+	dir  string // Working directory for each run
+	api  *fakeAPI
+	env  map[string]string
+}
+
+func newTestEnv(t *testing.T, replies ...string) *testEnv {
+	t.Helper()
+	api := &fakeAPI{replies: replies}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	e := &testEnv{t: t, home: t.TempDir(), dir: t.TempDir(), api: api}
+	e.env = map[string]string{
+		"HOME":                e.home,
+		"OPENAI_BASE_URL":     server.URL,
+		"OPENAI_API_KEY":      "sk-test-0123456789abcdef",
+		"OPENAI_ORG_ID":       "",
+		"OPENAI_PROJECT_ID":   "",
+		"DINGUS_MODEL":        "",
+		"DINGUS_HISTORY_FILE": "",
+		"DINGUS_LAST_COMMAND": "",
+		"DINGUS_LAST_STATUS":  "",
+		"NO_COLOR":            "1",
+	}
+	return e
+}
+
+// Path of a file in the config directory
+func (e *testEnv) configPath(name string) string {
+	return filepath.Join(e.home, ".dingus-copilot", name)
+}
+
+func (e *testEnv) writeConfig(config string) {
+	e.t.Helper()
+	if err := os.MkdirAll(e.configPath(""), 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := os.WriteFile(e.configPath("config.json"), []byte(config), 0600); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+// Seed the history file with commands, oldest first
+func (e *testEnv) writeHistory(entries ...aid.HistoryEntry) {
+	e.t.Helper()
+	if err := os.MkdirAll(e.configPath(""), 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if err := os.WriteFile(e.configPath("history.json"), data, 0600); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+// The history entries on disk
+func (e *testEnv) readHistory() []aid.HistoryEntry {
+	e.t.Helper()
+	data, err := os.ReadFile(e.configPath("history.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	var entries []aid.HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		e.t.Fatal(err)
+	}
+	return entries
+}
+
+// What one run of main printed and the code it exited with
+type runResult struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// Run main with args, feeding input to its prompts
+func (e *testEnv) run(input string, args ...string) runResult {
+	e.t.Helper()
+	for key, value := range e.env {
+		e.t.Setenv(key, value)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if err := os.Chdir(e.dir); err != nil {
+		e.t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	stdoutFile := filepath.Join(e.t.TempDir(), "stdout")
+	stderrFile := filepath.Join(e.t.TempDir(), "stderr")
+	stdoutWriter, err := os.Create(stdoutFile)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	stderrWriter, err := os.Create(stderrFile)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	savedStdout, savedStderr, savedArgs, savedExit := os.Stdout, os.Stderr, os.Args, exit
+	os.Stdout, os.Stderr = stdoutWriter, stderrWriter
+	log.SetOutput(stderrWriter)
+	defer func() {
+		os.Stdout, os.Stderr, os.Args, exit = savedStdout, savedStderr, savedArgs, savedExit
+		log.SetOutput(os.Stderr)
+	}()
+
+	resetGlobals()
+	os.Args = append([]string{"dingus-copilot"}, args...)
+	stdin = bufio.NewReader(strings.NewReader(input))
+	evalStdout = os.Stdout
+	exit = func(code int) { panic(exitPanic{code}) }
+
+	result := runResult{code: -1}
+	func() {
+		defer func() {
+			r := recover()
+			if stop, ok := r.(exitPanic); ok {
+				result.code = stop.code
+			} else if r != nil {
+				panic(r)
+			}
+		}()
+		main()
+	}()
+
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	stdout, _ := os.ReadFile(stdoutFile)
+	stderr, _ := os.ReadFile(stderrFile)
+	result.stdout, result.stderr = string(stdout), string(stderr)
+	return result
+}
+
+// The history tracker as the program starts with it
+var initialHistory = history
+
+// The interactive programs before interactive_commands extends them
+var initialInteractive = interactivePrograms
+
+// The colour codes as the program starts with them, before NO_COLOR
+var initialColors = [...]string{colorReset, colorGreen, colorRed, colorYellow, colorCyan, colorPurple, colorBold}
+
+// Reset the state main keeps in package variables between runs
+func resetGlobals() {
+	colorReset, colorGreen, colorRed, colorYellow = initialColors[0], initialColors[1], initialColors[2], initialColors[3]
+	colorCyan, colorPurple, colorBold = initialColors[4], initialColors[5], initialColors[6]
+	options = Options{}
+	flagsSet = map[string]bool{}
+	history = initialHistory
+	history.Entries = []aid.HistoryEntry{}
+	activeAPIKey = ""
+	apiTransport = nil
+	tracer = Tracer{}
+	configSources = nil
+	queryAfterDashes = false
+	interactivePrograms = initialInteractive
+}
+
+// Fail unless text contains each of want
+func assertContains(t *testing.T, text string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(text, w) {
+			t.Errorf("output is missing %q:\n%s", w, text)
+		}
+	}
+}
+
+// Fail if text contains any of unwanted
+func assertNotContains(t *testing.T, text string, unwanted ...string) {
+	t.Helper()
+	for _, u := range unwanted {
+		if strings.Contains(text, u) {
+			t.Errorf("output contains %q:\n%s", u, text)
+		}
+	}
+}
@@ -1,2 +1,2 @@
 cd app
-GOOS=darwin GOARCH=amd64 go build -buildvcs=false -o /go/src/output/dingus-copilot
\ No newline at end of file
+GOOS=darwin GOARCH=amd64 go build -buildvcs=false -ldflags "-X main.version=${VERSION:-dev} -X main.commit=$(git rev-parse --short HEAD 2>/dev/null || echo unknown) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" -o /go/src/output/dingus-copilot
\ No newline at end of file
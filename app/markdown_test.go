@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const markdownExplanation = "## Breakdown\n- `tar -czf` creates a **gzipped** archive\n  * `-C dir` changes directory first\n```\ntar -xzf out.tgz\n```\nPlain __closing__ line"
+
+func TestRenderMarkdown(t *testing.T) {
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+	const bold, cyan, reset = "\033[1m", "\033[36m", "\033[0m"
+	want := strings.Join([]string{
+		bold + "Breakdown" + reset,
+		"  • " + cyan + "tar -czf" + reset + " creates a " + bold + "gzipped" + reset + " archive",
+		"    • " + cyan + "-C dir" + reset + " changes directory first",
+		"    " + cyan + "tar -xzf out.tgz" + reset,
+		"Plain " + bold + "closing" + reset + " line",
+	}, "\n")
+	if got := renderMarkdown(markdownExplanation); got != want {
+		t.Errorf("renderMarkdown =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRenderMarkdownNoColor(t *testing.T) {
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+	disableColor()
+	want := "Breakdown\n  • tar -czf creates a gzipped archive\n    • -C dir changes directory first\n    tar -xzf out.tgz\nPlain closing line"
+	if got := renderMarkdown(markdownExplanation); got != want {
+		t.Errorf("renderMarkdown =\n%q\nwant\n%q", got, want)
+	}
+	if got := renderMarkdown("2 * 3 * 4 and a_b_c"); got != "2 * 3 * 4 and a_b_c" {
+		t.Errorf("renderMarkdown changed plain text to %q", got)
+	}
+}
+
+func TestExplanationNoColor(t *testing.T) {
+	e := newTestEnv(t, markdownExplanation)
+	e.env["NO_COLOR"] = ""
+	result := e.run("", "--no-color", "explain the difference between tar and zip")
+	assertContains(t, result.stdout, "  • tar -czf creates a gzipped archive")
+	assertNotContains(t, result.stdout, "\033[", "**", "`")
+
+	e = newTestEnv(t, markdownExplanation)
+	e.env["NO_COLOR"] = ""
+	result = e.run("", "explain the difference between tar and zip")
+	assertContains(t, result.stdout, "\033[1mgzipped\033[0m")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Read the records in a --metrics-file
+func readMetrics(t *testing.T, path string) []MetricsRecord {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []MetricsRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record MetricsRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("bad record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestMetricsRecord(t *testing.T) {
+	e := newTestEnv(t, "ls", "Lists files.")
+	e.writeConfig(`{"show_summary": true}`)
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	e.run("n\n", "--metrics-file", path, "--model", "gpt-4o", "list files")
+
+	records := readMetrics(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want one per API call", len(records))
+	}
+	record := records[0]
+	if record.Call != "suggestion" || records[1].Call != "summary" {
+		t.Errorf("calls = %q, %q", record.Call, records[1].Call)
+	}
+	if record.Model != "gpt-4o" || record.PromptTokens != 100 || record.CompletionTokens != 10 {
+		t.Errorf("record = %+v", record)
+	}
+	if record.Timestamp.IsZero() || record.Cost <= 0 || record.CacheHit || record.Retries != 0 || record.Error != "" {
+		t.Errorf("record = %+v", record)
+	}
+}
+
+func TestMetricsCountsRetries(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.api.drops = 1
+	e.writeConfig(`{"retries": 1}`)
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	result := e.run("n\n", "--metrics-file", path, "list files")
+	assertContains(t, result.stderr, "Connection dropped, retrying (1/1)")
+
+	records := readMetrics(t, path)
+	if len(records) != 1 || records[0].Retries != 1 || records[0].Error != "" {
+		t.Errorf("records = %+v, want one successful call after a retry", records)
+	}
+}
+
+func TestMetricsCountsCacheHits(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	e.run("n\n", "--metrics-file", path, "--deterministic", "list files")
+	e.run("n\n", "--metrics-file", path, "--deterministic", "list files")
+
+	records := readMetrics(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if records[0].CacheHit || !records[1].CacheHit || records[1].Cost != 0 {
+		t.Errorf("records = %+v, want the second served from the cache for free", records)
+	}
+	if len(e.api.requests) != 1 {
+		t.Errorf("made %d API requests, want 1", len(e.api.requests))
+	}
+}
+
+func TestMetricsRecordsErrors(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.api.drops = 2
+	e.writeConfig(`{"retries": 0}`)
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	result := e.run("", "--metrics-file", path, "list files")
+	if result.code != exitAPI {
+		t.Errorf("exit code = %d, want %d", result.code, exitAPI)
+	}
+	records := readMetrics(t, path)
+	if len(records) != 1 || !strings.Contains(records[0].Error, "connection dropped") {
+		t.Errorf("records = %+v, want the error recorded", records)
+	}
+}
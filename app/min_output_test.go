@@ -0,0 +1,42 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMinOutputStoreWords(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	tests := []struct {
+		command string
+		output  string
+	}{
+		{"echo ok", ""},
+		{"echo one two three", "one two three"},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, tt.command)
+		e.writeConfig(`{"min_output_store_words": 3}`)
+		if result := e.run("y\n", "say something"); result.code != exitOK {
+			t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+		}
+		entries := e.readHistory()
+		if len(entries) != 1 || entries[0].Command != tt.command {
+			t.Fatalf("history = %+v, want the command kept", entries)
+		}
+		if got := strings.TrimSpace(entries[0].Output); got != tt.output {
+			t.Errorf("%s: stored output = %q, want %q", tt.command, got, tt.output)
+		}
+	}
+}
+
+func TestNegativeMinOutputStoreWords(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"min_output_store_words": -1}`)
+	if result := e.run("n\n", "list files"); result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+}
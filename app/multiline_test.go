@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestCountCommands(t *testing.T) {
+	tests := []struct {
+		command string
+		want    int
+	}{
+		{"ls", 1},
+		{"docker run \\\n  --rm \\\n  alpine", 1},
+		{"find . -name '*.go' |\n  xargs wc -l", 1},
+		{"make &&\n  make install", 1},
+		{"cd build\nmake\n\nmake install", 3},
+		{"for f in *.log; do\n  gzip \"$f\"\ndone", 1},
+		{"if [ -d build ]; then\n  rm -r build\nfi\nmkdir build", 2},
+	}
+	for _, tt := range tests {
+		if got := countCommands(tt.command); got != tt.want {
+			t.Errorf("countCommands(%q) = %d, want %d", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestMultiLineContinued(t *testing.T) {
+	e := newTestEnv(t, "echo one \\\n  two")
+	result := e.run("y\n", "--long", "print two words")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, "Suggested command:\n  echo one \\\n    two\n", "one two\n")
+	assertNotContains(t, result.stdout, "separate commands")
+}
+
+func TestMultiLineSeparate(t *testing.T) {
+	e := newTestEnv(t, "echo one\necho two")
+	result := e.run("y\n", "--long", "print two lines")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout,
+		"Suggested command:\n  echo one\n  echo two\n",
+		"Note: this is 2 separate commands; they will run one after another in a single shell.",
+		"one\ntwo\n")
+}
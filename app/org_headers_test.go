@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Record the headers of each request before the fake API answers it
+func recordHeaders(t *testing.T, e *testEnv) *[]http.Header {
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		e.api.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	e.env["OPENAI_BASE_URL"] = server.URL
+	return &headers
+}
+
+func TestOrgAndProjectHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		env     map[string]string
+		org     string
+		project string
+	}{
+		{"unset", `{}`, nil, "", ""},
+		{"config", `{"org_id": "org-config", "project_id": "proj-config"}`, nil, "org-config", "proj-config"},
+		{"environment", `{"org_id": "org-config"}`, map[string]string{"OPENAI_ORG_ID": "org-env", "OPENAI_PROJECT_ID": "proj-env"}, "org-env", "proj-env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, "ls")
+			headers := recordHeaders(t, e)
+			for key, value := range tt.env {
+				e.env[key] = value
+			}
+			e.writeConfig(tt.config)
+			e.run("n\n", "list files")
+			if len(*headers) != 1 {
+				t.Fatalf("made %d requests, want one", len(*headers))
+			}
+			h := (*headers)[0]
+			if _, set := h["Openai-Organization"]; set != (tt.org != "") || h.Get("OpenAI-Organization") != tt.org {
+				t.Errorf("OpenAI-Organization = %q, want %q", h.Values("OpenAI-Organization"), tt.org)
+			}
+			if _, set := h["Openai-Project"]; set != (tt.project != "") || h.Get("OpenAI-Project") != tt.project {
+				t.Errorf("OpenAI-Project = %q, want %q", h.Values("OpenAI-Project"), tt.project)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestOSC52Sequence(t *testing.T) {
+	tests := []struct {
+		text   string
+		inTmux bool
+		want   string
+	}{
+		{"ls -la", false, "\033]52;c;bHMgLWxh\a"},
+		{"echo héllo | wc", false, "\033]52;c;ZWNobyBow6lsbG8gfCB3Yw==\a"},
+		{"ls -la", true, "\033Ptmux;\033\033]52;c;bHMgLWxh\a\033\\"},
+	}
+	for _, tt := range tests {
+		if got := osc52Sequence(tt.text, tt.inTmux); got != tt.want {
+			t.Errorf("osc52Sequence(%q, %v) = %q, want %q", tt.text, tt.inTmux, got, tt.want)
+		}
+	}
+}
+
+func TestOSC52Likely(t *testing.T) {
+	for _, term := range []string{"", "dumb", "linux"} {
+		getenv := func(string) string { return term }
+		if osc52Likely(getenv) {
+			t.Errorf("osc52Likely with TERM=%q, want false", term)
+		}
+	}
+}
+
+func TestCopyOSC52(t *testing.T) {
+	e := newTestEnv(t, "ls -la")
+	e.env["TMUX"] = ""
+	e.writeConfig(`{"clipboard": "osc52"}`)
+	result := e.run("c\n", "list files")
+	assertContains(t, result.stderr, "\033]52;c;bHMgLWxh\a")
+	assertContains(t, result.stdout, "Command sent to your terminal's clipboard!")
+	assertNotContains(t, result.stdout, "copy-me:")
+}
+
+func TestClipboardConfigInvalid(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"clipboard": "carrier-pigeon"}`)
+	result := e.run("", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, `unknown clipboard "carrier-pigeon" (use tools or osc52)`)
+}
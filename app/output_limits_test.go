@@ -0,0 +1,47 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDisplayAndHistoryLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	tests := []struct {
+		name        string
+		config      string
+		shown       string // Last word expected on screen
+		hidden      string // Word expected to be cut from the screen
+		storedWords int
+	}{
+		{"full display, short history", `{"history_output_words": 5}`, "w100", "", 5},
+		{"short display, long history", `{"display_max_bytes": 20, "history_output_words": 50}`, "w1 ", "w100", 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, "for i in $(seq 1 100); do echo w$i; done")
+			e.writeConfig(tt.config)
+			result := e.run("y\n", "print words")
+			if result.code != exitOK {
+				t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+			}
+			assertContains(t, strings.ReplaceAll(result.stdout, "\n", " "), tt.shown)
+			if tt.hidden != "" {
+				assertNotContains(t, result.stdout, tt.hidden)
+				assertContains(t, result.stdout, "output truncated after 20 bytes (display_max_bytes)")
+			}
+
+			entries := e.readHistory()
+			if len(entries) != 1 {
+				t.Fatalf("history = %+v, want one entry", entries)
+			}
+			words := strings.Fields(entries[0].Output)
+			if len(words) != tt.storedWords || words[len(words)-1] != "w100" {
+				t.Errorf("stored %d words ending %q, want the last %d", len(words), words[len(words)-1], tt.storedWords)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Make stdout look like a terminal, or not
+func stubTerminal(t *testing.T, terminal bool) {
+	saved := stdoutIsTerminal
+	t.Cleanup(func() { stdoutIsTerminal = saved })
+	stdoutIsTerminal = func() bool { return terminal }
+}
+
+// Record what runPager is asked to show instead of running a pager
+func stubPager(t *testing.T) *[]string {
+	saved := runPager
+	t.Cleanup(func() { runPager = saved })
+	var paged []string
+	runPager = func(pager []string, text string) error {
+		paged = append(paged, strings.Join(pager, " ")+": "+text)
+		return nil
+	}
+	return &paged
+}
+
+func TestPagerCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		terminal bool
+		pager    string
+		env      string
+		less     bool
+		want     []string
+	}{
+		{"config first", true, "most -s", "more", true, []string{"most", "-s"}},
+		{"then $PAGER", true, "", "more -R", true, []string{"more", "-R"}},
+		{"then less", true, "", "", true, []string{"less"}},
+		{"no pager installed", true, "", "", false, nil},
+		{"turned off", true, pagerOff, "more", true, nil},
+		{"not a terminal", false, "most", "more", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobals()
+			t.Cleanup(resetGlobals)
+			stubTerminal(t, tt.terminal)
+			if tt.less {
+				stubLookPath(t, "less")
+			} else {
+				stubLookPath(t)
+			}
+			options.Pager = tt.pager
+			got := pagerCommand(func(name string) string { return map[string]string{"PAGER": tt.env}[name] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pagerCommand = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineLimitWriter(t *testing.T) {
+	var out strings.Builder
+	w := &lineLimitWriter{w: &out, limit: 2}
+	for _, chunk := range []string{"one\ntw", "o\nthree\n", "four\n"} {
+		if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if out.String() != "one\ntwo\n" || !w.exceeded {
+		t.Errorf("wrote %q, exceeded = %v, want two lines", out.String(), w.exceeded)
+	}
+}
+
+func TestPagerLongOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses seq")
+	}
+	stubTerminal(t, true)
+	paged := stubPager(t)
+	e := newTestEnv(t, "seq 1 80")
+	e.env["PAGER"] = "more -R"
+	result := e.run("y\n", "count to 80")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+	}
+	assertContains(t, result.stdout, "\n50\n", "... more than 50 lines, showing all of it in more")
+	assertNotContains(t, result.stdout, "\n51\n")
+	if len(*paged) != 1 || !strings.HasPrefix((*paged)[0], "more -R: 1\n2\n") || !strings.HasSuffix((*paged)[0], "\n80\n") {
+		t.Errorf("paged %q, want the full output in the pager", *paged)
+	}
+
+	// Fewer lines than pager_lines are shown as usual
+	paged = stubPager(t)
+	e = newTestEnv(t, "seq 1 80")
+	e.env["PAGER"] = "more -R"
+	e.writeConfig(`{"pager_lines": 100}`)
+	result = e.run("y\n", "count to 80")
+	assertContains(t, result.stdout, "\n80\n")
+	if len(*paged) != 0 {
+		t.Errorf("paged %q, want no pager for short output", *paged)
+	}
+}
+
+func TestPagerSkipped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses seq")
+	}
+	tests := []struct {
+		name     string
+		terminal bool
+		config   string
+	}{
+		{"not a terminal", false, ""},
+		{"turned off", true, `{"pager": "off"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubTerminal(t, tt.terminal)
+			paged := stubPager(t)
+			e := newTestEnv(t, "seq 1 80")
+			e.env["PAGER"] = "more -R"
+			if tt.config != "" {
+				e.writeConfig(tt.config)
+			}
+			result := e.run("y\n", "count to 80")
+			assertContains(t, result.stdout, "\n51\n", "\n80\n")
+			assertNotContains(t, result.stdout, "more than 50 lines")
+			if len(*paged) != 0 {
+				t.Errorf("paged %q", *paged)
+			}
+		})
+	}
+}
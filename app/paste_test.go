@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestPasteTool(t *testing.T) {
+	tests := []struct {
+		name      string
+		goos      string
+		env       map[string]string
+		installed []string
+		wantPath  string
+		wantArgs  []string
+	}{
+		{"macOS", "darwin", nil, []string{"osascript"}, "/usr/bin/osascript",
+			[]string{"-e", `tell application "System Events" to keystroke "echo \"hi\""`}},
+		{"Wayland", "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, []string{"wtype", "xdotool"}, "/usr/bin/wtype",
+			[]string{"--", `echo "hi"`}},
+		{"X11", "linux", map[string]string{"DISPLAY": ":0"}, []string{"xdotool"}, "/usr/bin/xdotool",
+			[]string{"type", "--clearmodifiers", "--", `echo "hi"`}},
+		{"Wayland without wtype", "linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, []string{"xdotool"}, "", nil},
+		{"X11 without xdotool", "linux", map[string]string{"DISPLAY": ":0"}, nil, "", nil},
+		{"no graphical session", "linux", nil, []string{"xdotool", "wtype"}, "", nil},
+		{"Windows", "windows", nil, nil, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubLookPath(t, tt.installed...)
+			getenv := func(key string) string { return tt.env[key] }
+			path, args, err := pasteTool(tt.goos, getenv, `echo "hi"`)
+			if tt.wantPath == "" {
+				if !errors.Is(err, errPasteUnavailable) {
+					t.Errorf("err = %v, want errPasteUnavailable", err)
+				}
+				return
+			}
+			if err != nil || path != tt.wantPath || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("pasteTool = %q, %q, %v, want %q, %q", path, args, err, tt.wantPath, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestPasteFallsBackToCopy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("checks the Linux paste tools")
+	}
+	stubLookPath(t)
+	e := newTestEnv(t, "git status")
+	e.env["DISPLAY"] = ":0"
+	e.env["WAYLAND_DISPLAY"] = ""
+	result := e.run("t\n", "show the repo state")
+	assertContains(t, result.stdout, "pasting into the terminal is not available: install xdotool to enable it", "copy-me: git status")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPersonaPrompts(t *testing.T) {
+	for _, name := range personaNames() {
+		e := newTestEnv(t, "ls")
+		e.writeConfig(`{"persona": "` + name + `"}`)
+		e.run("n\n", "list files")
+		prompt := e.api.prompts()[0]
+		for other, preset := range personas {
+			if other == name {
+				assertContains(t, prompt, preset.Rules)
+			} else {
+				assertNotContains(t, prompt, preset.Rules)
+			}
+		}
+	}
+}
+
+func TestPersonaDefaults(t *testing.T) {
+	tests := []struct {
+		persona     string
+		requests    int // A second request means the suggestion was explained
+		temperature interface{}
+		typedYes    bool
+	}{
+		{"", 1, nil, false},
+		{"concise", 1, nil, false},
+		{"teacher", 2, nil, false},
+		{"cautious", 1, cautiousTemperature, true},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "touch notes.txt")
+		e.api.risk = "caution"
+		args := []string{"create a notes file"}
+		if tt.persona != "" {
+			args = append([]string{"--persona", tt.persona}, args...)
+		}
+		result := e.run("y\nno\n", args...)
+		requests := e.api.requests
+		if len(requests) != tt.requests {
+			t.Errorf("%s: made %d requests, want %d", tt.persona, len(requests), tt.requests)
+		}
+		if got := requests[0]["temperature"]; got != tt.temperature {
+			t.Errorf("%s: temperature = %v, want %v", tt.persona, got, tt.temperature)
+		}
+		if got := strings.Contains(result.stdout, "The model rated this command caution. Type 'yes' to run it:"); got != tt.typedYes {
+			t.Errorf("%s: typed confirmation = %v, want %v:\n%s", tt.persona, got, tt.typedYes, result.stdout)
+		}
+	}
+}
+
+func TestPersonaFlagsWin(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"persona": "cautious"}`)
+	e.run("n\n", "--temperature", "0.7", "list files")
+	if got := e.api.requests[0]["temperature"]; got != 0.7 {
+		t.Errorf("temperature = %v, want 0.7 from the flag", got)
+	}
+
+	e = newTestEnv(t, "ls")
+	e.writeConfig(`{"persona": "cautious"}`)
+	e.run("n\n", "--persona", "concise", "list files")
+	assertContains(t, e.api.prompts()[0], personas["concise"].Rules)
+	assertNotContains(t, e.api.prompts()[0], personas["cautious"].Rules)
+}
+
+func TestUnknownPersona(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	result := e.run("", "--persona", "pirate", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, `unknown persona "pirate" (use cautious, concise, teacher)`)
+}
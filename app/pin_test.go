@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+// Five turns, the first about working in /srv/app
+func pinHistoryEntries(pinFirst bool) []aid.HistoryEntry {
+	entries := []aid.HistoryEntry{{Query: "work in /srv/app", Command: "echo turn-1", Pinned: pinFirst}}
+	for i := 2; i <= 5; i++ {
+		entries = append(entries, aid.HistoryEntry{Command: fmt.Sprintf("echo turn-%d", i)})
+	}
+	return entries
+}
+
+// Turns of pinHistoryEntries that appear in the prompt
+func turnsInPrompt(prompt string) []int {
+	var turns []int
+	for i := 1; i <= 5; i++ {
+		if strings.Contains(prompt, "echo turn-"+strconv.Itoa(i)) {
+			turns = append(turns, i)
+		}
+	}
+	return turns
+}
+
+func TestHistoryPinSubcommand(t *testing.T) {
+	e := newTestEnv(t)
+	e.writeHistory(pinHistoryEntries(false)...)
+	result := e.run("", "history", "pin", "1")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, "Pinned: echo turn-1")
+	entries := e.readHistory()
+	if len(entries) != 5 || !entries[0].Pinned || entries[1].Pinned {
+		t.Errorf("history = %+v, want the first entry pinned", entries)
+	}
+
+	result = e.run("", "history", "unpin", "1")
+	assertContains(t, result.stdout, "Unpinned: echo turn-1")
+	if entries := e.readHistory(); entries[0].Pinned {
+		t.Error("entry still pinned after unpin")
+	}
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests", len(e.api.requests))
+	}
+}
+
+func TestHistoryPinInvalid(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"history", "pin"}, exitUsage, "usage: dingus-copilot history pin <n>"},
+		{[]string{"history", "pin", "first"}, exitUsage, `"first" is not an entry number`},
+		{[]string{"history", "unpin", "0"}, exitUsage, `"0" is not an entry number`},
+		{[]string{"history", "pin", "9"}, exitFailure, "no history entry 9"},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t)
+		e.writeHistory(pinHistoryEntries(false)...)
+		result := e.run("", tt.args...)
+		if result.code != tt.code {
+			t.Errorf("%v: exit code = %d, want %d", tt.args, result.code, tt.code)
+		}
+		assertContains(t, result.stderr, tt.want)
+	}
+}
+
+func TestPinnedContext(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []int
+	}{
+		// The pinned entry counts against the limit
+		{[]string{"--context", "3"}, []int{1, 4, 5}},
+		{[]string{"--context", "2"}, []int{1, 5}},
+		{[]string{"--context", "1"}, []int{1}},
+		{[]string{"--context", "0"}, nil},
+		{nil, []int{1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		e := newTestEnv(t, "ls")
+		e.writeHistory(pinHistoryEntries(true)...)
+		e.run("n\n", append(tt.args, "list files")...)
+		prompt := e.api.prompts()[0]
+		if got := turnsInPrompt(prompt); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%v: prompt has turns %v, want %v", tt.args, got, tt.want)
+		}
+		if len(tt.want) == 0 {
+			assertNotContains(t, prompt, "/srv/app")
+		}
+	}
+}
+
+func TestPinnedSurvivesBudget(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	base := countTokensApprox(e.api.prompts()[0])
+
+	var entries []aid.HistoryEntry
+	for i := 1; i <= 3; i++ {
+		// About 200 tokens each
+		entries = append(entries, aid.HistoryEntry{Command: fmt.Sprintf("make target-%d", i), Output: strings.Repeat("x", 800)})
+	}
+	entries[0].Pinned = true
+	e.writeHistory(entries...)
+	e.writeConfig(fmt.Sprintf(`{"max_prompt_tokens": %d}`, base+500))
+
+	result := e.run("n\n", "list files")
+	prompt := e.api.prompts()[1]
+	assertContains(t, prompt, "make target-1", "make target-3")
+	assertNotContains(t, prompt, "make target-2")
+	assertContains(t, result.stderr, "leaves out the oldest history entry.")
+}
+
+func TestPinnedHistoryTrimmed(t *testing.T) {
+	// One more than history keeps, so adding a turn drops two
+	entries := []aid.HistoryEntry{{Command: "echo turn-1", Pinned: true}}
+	for i := 2; i <= history.MaxSize+1; i++ {
+		entries = append(entries, aid.HistoryEntry{Command: fmt.Sprintf("echo turn-%d", i)})
+	}
+	e := newTestEnv(t, "ls")
+	e.writeHistory(entries...)
+	e.run("y\n", "list files")
+
+	stored := e.readHistory()
+	if len(stored) != history.MaxSize {
+		t.Fatalf("history has %d entries, want %d", len(stored), history.MaxSize)
+	}
+	if !stored[0].Pinned || stored[0].Command != "echo turn-1" || stored[1].Command != "echo turn-4" {
+		t.Errorf("history starts %+v, want the pinned entry kept and turns 2 and 3 dropped", stored[:2])
+	}
+}
@@ -0,0 +1,96 @@
+package aid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// Responses stored on disk by a hash of the request that produced them
+type ResponseCache struct {
+	Path       string
+	MaxEntries int
+	Now        func() time.Time
+}
+
+// A stored response and when it was stored, used to evict the oldest
+type cacheEntry struct {
+	Response ChatResponse `json:"response"`
+	Time     time.Time    `json:"time"`
+}
+
+// Create a response cache using the real clock
+func NewResponseCache(path string, maxEntries int) *ResponseCache {
+	return &ResponseCache{Path: path, MaxEntries: maxEntries, Now: time.Now}
+}
+
+// Hash a request body. The prompt carries the history context, so the
+// same query after different history gets a different key.
+func CacheKey(reqBody map[string]interface{}) (string, error) {
+	// Map keys are marshalled in sorted order, so equal requests hash equally
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Look up the response stored for a key
+func (c *ResponseCache) Get(key string) (ChatResponse, bool, error) {
+	entries, err := c.load()
+	if err != nil {
+		return ChatResponse{}, false, err
+	}
+	entry, ok := entries[key]
+	return entry.Response, ok, nil
+}
+
+// Store a response, dropping the oldest entries beyond MaxEntries
+func (c *ResponseCache) Put(key string, response ChatResponse) error {
+	return WithFileLock(c.Path, func() error {
+		entries, err := c.load()
+		if err != nil {
+			return err
+		}
+		entries[key] = cacheEntry{Response: response, Time: c.Now()}
+
+		if c.MaxEntries > 0 && len(entries) > c.MaxEntries {
+			keys := make([]string, 0, len(entries))
+			for k := range entries {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				return entries[keys[i]].Time.Before(entries[keys[j]].Time)
+			})
+			for _, k := range keys[:len(keys)-c.MaxEntries] {
+				delete(entries, k)
+			}
+		}
+
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		return WriteFileAtomic(c.Path, data, 0600)
+	})
+}
+
+// Read the cache file, treating a missing or corrupt one as empty
+func (c *ResponseCache) load() (map[string]cacheEntry, error) {
+	entries := map[string]cacheEntry{}
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	if json.Unmarshal(data, &entries) != nil {
+		return map[string]cacheEntry{}, nil
+	}
+	return entries, nil
+}
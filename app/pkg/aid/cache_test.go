@@ -0,0 +1,47 @@
+package aid
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	request := func(prompt string) map[string]interface{} {
+		return map[string]interface{}{
+			"model":    "gpt-4o-mini",
+			"messages": []interface{}{map[string]interface{}{"role": "user", "content": prompt}},
+		}
+	}
+	a, _ := CacheKey(request("list files\n$ cd /srv"))
+	b, _ := CacheKey(request("list files\n$ cd /srv"))
+	c, _ := CacheKey(request("list files\n$ cd /tmp"))
+	if a != b {
+		t.Error("equal requests have different keys")
+	}
+	if a == c {
+		t.Error("a different history context has the same key")
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	now := testTime
+	cache := &ResponseCache{Path: filepath.Join(t.TempDir(), "cache.json"), MaxEntries: 2, Now: func() time.Time { return now }}
+	if _, ok, err := cache.Get("a"); ok || err != nil {
+		t.Fatalf("Get on an empty cache = %v, %v", ok, err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := cache.Put(key, ChatResponse{Text: "echo " + key}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	if _, ok, _ := cache.Get("a"); ok {
+		t.Error("the oldest entry was kept past MaxEntries")
+	}
+	response, ok, err := cache.Get("c")
+	if !ok || err != nil || response.Text != "echo c" {
+		t.Errorf("Get(c) = %+v, %v, %v, want echo c", response, ok, err)
+	}
+}
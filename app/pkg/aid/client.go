@@ -0,0 +1,314 @@
+package aid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Reply text and token usage from a chat completions request
+type ChatResponse struct {
+	Text             string
+	PromptTokens     int
+	CompletionTokens int
+	Confidence       float64 // Probability of the first token of the command, 0 when logprobs weren't requested
+	Risk             string  // The model's risk rating for a suggested command
+}
+
+// Risk ratings the model gives a suggested command
+const (
+	RiskSafe      = "safe"
+	RiskCaution   = "caution"
+	RiskDangerous = "dangerous"
+)
+
+// Response format a single suggestion is asked for, so the command comes
+// with a risk rating. The reply is JSON message content rather than a tool
+// call, which keeps logprobs available for the command's tokens.
+var SuggestCommandFormat = map[string]interface{}{
+	"type": "json_schema",
+	"json_schema": map[string]interface{}{
+		"name":        "suggest_command",
+		"description": "Suggest a terminal command and rate how risky it is to run",
+		"strict":      true,
+		"schema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"command": map[string]interface{}{
+					"type":        "string",
+					"description": "The suggested command, formatted as instructed",
+				},
+				"risk": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{RiskSafe, RiskCaution, RiskDangerous},
+					"description": "safe for read-only commands, caution for ones that change files or settings, dangerous for ones that can destroy data or the system",
+				},
+			},
+			"required":             []string{"command", "risk"},
+			"additionalProperties": false,
+		},
+	},
+}
+
+// Return a known risk rating, treating a missing or unknown one as safe
+func NormalizeRisk(risk string) string {
+	switch risk {
+	case RiskCaution, RiskDangerous:
+		return risk
+	}
+	return RiskSafe
+}
+
+// Sends chat completions requests to an OpenAI-compatible API
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	NoKey      bool         // Allow requests without an API key, for local servers
+	OrgID      string       // Sent as OpenAI-Organization when set
+	ProjectID  string       // Sent as OpenAI-Project when set
+	HTTPClient *http.Client // Defaults to http.DefaultClient when nil
+	// Extra attempts made after a network error or dropped connection
+	Retries int
+	Sleep   func(time.Duration) // Defaults to time.Sleep when nil
+	// Called before each retry when non-nil
+	OnRetry func(attempt int, err error)
+	// Called with problems that were worked around, such as malformed
+	// tool-call arguments, when non-nil
+	OnWarning func(message string)
+	// Takes a token before every request, retries included, when non-nil
+	Limiter *RateLimiter
+	NoWait  bool // Fail with ErrLimitReached instead of waiting for a token
+}
+
+// Wait before the first retry, growing with each attempt
+const retryDelay = time.Second
+
+// Create a client for a provider using its default base URL
+func NewClient(provider Provider, apiKey string) *Client {
+	return &Client{BaseURL: provider.BaseURL, APIKey: apiKey, NoKey: provider.NoKey}
+}
+
+// Send a chat completions request and return the reply text and token usage
+func (c *Client) Complete(reqBody map[string]interface{}) (ChatResponse, error) {
+	reqData, err := json.Marshal(reqBody)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	if c.APIKey == "" && !c.NoKey {
+		return ChatResponse{}, ErrAPIKeyMissing
+	}
+
+	sleep := c.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	_, structured := reqBody["response_format"]
+	for attempt := 1; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Acquire(!c.NoWait); err != nil {
+				return ChatResponse{}, err
+			}
+		}
+		response, err := c.send(reqData, structured)
+		retryable := errors.Is(err, ErrNetwork) || errors.Is(err, ErrConnDropped)
+		if !retryable || attempt > c.Retries {
+			return response, err
+		}
+		if c.OnRetry != nil {
+			c.OnRetry(attempt, err)
+		}
+		sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
+// Make a single chat completions request. A structured reply is decoded
+// as a suggest_command object.
+func (c *Client) send(reqData []byte, structured bool) (ChatResponse, error) {
+	var response ChatResponse
+	req, err := http.NewRequest("POST", c.BaseURL+"/chat/completions", bytes.NewBuffer(reqData))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	if c.OrgID != "" {
+		req.Header.Set("OpenAI-Organization", c.OrgID)
+	}
+	if c.ProjectID != "" {
+		req.Header.Set("OpenAI-Project", c.ProjectID)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return response, &APIError{Kind: ErrNetwork, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		apiErr := &APIError{Kind: ErrAPI, StatusCode: resp.StatusCode, Message: resp.Status}
+		if body := strings.TrimSpace(string(bodyBytes)); body != "" {
+			apiErr.Message += " - " + body
+		}
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			apiErr.Kind = ErrAPIKeyInvalid
+		case http.StatusTooManyRequests:
+			apiErr.Kind = ErrRateLimited
+		}
+		return response, apiErr
+	}
+
+	// A read error or truncated JSON means the connection closed mid-response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response, &APIError{Kind: ErrConnDropped, StatusCode: resp.StatusCode, Message: err.Error()}
+	}
+	var result map[string]interface{}
+	err = json.Unmarshal(body, &result)
+	var syntaxErr *json.SyntaxError
+	if err != nil && errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(len(body)) {
+		return response, &APIError{Kind: ErrConnDropped, StatusCode: resp.StatusCode, Message: err.Error()}
+	}
+	if err != nil {
+		return response, &APIError{Kind: ErrAPI, StatusCode: resp.StatusCode, Message: "malformed response: " + err.Error()}
+	}
+
+	// Extract token usage
+	if usage, ok := result["usage"].(map[string]interface{}); ok {
+		if pt, ok := usage["prompt_tokens"].(float64); ok {
+			response.PromptTokens = int(pt)
+		}
+		if ct, ok := usage["completion_tokens"].(float64); ok {
+			response.CompletionTokens = int(ct)
+		}
+	}
+
+	if choices, ok := result["choices"].([]interface{}); ok && len(choices) > 0 {
+		if choice, ok := choices[0].(map[string]interface{}); ok {
+			response.Confidence = tokenProbability(choice, 0)
+			if reason, _ := choice["finish_reason"].(string); reason == "content_filter" {
+				return response, &APIError{Kind: ErrModelRefused, StatusCode: resp.StatusCode, Message: "response was blocked by the content filter"}
+			}
+			if message, ok := choice["message"].(map[string]interface{}); ok {
+				if refusal, ok := message["refusal"].(string); ok && refusal != "" {
+					return response, &APIError{Kind: ErrModelRefused, StatusCode: resp.StatusCode, Message: refusal}
+				}
+				text, ok := message["content"].(string)
+				if ok && structured {
+					call, callErr := decodeSuggestion(text)
+					if call.Command != "" {
+						response.Confidence = tokenProbability(choice, commandOffset(text))
+					}
+					if callErr == nil {
+						response.Text = strings.TrimSpace(call.Command)
+						response.Risk = call.Risk
+						return response, nil
+					}
+					if c.OnWarning != nil {
+						c.OnWarning(fmt.Sprintf("the model's suggest_command reply did not match its schema (%v)", callErr))
+					}
+					// Without a rating, a salvaged command, or a reply that
+					// ignored the format, is treated with caution
+					response.Risk = RiskCaution
+					if call.Command != "" {
+						response.Text = strings.TrimSpace(call.Command)
+						return response, nil
+					}
+					if text = strings.TrimSpace(text); text != "" && !strings.HasPrefix(text, "{") {
+						response.Text = text
+						return response, nil
+					}
+				} else if ok {
+					response.Text = strings.TrimSpace(text)
+					response.Risk = RiskSafe
+					return response, nil
+				}
+			}
+		}
+	}
+
+	return response, &APIError{Kind: ErrModelRefused, StatusCode: resp.StatusCode, Message: "no content in the response"}
+}
+
+// Fields of a suggest_command reply
+type suggestCommandCall struct {
+	Command string
+	Risk    string
+}
+
+// Decode a suggest_command reply. err describes a reply that doesn't match
+// the schema; a usable command is kept in call even then.
+func decodeSuggestion(content string) (call suggestCommandCall, err error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return call, fmt.Errorf("malformed reply: %v", err)
+	}
+	command, ok := fields["command"].(string)
+	if !ok || strings.TrimSpace(command) == "" {
+		return call, errors.New("missing required field command")
+	}
+	call.Command = command
+	risk, _ := fields["risk"].(string)
+	if risk != RiskSafe && risk != RiskCaution && risk != RiskDangerous {
+		return call, fmt.Errorf("missing or invalid risk %q", risk)
+	}
+	call.Risk = risk
+	return call, nil
+}
+
+// Matches the start of the command's value in a suggest_command reply
+var commandValuePattern = regexp.MustCompile(`"command"\s*:\s*"`)
+
+// Byte offset in a suggest_command reply where the command's value starts
+func commandOffset(content string) int {
+	loc := commandValuePattern.FindStringIndex(content)
+	if loc == nil {
+		return 0
+	}
+	return loc[1]
+}
+
+// Read the probability of the generated token covering a byte offset of
+// the reply from a choice's logprobs. Offset 0 is the first token.
+func tokenProbability(choice map[string]interface{}, offset int) float64 {
+	logprobs, ok := choice["logprobs"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	content, ok := logprobs["content"].([]interface{})
+	if !ok {
+		return 0
+	}
+	end := 0
+	for _, item := range content {
+		token, ok := item.(map[string]interface{})
+		if !ok {
+			return 0
+		}
+		text, _ := token["token"].(string)
+		end += len(text)
+		if end <= offset {
+			continue
+		}
+		logprob, ok := token["logprob"].(float64)
+		if !ok {
+			return 0
+		}
+		return math.Exp(logprob)
+	}
+	return 0
+}
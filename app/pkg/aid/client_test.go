@@ -0,0 +1,290 @@
+package aid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start a server that answers each request with the next handler in turn
+func newTestServer(t *testing.T, handlers ...http.HandlerFunc) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls >= len(handlers) {
+			t.Errorf("unexpected request %d", calls+1)
+			http.Error(w, "unexpected", http.StatusInternalServerError)
+			return
+		}
+		handler := handlers[calls]
+		calls++
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newTestClient(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, APIKey: "sk-test", Sleep: func(time.Duration) {}}
+}
+
+// Reply with a chat completion whose message is given as JSON
+func reply(message string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"choices": [{"message": %s}], "usage": {"prompt_tokens": 12, "completion_tokens": 3}}`, message)
+	}
+}
+
+// A message whose content is the given suggest_command reply
+func suggestion(content string) string {
+	quoted, _ := json.Marshal(content)
+	return fmt.Sprintf(`{"content": %s}`, quoted)
+}
+
+func TestClientComplete(t *testing.T) {
+	var body map[string]interface{}
+	server, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("OpenAI-Organization"); got != "org-1" {
+			t.Errorf("OpenAI-Organization = %q", got)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		reply(`{"content": "  ls -la \n"}`)(w, r)
+	})
+	client := newTestClient(server.URL)
+	client.OrgID = "org-1"
+
+	response, err := client.Complete(map[string]interface{}{"model": "gpt-4o-mini"})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if response.Text != "ls -la" || response.Risk != RiskSafe {
+		t.Errorf("text, risk = %q, %q", response.Text, response.Risk)
+	}
+	if response.PromptTokens != 12 || response.CompletionTokens != 3 {
+		t.Errorf("tokens = %d, %d", response.PromptTokens, response.CompletionTokens)
+	}
+	if body["model"] != "gpt-4o-mini" {
+		t.Errorf("request body = %v", body)
+	}
+}
+
+func TestClientSuggestion(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		wantText  string
+		wantRisk  string
+		wantWarns int
+	}{
+		{"valid reply", suggestion(`{"command": "rm -rf build", "risk": "dangerous"}`), "rm -rf build", RiskDangerous, 0},
+		{"missing risk", suggestion(`{"command": "touch a"}`), "touch a", RiskCaution, 1},
+		{"invalid risk", suggestion(`{"command": "ls", "risk": "extreme"}`), "ls", RiskCaution, 1},
+		{"plain text falls back to the text", suggestion("ls -la"), "ls -la", RiskCaution, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newTestServer(t, reply(tt.message))
+			client := newTestClient(server.URL)
+			warnings := 0
+			client.OnWarning = func(string) { warnings++ }
+
+			response, err := client.Complete(map[string]interface{}{"response_format": SuggestCommandFormat})
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if response.Text != tt.wantText || response.Risk != tt.wantRisk {
+				t.Errorf("text, risk = %q, %q, want %q, %q", response.Text, response.Risk, tt.wantText, tt.wantRisk)
+			}
+			if warnings != tt.wantWarns {
+				t.Errorf("warnings = %d, want %d", warnings, tt.wantWarns)
+			}
+		})
+	}
+
+	// An object without a usable command has nothing to salvage
+	for _, content := range []string{`{"risk": "safe"}`, `{"command": 7, "risk": "safe"}`} {
+		server, _ := newTestServer(t, reply(suggestion(content)))
+		if _, err := newTestClient(server.URL).Complete(map[string]interface{}{"response_format": SuggestCommandFormat}); !errors.Is(err, ErrModelRefused) {
+			t.Errorf("%s: err = %v, want %v", content, err, ErrModelRefused)
+		}
+	}
+
+	// Without the response format, the content is the command
+	server, _ := newTestServer(t, reply(suggestion(`{"command": "ls", "risk": "safe"}`)))
+	response, err := newTestClient(server.URL).Complete(map[string]interface{}{})
+	if err != nil || response.Text != `{"command": "ls", "risk": "safe"}` || response.Risk != RiskSafe {
+		t.Errorf("plain reply = %+v, %v", response, err)
+	}
+}
+
+func TestClientConfidence(t *testing.T) {
+	server, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "ls"}, "logprobs": {"content": [{"token": "ls", "logprob": 0}]}}]}`)
+	})
+	response, err := newTestClient(server.URL).Complete(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if response.Confidence != 1 {
+		t.Errorf("confidence = %v, want 1", response.Confidence)
+	}
+}
+
+func TestClientSuggestionConfidence(t *testing.T) {
+	// The command's first token is "git", after the JSON around it
+	server, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "{\"command\": \"git status\", \"risk\": \"safe\"}"},
+			"logprobs": {"content": [{"token": "{\"", "logprob": 0}, {"token": "command", "logprob": 0}, {"token": "\": \"", "logprob": 0},
+				{"token": "git", "logprob": -0.6931471805599453}, {"token": " status", "logprob": 0}, {"token": "\", \"risk\": \"safe\"}", "logprob": 0}]}}]}`)
+	})
+	response, err := newTestClient(server.URL).Complete(map[string]interface{}{"response_format": SuggestCommandFormat})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if response.Text != "git status" || response.Confidence < 0.49 || response.Confidence > 0.51 {
+		t.Errorf("text, confidence = %q, %v, want git status at 0.5", response.Text, response.Confidence)
+	}
+}
+
+func TestClientAPIErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		kind   error
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error": "bad key"}`, ErrAPIKeyInvalid},
+		{"rate limited", http.StatusTooManyRequests, "", ErrRateLimited},
+		{"server error", http.StatusInternalServerError, "oops", ErrAPI},
+		{"refusal", http.StatusOK, `{"choices": [{"message": {"refusal": "I can't help with that"}}]}`, ErrModelRefused},
+		{"content filter", http.StatusOK, `{"choices": [{"finish_reason": "content_filter", "message": {}}]}`, ErrModelRefused},
+		{"no content", http.StatusOK, `{"choices": []}`, ErrModelRefused},
+		{"malformed", http.StatusOK, `{"choices": [}, "usage": {}}`, ErrAPI},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			client := newTestClient(server.URL)
+			client.Retries = 2
+
+			_, err := client.Complete(map[string]interface{}{})
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("err = %v, want %v", err, tt.kind)
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Errorf("err = %#v, want an *APIError with status %d", err, tt.status)
+			}
+			if tt.body != "" && tt.status != http.StatusOK && !strings.Contains(err.Error(), tt.body) {
+				t.Errorf("err = %v, want it to include the body", err)
+			}
+			if *calls != 1 {
+				t.Errorf("made %d requests, want no retries", *calls)
+			}
+		})
+	}
+}
+
+func TestClientRetriesDroppedConnection(t *testing.T) {
+	truncated := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "l`)
+	}
+	server, calls := newTestServer(t, truncated, truncated, reply(`{"content": "ls"}`))
+	client := newTestClient(server.URL)
+	client.Retries = 2
+	var attempts []int
+	var slept []time.Duration
+	client.OnRetry = func(attempt int, err error) {
+		if !errors.Is(err, ErrConnDropped) {
+			t.Errorf("retry %d for %v, want a dropped connection", attempt, err)
+		}
+		attempts = append(attempts, attempt)
+	}
+	client.Sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	response, err := client.Complete(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if response.Text != "ls" || *calls != 3 {
+		t.Errorf("text = %q after %d requests, want ls after 3", response.Text, *calls)
+	}
+	if fmt.Sprint(attempts) != "[1 2]" || fmt.Sprint(slept) != "[1s 2s]" {
+		t.Errorf("attempts %v, slept %v, want [1 2] and [1s 2s]", attempts, slept)
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	truncated := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "l`)
+	}
+	server, calls := newTestServer(t, truncated, reply(`{"content": "ls"}`))
+	client := newTestClient(server.URL)
+	client.Retries = 2
+	limiter, _, slept := newTestLimiter(t, 2)
+	client.Limiter = limiter
+
+	// The retry takes the bucket's second token
+	if _, err := client.Complete(map[string]interface{}{}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if *calls != 2 || len(*slept) != 0 {
+		t.Errorf("made %d requests and slept %v, want 2 without waiting", *calls, *slept)
+	}
+
+	client.NoWait = true
+	if _, err := client.Complete(map[string]interface{}{}); !errors.Is(err, ErrLimitReached) {
+		t.Errorf("err = %v, want ErrLimitReached", err)
+	}
+	if *calls != 2 {
+		t.Errorf("made %d requests, want none after the limit", *calls)
+	}
+}
+
+func TestClientGivesUpAfterRetries(t *testing.T) {
+	client := newTestClient("http://127.0.0.1:1")
+	client.Retries = 1
+	retries := 0
+	client.OnRetry = func(int, error) { retries++ }
+
+	_, err := client.Complete(map[string]interface{}{})
+	var apiErr *APIError
+	if !errors.Is(err, ErrNetwork) || !errors.As(err, &apiErr) || apiErr.StatusCode != 0 {
+		t.Errorf("err = %v, want a network error without a status", err)
+	}
+	if retries != 1 {
+		t.Errorf("retried %d times, want 1", retries)
+	}
+}
+
+func TestClientMissingKey(t *testing.T) {
+	client := &Client{BaseURL: "http://127.0.0.1:1"}
+	if _, err := client.Complete(map[string]interface{}{}); !errors.Is(err, ErrAPIKeyMissing) {
+		t.Errorf("err = %v, want ErrAPIKeyMissing", err)
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	if got := (&APIError{Kind: ErrRateLimited}).Error(); got != ErrRateLimited.Error() {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := (&APIError{Kind: ErrAPI, Message: "500"}).Error(); got != "API error: 500" {
+		t.Errorf("Error() = %q", got)
+	}
+}
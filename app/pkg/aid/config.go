@@ -0,0 +1,201 @@
+package aid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Optional settings stored in config.json alongside the API key
+type Config struct {
+	APIKey              string            `json:"OPENAI_API_KEY,omitempty"`
+	Keys                map[string]string `json:"keys,omitempty"`
+	Provider            string            `json:"provider,omitempty"`
+	Model               string            `json:"model,omitempty"`
+	Temperature         *float64          `json:"temperature,omitempty"`
+	RateLimitRPM        int               `json:"rate_limit_rpm,omitempty"`
+	ShowSummary         bool              `json:"show_summary,omitempty"`
+	ShareCWD            bool              `json:"share_cwd,omitempty"`
+	Shellcheck          bool              `json:"shellcheck,omitempty"`
+	KeepTrailingText    bool              `json:"keep_trailing_text,omitempty"`
+	Clipboard           string            `json:"clipboard,omitempty"`
+	DedupHistory        bool              `json:"dedup_history,omitempty"`
+	Banner              string            `json:"banner,omitempty"`
+	Acknowledged        bool              `json:"acknowledged,omitempty"`
+	SandboxNetwork      bool              `json:"sandbox_network,omitempty"`
+	SplitStreams        bool              `json:"split_streams,omitempty"`
+	CostFormat          string            `json:"cost_format,omitempty"`
+	SessionCost         bool              `json:"session_cost,omitempty"`
+	Pager               string            `json:"pager,omitempty"`
+	PagerLines          int               `json:"pager_lines,omitempty"`
+	RecordOnCopy        bool              `json:"record_on_copy,omitempty"`
+	Persona             string            `json:"persona,omitempty"`
+	HistoryFormat       string            `json:"history_format,omitempty"`
+	MinOutputWords      int               `json:"min_output_store_words,omitempty"`
+	HistoryMaxAge       int               `json:"history_max_age_minutes,omitempty"`
+	Portable            bool              `json:"portable,omitempty"`
+	RememberLast        bool              `json:"remember_last,omitempty"`
+	MaxPromptTokens     int               `json:"max_prompt_tokens,omitempty"`
+	ShareAliases        bool              `json:"share_aliases,omitempty"`
+	AllowedCommands     []string          `json:"allowed_commands,omitempty"`
+	CACert              string            `json:"ca_cert,omitempty"`
+	ClientCert          string            `json:"client_cert,omitempty"`
+	ClientKey           string            `json:"client_key,omitempty"`
+	KeyCommand          string            `json:"key_command,omitempty"`
+	OrgID               string            `json:"org_id,omitempty"`
+	ProjectID           string            `json:"project_id,omitempty"`
+	Retries             *int              `json:"retries,omitempty"`
+	HistoryOutputWords  int               `json:"history_output_words,omitempty"`
+	DisplayMaxBytes     int               `json:"display_max_bytes,omitempty"`
+	RedactEnv           []string          `json:"redact_env,omitempty"`
+	RedactQuery         bool              `json:"redact_query,omitempty"`
+	Standalone          bool              `json:"standalone,omitempty"`
+	MaxCommandLength    int               `json:"max_command_length,omitempty"`
+	InteractiveCommands []string          `json:"interactive_commands,omitempty"`
+}
+
+// Return the saved API key for a provider. Configs written before
+// per-provider keys hold a single OpenAI key at the top level.
+func (c Config) Key(provider string) string {
+	if key := c.Keys[provider]; key != "" {
+		return key
+	}
+	if provider == "openai" {
+		return c.APIKey
+	}
+	return ""
+}
+
+// Save an API key for a provider, replacing the legacy top-level key
+func (c *Config) SetKey(provider, apiKey string) {
+	if c.Keys == nil {
+		c.Keys = map[string]string{}
+	}
+	c.Keys[provider] = apiKey
+	if provider == "openai" {
+		c.APIKey = ""
+	}
+}
+
+// Config keys whose values have the wrong type
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Decode config JSON key by key so errors can name the offending key.
+// Unknown keys are returned as warnings; invalid values are left unset.
+func ParseConfig(data []byte) (Config, []string, error) {
+	var config Config
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return config, nil, DescribeJSONError(data, err)
+	}
+
+	fields := map[string]int{}
+	configType := reflect.TypeOf(config)
+	for i := 0; i < configType.NumField(); i++ {
+		name := strings.Split(configType.Field(i).Tag.Get("json"), ",")[0]
+		fields[name] = i
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings, problems []string
+	value := reflect.ValueOf(&config).Elem()
+	for _, key := range keys {
+		i, known := fields[key]
+		if !known {
+			warnings = append(warnings, fmt.Sprintf("ignoring unknown config key %q", key))
+			continue
+		}
+		field := value.Field(i)
+		if err := json.Unmarshal(raw[key], field.Addr().Interface()); err != nil {
+			field.Set(reflect.Zero(field.Type()))
+			problems = append(problems, fmt.Sprintf("config key %q must be %s", key, describeType(field.Type())))
+		}
+	}
+	if len(problems) > 0 {
+		return config, warnings, &ConfigError{Problems: problems}
+	}
+	return config, warnings, nil
+}
+
+// Describe a JSON syntax error with its line number
+func DescribeJSONError(data []byte, err error) error {
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+		return fmt.Errorf("config file is not valid JSON (line %d): %v", line, err)
+	}
+	return fmt.Errorf("config file must be a JSON object: %v", err)
+}
+
+// Describe the JSON type expected for a config field
+func describeType(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return t.String()
+}
+
+// A config file and the name config sources shows for it
+type ConfigLayer struct {
+	Name string
+	Path string
+}
+
+// Load config files in order, with each key in a later file overriding the
+// same key in earlier ones. Missing files are skipped. sources maps each
+// key that was set to the name of the layer that set it.
+func LoadLayeredConfig(layers []ConfigLayer) (config Config, sources map[string]string, warnings []string, err error) {
+	merged := map[string]json.RawMessage{}
+	sources = map[string]string{}
+	for _, layer := range layers {
+		data, err := os.ReadFile(layer.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return config, sources, warnings, err
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return config, sources, warnings, fmt.Errorf("%s: %v", layer.Path, DescribeJSONError(data, err))
+		}
+		for key, value := range raw {
+			merged[key] = value
+			sources[key] = layer.Name
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return config, sources, warnings, err
+	}
+	config, warnings, err = ParseConfig(data)
+	return config, sources, warnings, err
+}
@@ -0,0 +1,158 @@
+package aid
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, warnings, err := ParseConfig([]byte(`{
+  "model": "gpt-4o",
+  "temperature": 0.2,
+  "rate_limit_rpm": 10,
+  "allowed_commands": ["ls", "git"],
+  "keys": {"openai": "sk-test"}
+}`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+	if config.Model != "gpt-4o" || config.RateLimitRPM != 10 {
+		t.Errorf("model, rpm = %q, %d", config.Model, config.RateLimitRPM)
+	}
+	if config.Temperature == nil || *config.Temperature != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", config.Temperature)
+	}
+	if !reflect.DeepEqual(config.AllowedCommands, []string{"ls", "git"}) {
+		t.Errorf("allowed_commands = %v", config.AllowedCommands)
+	}
+	if got := config.Key("openai"); got != "sk-test" {
+		t.Errorf("Key(openai) = %q, want sk-test", got)
+	}
+}
+
+func TestParseConfigDefaults(t *testing.T) {
+	config, warnings, err := ParseConfig([]byte(`{}`))
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("ParseConfig: %v, warnings %v", err, warnings)
+	}
+	if !reflect.DeepEqual(config, Config{}) {
+		t.Errorf("config = %+v, want every setting unset", config)
+	}
+}
+
+func TestParseConfigLegacyKey(t *testing.T) {
+	config, warnings, err := ParseConfig([]byte(`{"OPENAI_API_KEY": "sk-legacy"}`))
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("ParseConfig: %v, warnings %v", err, warnings)
+	}
+	if got := config.Key("openai"); got != "sk-legacy" {
+		t.Errorf("Key(openai) = %q, want the legacy key", got)
+	}
+}
+
+func TestParseConfigUnknownKey(t *testing.T) {
+	config, warnings, err := ParseConfig([]byte(`{"modle": "gpt-4o", "model": "gpt-4o-mini"}`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"modle"`) {
+		t.Errorf("warnings = %v, want one naming modle", warnings)
+	}
+	if config.Model != "gpt-4o-mini" {
+		t.Errorf("model = %q, want gpt-4o-mini", config.Model)
+	}
+}
+
+func TestParseConfigInvalidValue(t *testing.T) {
+	config, _, err := ParseConfig([]byte(`{"rate_limit_rpm": "ten", "show_summary": 1, "model": "gpt-4o"}`))
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("err = %v, want a *ConfigError", err)
+	}
+	want := []string{
+		`config key "rate_limit_rpm" must be a number`,
+		`config key "show_summary" must be true or false`,
+	}
+	if !reflect.DeepEqual(configErr.Problems, want) {
+		t.Errorf("problems = %q, want %q", configErr.Problems, want)
+	}
+	// Valid keys are still applied and invalid ones left unset
+	if config.Model != "gpt-4o" || config.RateLimitRPM != 0 || config.ShowSummary {
+		t.Errorf("config = %+v", config)
+	}
+}
+
+func TestParseConfigSyntaxError(t *testing.T) {
+	_, _, err := ParseConfig([]byte("{\n  \"model\": \"gpt-4o\",\n}"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("err = %v, want one naming line 3", err)
+	}
+	_, _, err = ParseConfig([]byte(`["model"]`))
+	if err == nil || !strings.Contains(err.Error(), "must be a JSON object") {
+		t.Errorf("err = %v, want a JSON object error", err)
+	}
+}
+
+func TestConfigKeyLegacy(t *testing.T) {
+	config := Config{APIKey: "sk-legacy"}
+	if got := config.Key("openai"); got != "sk-legacy" {
+		t.Errorf("Key(openai) = %q, want the legacy key", got)
+	}
+	if got := config.Key("ollama"); got != "" {
+		t.Errorf("Key(ollama) = %q, want none", got)
+	}
+	config.SetKey("openai", "sk-new")
+	if config.APIKey != "" || config.Key("openai") != "sk-new" {
+		t.Errorf("after SetKey: %+v", config)
+	}
+}
+
+func TestLoadLayeredConfig(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.json")
+	user := filepath.Join(dir, "user.json")
+	writeFile(t, system, `{"model": "gpt-4o", "rate_limit_rpm": 5, "banner": "Managed"}`)
+	writeFile(t, user, `{"model": "gpt-4.1", "show_summary": true}`)
+
+	config, sources, warnings, err := LoadLayeredConfig([]ConfigLayer{
+		{Name: "system", Path: system},
+		{Name: "missing", Path: filepath.Join(dir, "missing.json")},
+		{Name: "user", Path: user},
+	})
+	if err != nil {
+		t.Fatalf("LoadLayeredConfig: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+	if config.Model != "gpt-4.1" || config.RateLimitRPM != 5 || !config.ShowSummary || config.Banner != "Managed" {
+		t.Errorf("config = %+v", config)
+	}
+	want := map[string]string{"model": "user", "rate_limit_rpm": "system", "banner": "system", "show_summary": "user"}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("sources = %v, want %v", sources, want)
+	}
+}
+
+func TestLoadLayeredConfigBadLayer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeFile(t, path, `{"model": }`)
+	_, _, _, err := LoadLayeredConfig([]ConfigLayer{{Name: "user", Path: path}})
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("err = %v, want one naming %s", err, path)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
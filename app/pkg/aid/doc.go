@@ -0,0 +1,5 @@
+// Package aid holds the reusable core of dingus-copilot: API providers and
+// the chat client, response caching, command history, config parsing, cost
+// and rate limiting, and the shell runner. The dingus-copilot command builds
+// its prompts, interactive flows and subcommands on top of it.
+package aid
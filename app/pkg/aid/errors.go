@@ -0,0 +1,36 @@
+package aid
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error categories returned by key loading and the Client, checkable with errors.Is
+var (
+	ErrAPIKeyMissing = errors.New("API key not found")
+	ErrAPIKeyInvalid = errors.New("API key is invalid")
+	ErrRateLimited   = errors.New("rate limited by the API")
+	ErrLimitReached  = errors.New("client rate limit reached")
+	ErrModelRefused  = errors.New("model returned no usable answer")
+	ErrNetwork       = errors.New("network error")
+	ErrConnDropped   = errors.New("connection dropped before the response was complete")
+	ErrAPI           = errors.New("API error")
+)
+
+// An error from the API client that carries its category and the HTTP details
+type APIError struct {
+	Kind       error // One of the Err* categories above
+	StatusCode int   // HTTP status, 0 when no response was received
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Kind, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
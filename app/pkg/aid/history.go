@@ -0,0 +1,268 @@
+package aid
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Command history tracking, persisted between runs in a JSON file.
+// The zero value is ready to use with the default limits and real clock.
+type CommandHistory struct {
+	Entries  []HistoryEntry
+	MaxSize  int              // Entries kept, DefaultHistorySize when 0
+	MaxWords int              // Output words kept per entry, DefaultHistoryWords when 0
+	MinWords int              // Output with fewer words is stored as empty
+	MaxAge   time.Duration    // Older entries are left out of the prompt, 0 keeps all
+	Format   string           // How entries are embedded in the prompt, one of HistoryFormats
+	Dedup    bool             // A command repeating the last one updates it instead of adding an entry
+	Now      func() time.Time // Defaults to time.Now when nil
+}
+
+// Limits used by NewCommandHistory and in place of zero values
+const (
+	DefaultHistorySize  = 8
+	DefaultHistoryWords = 160
+)
+
+// Create an empty history with the default limits and the real clock
+func NewCommandHistory() *CommandHistory {
+	return &CommandHistory{
+		Entries:  []HistoryEntry{},
+		MaxSize:  DefaultHistorySize,
+		MaxWords: DefaultHistoryWords,
+		Now:      time.Now,
+	}
+}
+
+// The current time from Now, or the real clock
+func (h *CommandHistory) now() time.Time {
+	if h.Now == nil {
+		return time.Now()
+	}
+	return h.Now()
+}
+
+// MaxSize, or the default when it is unset
+func (h *CommandHistory) maxSize() int {
+	if h.MaxSize <= 0 {
+		return DefaultHistorySize
+	}
+	return h.MaxSize
+}
+
+// MaxWords, or the default when it is unset
+func (h *CommandHistory) maxWords() int {
+	if h.MaxWords <= 0 {
+		return DefaultHistoryWords
+	}
+	return h.MaxWords
+}
+
+type HistoryEntry struct {
+	Query   string    `json:"query,omitempty"`
+	Command string    `json:"command"`
+	Output  string    `json:"output"`
+	Time    time.Time `json:"time"`
+	Pinned  bool      `json:"pinned,omitempty"` // Kept in the prompt however old it is
+}
+
+// Ways of embedding history in the prompt, selected with history_format
+const (
+	HistoryFormatVerbose = "verbose" // Numbered COMMAND/OUTPUT blocks
+	HistoryFormatCompact = "compact" // Shell transcript lines
+	HistoryFormatChat    = "chat"    // User/Assistant turns including the query
+)
+
+// All history formats, for validating history_format
+var HistoryFormats = []string{HistoryFormatVerbose, HistoryFormatCompact, HistoryFormatChat}
+
+// Stored in place of output that isn't valid UTF-8 text
+const BinaryOutputPlaceholder = "[binary output omitted]"
+
+// Add query, command and its output to history
+func (h *CommandHistory) Add(query, command, output string) {
+	// Binary output is meaningless as context and can break the API request
+	if !utf8.ValidString(output) || strings.ContainsRune(output, 0) {
+		output = BinaryOutputPlaceholder
+	}
+
+	// Colour codes only waste tokens and confuse the model
+	output = StripANSI(output)
+
+	// Drop trivial output but keep the command for continuity, then
+	// trim output to max words
+	words := strings.Fields(output)
+	if len(words) < h.MinWords {
+		output = ""
+	} else if len(words) > h.maxWords() {
+		words = words[len(words)-h.maxWords():]
+		output = strings.Join(words, " ")
+	}
+
+	// Create new entry
+	entry := HistoryEntry{
+		Query:   query,
+		Command: command,
+		Output:  output,
+		Time:    h.now(),
+	}
+
+	// Re-running the last command only refreshes its output
+	if last := len(h.Entries) - 1; h.Dedup && last >= 0 && h.Entries[last].Command == command {
+		if entry.Query == "" {
+			entry.Query = h.Entries[last].Query
+		}
+		entry.Pinned = h.Entries[last].Pinned
+		h.Entries[last] = entry
+		return
+	}
+
+	// Add to history, keeping only the most recent MaxSize entries
+	h.Entries = TrimHistory(append(h.Entries, entry), h.maxSize())
+}
+
+// Leave out the n oldest entries, dropping unpinned entries before any
+// pinned one
+func DropOldest(entries []HistoryEntry, n int) []HistoryEntry {
+	dropped := map[int]bool{}
+	for _, pinned := range []bool{false, true} {
+		for i := 0; i < len(entries) && len(dropped) < n; i++ {
+			if entries[i].Pinned == pinned {
+				dropped[i] = true
+			}
+		}
+	}
+	kept := []HistoryEntry{}
+	for i, entry := range entries {
+		if !dropped[i] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// Cut entries down to the most recent n by dropping the oldest unpinned
+// ones. Pinned entries are always kept, even when they number more than n.
+func TrimHistory(entries []HistoryEntry, n int) []HistoryEntry {
+	unpinned := 0
+	for _, entry := range entries {
+		if !entry.Pinned {
+			unpinned++
+		}
+	}
+	excess := len(entries) - n
+	if excess <= 0 {
+		return entries
+	}
+	if excess > unpinned {
+		excess = unpinned
+	}
+	return DropOldest(entries, excess)
+}
+
+// Matches ANSI CSI sequences (colours, cursor movement), OSC sequences
+// (titles, hyperlinks) and other two-character escapes
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// Remove ANSI escape sequences, keeping the text they decorate
+func StripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// Load history entries saved by previous runs
+func (h *CommandHistory) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var entries []HistoryEntry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return fmt.Errorf("failed to parse history file: %v", err)
+	}
+	h.Entries = TrimHistory(entries, h.maxSize())
+	return nil
+}
+
+// Save history entries for future runs
+func (h *CommandHistory) Save(path string) error {
+	data, err := json.MarshalIndent(h.Entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data, 0600)
+}
+
+// Add an entry and persist it, re-reading the file under a lock so
+// entries written by concurrent processes are not lost
+func (h *CommandHistory) Record(path, query, command, output string) error {
+	return WithFileLock(path, func() error {
+		if err := h.Load(path); err != nil {
+			return err
+		}
+		h.Add(query, command, output)
+		return h.Save(path)
+	})
+}
+
+// Pin or unpin the entry at index and persist the change, re-reading the
+// file under a lock like Record
+func (h *CommandHistory) SetPinned(path string, index int, pinned bool) error {
+	return WithFileLock(path, func() error {
+		if err := h.Load(path); err != nil {
+			return err
+		}
+		if index < 0 || index >= len(h.Entries) {
+			return fmt.Errorf("no history entry %d", index+1)
+		}
+		h.Entries[index].Pinned = pinned
+		return h.Save(path)
+	})
+}
+
+// Get history context as formatted string for the prompt
+func (h *CommandHistory) GetContext() string {
+	// Entries saved before timestamps were recorded have an unknown age and
+	// are kept, as are pinned entries
+	var entries []HistoryEntry
+	for _, entry := range h.Entries {
+		if h.MaxAge > 0 && !entry.Pinned && !entry.Time.IsZero() && h.now().Sub(entry.Time) > h.MaxAge {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+
+	var context strings.Builder
+	context.WriteString("\n\nRecent command history (for context):\n")
+
+	for i, entry := range entries {
+		switch h.Format {
+		case HistoryFormatCompact:
+			context.WriteString(fmt.Sprintf("$ %s\n", entry.Command))
+			if entry.Output != "" {
+				context.WriteString(entry.Output + "\n")
+			}
+		case HistoryFormatChat:
+			if entry.Query != "" {
+				context.WriteString(fmt.Sprintf("\nUser: %s", entry.Query))
+			}
+			context.WriteString(fmt.Sprintf("\nAssistant: %s\nOutput: %s\n", entry.Command, entry.Output))
+		default:
+			context.WriteString(fmt.Sprintf("\nCOMMAND %d: %s\nOUTPUT %d: %s\n",
+				i+1, entry.Command, i+1, entry.Output))
+		}
+	}
+
+	return context.String()
+}
@@ -0,0 +1,261 @@
+package aid
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestHistory() *CommandHistory {
+	return &CommandHistory{MaxSize: 3, MaxWords: 5, Now: func() time.Time { return testTime }}
+}
+
+func commands(entries []HistoryEntry) []string {
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Command)
+	}
+	return names
+}
+
+func TestHistoryAdd(t *testing.T) {
+	h := newTestHistory()
+	for _, command := range []string{"one", "two", "three", "four"} {
+		h.Add("q "+command, command, "")
+	}
+	if got := strings.Join(commands(h.Entries), " "); got != "two three four" {
+		t.Errorf("entries = %s, want the last three", got)
+	}
+	if !h.Entries[0].Time.Equal(testTime) {
+		t.Errorf("time = %v, want %v", h.Entries[0].Time, testTime)
+	}
+}
+
+func TestHistoryZeroValue(t *testing.T) {
+	for name, h := range map[string]*CommandHistory{"zero value": {}, "NewCommandHistory": NewCommandHistory()} {
+		long := strings.Repeat("word ", DefaultHistoryWords+10)
+		for i := 0; i < DefaultHistorySize+2; i++ {
+			h.Add("query", fmt.Sprintf("cmd%d", i), long)
+		}
+		if len(h.Entries) != DefaultHistorySize || h.Entries[0].Command != "cmd2" {
+			t.Errorf("%s: kept %v, want the last %d", name, commands(h.Entries), DefaultHistorySize)
+		}
+		last := h.Entries[len(h.Entries)-1]
+		if words := len(strings.Fields(last.Output)); words != DefaultHistoryWords {
+			t.Errorf("%s: kept %d output words, want %d", name, words, DefaultHistoryWords)
+		}
+		if last.Time.IsZero() {
+			t.Errorf("%s: entry has no time", name)
+		}
+		h.MaxAge = time.Hour
+		if !strings.Contains(h.GetContext(), "cmd9") {
+			t.Errorf("%s: context lost recent entries", name)
+		}
+	}
+}
+
+func TestHistoryAddOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		minWords int
+		output   string
+		want     string
+	}{
+		{"keeps the last words", 0, "a b c d e f g", "c d e f g"},
+		{"strips colours", 0, "\x1b[31mred\x1b[0m text", "red text"},
+		{"replaces binary", 0, "bin\x00ary", BinaryOutputPlaceholder},
+		{"replaces invalid UTF-8", 0, "\xff\xfe", BinaryOutputPlaceholder},
+		{"drops trivial output", 3, "ok", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHistory()
+			h.MinWords = tt.minWords
+			h.Add("", "cmd", tt.output)
+			if got := h.Entries[0].Output; got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"ls colours", "\x1b[0m\x1b[01;34mbuild\x1b[0m  main.go", "build  main.go"},
+		{"grep match", "foo \x1b[01;31m\x1b[Kbar\x1b[m\x1b[K baz", "foo bar baz"},
+		{"cursor movement", "\x1b[2K\x1b[1Gdone", "done"},
+		{"hyperlink", "\x1b]8;;https://example.com\x07link\x1b]8;;\x07", "link"},
+		{"title", "\x1b]0;title\x1b\\text", "text"},
+		{"plain text", "no escapes [here]", "no escapes [here]"},
+	}
+	for _, tt := range tests {
+		if got := StripANSI(tt.in); got != tt.want {
+			t.Errorf("%s: StripANSI = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryAddDedup(t *testing.T) {
+	h := newTestHistory()
+	h.Dedup = true
+	h.Add("list files", "ls", "a")
+	h.Entries[0].Pinned = true
+	h.Add("", "ls", "a b")
+	if len(h.Entries) != 1 {
+		t.Fatalf("entries = %v, want one", commands(h.Entries))
+	}
+	entry := h.Entries[0]
+	if entry.Output != "a b" || entry.Query != "list files" || !entry.Pinned {
+		t.Errorf("entry = %+v, want refreshed output with the query and pin kept", entry)
+	}
+	h.Add("", "pwd", "")
+	h.Add("", "ls", "")
+	if got := strings.Join(commands(h.Entries), " "); got != "ls pwd ls" {
+		t.Errorf("entries = %s, want a repeat after another command kept", got)
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	entries := []HistoryEntry{
+		{Command: "a", Pinned: true},
+		{Command: "b"},
+		{Command: "c", Pinned: true},
+		{Command: "d"},
+		{Command: "e"},
+	}
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{5, "a b c d e"},
+		{10, "a b c d e"},
+		{4, "a c d e"},
+		{3, "a c e"},
+		{1, "a c"},
+		{0, "a c"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(commands(TrimHistory(entries, tt.n)), " "); got != tt.want {
+			t.Errorf("TrimHistory(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	entries := []HistoryEntry{{Command: "a", Pinned: true}, {Command: "b"}, {Command: "c"}}
+	if got := strings.Join(commands(DropOldest(entries, 3)), " "); got != "" {
+		t.Errorf("DropOldest(3) = %s, want nothing", got)
+	}
+	if got := strings.Join(commands(DropOldest(entries, 2)), " "); got != "a" {
+		t.Errorf("DropOldest(2) = %s, want the pinned entry last", got)
+	}
+}
+
+func TestHistoryGetContext(t *testing.T) {
+	h := newTestHistory()
+	h.Entries = []HistoryEntry{
+		{Query: "where am I", Command: "pwd", Output: "/home"},
+		{Command: "ls", Output: ""},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{HistoryFormatVerbose, "\nCOMMAND 1: pwd\nOUTPUT 1: /home\n\nCOMMAND 2: ls\nOUTPUT 2: \n"},
+		{HistoryFormatCompact, "$ pwd\n/home\n$ ls\n"},
+		{HistoryFormatChat, "\nUser: where am I\nAssistant: pwd\nOutput: /home\n\nAssistant: ls\nOutput: \n"},
+	}
+	for _, tt := range tests {
+		h.Format = tt.format
+		want := "\n\nRecent command history (for context):\n" + tt.want
+		if got := h.GetContext(); got != want {
+			t.Errorf("%s context = %q, want %q", tt.format, got, want)
+		}
+	}
+
+	h.Entries = nil
+	if got := h.GetContext(); got != "" {
+		t.Errorf("empty context = %q, want none", got)
+	}
+}
+
+func TestHistoryGetContextMaxAge(t *testing.T) {
+	h := newTestHistory()
+	h.MaxAge = time.Hour
+	h.Entries = []HistoryEntry{
+		{Command: "old", Time: testTime.Add(-2 * time.Hour)},
+		{Command: "pinned", Time: testTime.Add(-2 * time.Hour), Pinned: true},
+		{Command: "undated"},
+		{Command: "recent", Time: testTime.Add(-time.Minute)},
+	}
+	got := h.GetContext()
+	if strings.Contains(got, "old") {
+		t.Errorf("context includes an expired entry: %q", got)
+	}
+	for _, command := range []string{"pinned", "undated", "recent"} {
+		if !strings.Contains(got, command) {
+			t.Errorf("context is missing %s: %q", command, got)
+		}
+	}
+}
+
+func TestHistoryRecordAndSetPinned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h := newTestHistory()
+	for _, command := range []string{"one", "two"} {
+		if err := h.Record(path, "", command, ""); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := h.SetPinned(path, 0, true); err != nil {
+		t.Fatalf("SetPinned: %v", err)
+	}
+	if err := h.SetPinned(path, 5, true); err == nil {
+		t.Error("SetPinned past the end succeeded")
+	}
+
+	loaded := newTestHistory()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := strings.Join(commands(loaded.Entries), " "); got != "one two" || !loaded.Entries[0].Pinned {
+		t.Errorf("loaded %+v, want one (pinned) and two", loaded.Entries)
+	}
+}
+
+func TestHistoryRecordConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate trackers stand in for separate processes
+			h := newTestHistory()
+			h.MaxSize = writers
+			if err := h.Record(path, "", fmt.Sprintf("echo %d", i), ""); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	loaded := newTestHistory()
+	loaded.MaxSize = writers
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Entries) != writers {
+		t.Errorf("history has %d entries, want %d", len(loaded.Entries), writers)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package aid
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Start the command in a new process group so signals can reach all its children
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Forward a signal to every process in the command's group
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	unixSig, ok := sig.(syscall.Signal)
+	if !ok {
+		unixSig = syscall.SIGINT
+	}
+	return syscall.Kill(-cmd.Process.Pid, unixSig)
+}
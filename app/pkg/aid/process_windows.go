@@ -0,0 +1,19 @@
+//go:build windows
+
+package aid
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Start the command in a new process group so console Ctrl+C isn't delivered twice
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// Windows cannot forward console signals to another group, so stop the command
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Kill()
+}
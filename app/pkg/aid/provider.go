@@ -0,0 +1,88 @@
+package aid
+
+import "fmt"
+
+// An API provider whose key is stored under its name in the config's keys map
+type Provider struct {
+	Name        string
+	DisplayName string
+	BaseURL     string
+	Prices      map[string]Price // Rates per model; unlisted models have unknown pricing
+	NoKey       bool             // The server accepts requests without an API key
+	Model       string           // Default model, falling back to DefaultModel when empty
+	Models      []string         // Models that can be picked inline with @model, any when empty
+}
+
+// A model's rates in dollars per million tokens
+type Price struct {
+	Input  float64 // Per million prompt tokens
+	Output float64 // Per million completion tokens
+}
+
+// Providers that can be selected with --provider or the provider config key
+var Providers = map[string]Provider{
+	"openai": {Name: "openai", DisplayName: "OpenAI", BaseURL: "https://api.openai.com/v1",
+		Prices: map[string]Price{
+			"gpt-4o-mini":  {Input: 0.15, Output: 0.60},
+			"gpt-4o":       {Input: 2.50, Output: 10.00},
+			"gpt-4.1":      {Input: 2.00, Output: 8.00},
+			"gpt-4.1-mini": {Input: 0.40, Output: 1.60},
+			"gpt-4.1-nano": {Input: 0.10, Output: 0.40},
+			"o3-mini":      {Input: 1.10, Output: 4.40},
+			"o4-mini":      {Input: 1.10, Output: 4.40},
+		},
+		Models: []string{"gpt-4o-mini", "gpt-4o", "gpt-4.1", "gpt-4.1-mini", "gpt-4.1-nano", "o3-mini", "o4-mini"}},
+	"ollama": {Name: "ollama", DisplayName: "Ollama", BaseURL: "http://localhost:11434/v1", NoKey: true, Model: "llama3.2"},
+}
+
+// Provider used when neither --provider nor the config sets one
+const DefaultProvider = "openai"
+
+// Model used when neither --model nor the config sets one
+const DefaultModel = "gpt-4o-mini"
+
+// Report whether the model's rates are known, so a cost can be shown.
+// Free providers such as local servers list no prices.
+func (p Provider) Priced(model string) bool {
+	_, ok := p.Prices[model]
+	return ok
+}
+
+// Report whether a model is one the provider is known to serve
+func (p Provider) KnowsModel(model string) bool {
+	if len(p.Models) == 0 {
+		return true
+	}
+	for _, known := range p.Models {
+		if known == model {
+			return true
+		}
+	}
+	return false
+}
+
+// Format a cost in dollars for display. Human formatting rounds to the
+// cent from a cent upwards, uses four places below that and shows costs
+// too small for those as "< $0.0001". Otherwise six places are shown.
+func FormatCost(cost float64, human bool) string {
+	switch {
+	case !human:
+		return fmt.Sprintf("$%.6f", cost)
+	case cost == 0:
+		return "$0.00"
+	case cost < 0.0001:
+		return "< $0.0001"
+	case cost < 0.01:
+		return fmt.Sprintf("$%.4f", cost)
+	default:
+		return fmt.Sprintf("$%.2f", cost)
+	}
+}
+
+// Calculate the cost of an API call at the model's rates, 0 when they are unknown
+func (p Provider) Cost(model string, promptTokens, completionTokens int) float64 {
+	price := p.Prices[model]
+	promptCost := float64(promptTokens) * price.Input / 1_000_000
+	completionCost := float64(completionTokens) * price.Output / 1_000_000
+	return promptCost + completionCost
+}
@@ -0,0 +1,67 @@
+package aid
+
+import "testing"
+
+func TestFormatCost(t *testing.T) {
+	tests := []struct {
+		cost  float64
+		human bool
+		want  string
+	}{
+		{0.000123, false, "$0.000123"},
+		{0, false, "$0.000000"},
+		{0, true, "$0.00"},
+		{0.00005, true, "< $0.0001"},
+		{0.0001, true, "$0.0001"},
+		{0.00456, true, "$0.0046"},
+		{0.01, true, "$0.01"},
+		{1.234, true, "$1.23"},
+	}
+	for _, tt := range tests {
+		if got := FormatCost(tt.cost, tt.human); got != tt.want {
+			t.Errorf("FormatCost(%v, %v) = %q, want %q", tt.cost, tt.human, got, tt.want)
+		}
+	}
+}
+
+func TestProviderCost(t *testing.T) {
+	openai := Providers["openai"]
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"gpt-4o-mini", 0.75},
+		{"gpt-4o", 12.50},
+		{"gpt-4.1-nano", 0.50},
+	}
+	for _, tt := range tests {
+		if got := openai.Cost(tt.model, 1_000_000, 1_000_000); got != tt.want {
+			t.Errorf("Cost(%s) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+	if openai.Priced("gpt-9000") || openai.Cost("gpt-9000", 1000, 1000) != 0 {
+		t.Error("a model without listed prices should have no cost")
+	}
+	if ollama := Providers["ollama"]; ollama.Priced("llama3.2") || ollama.Cost("llama3.2", 1000, 1000) != 0 {
+		t.Error("ollama should be free")
+	}
+}
+
+func TestPricesForKnownModels(t *testing.T) {
+	for name, provider := range Providers {
+		for _, model := range provider.Models {
+			if !provider.Priced(model) {
+				t.Errorf("%s model %s has no prices", name, model)
+			}
+		}
+	}
+}
+
+func TestKnowsModel(t *testing.T) {
+	if !Providers["openai"].KnowsModel("gpt-4o") || Providers["openai"].KnowsModel("llama3.2") {
+		t.Error("openai should know only its listed models")
+	}
+	if !Providers["ollama"].KnowsModel("anything") {
+		t.Error("ollama lists no models, so should accept any")
+	}
+}
@@ -0,0 +1,94 @@
+package aid
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Client-side token bucket limiting API requests per minute across runs
+type RateLimiter struct {
+	RPM   int
+	Path  string
+	Now   func() time.Time
+	Sleep func(time.Duration)
+	// Called before sleeping for a token when non-nil
+	OnWait func(time.Duration)
+}
+
+// Bucket state persisted between separate invocations
+type rateLimitState struct {
+	Tokens     float64   `json:"tokens"`
+	LastRefill time.Time `json:"last_refill"`
+}
+
+// Create a rate limiter using the real clock
+func NewRateLimiter(rpm int, path string) *RateLimiter {
+	return &RateLimiter{
+		RPM:   rpm,
+		Path:  path,
+		Now:   time.Now,
+		Sleep: time.Sleep,
+	}
+}
+
+// Take a token from the bucket, waiting for one to refill unless wait is false
+func (r *RateLimiter) Acquire(wait bool) error {
+	if r.RPM <= 0 {
+		return nil
+	}
+	capacity := float64(r.RPM)
+	perSecond := capacity / 60
+
+	// Reserve a token under the lock, then sleep outside it so other
+	// processes can queue up behind this one
+	var delay time.Duration
+	err := WithFileLock(r.Path, func() error {
+		now := r.Now()
+		state := rateLimitState{Tokens: capacity, LastRefill: now}
+		if data, err := os.ReadFile(r.Path); err == nil {
+			// A corrupt state file just resets the bucket
+			if json.Unmarshal(data, &state) != nil {
+				state = rateLimitState{Tokens: capacity, LastRefill: now}
+			}
+		}
+
+		// Refill for the time elapsed since the last request
+		if now.After(state.LastRefill) {
+			state.Tokens += now.Sub(state.LastRefill).Seconds() * perSecond
+			state.LastRefill = now
+		}
+		if state.Tokens > capacity {
+			state.Tokens = capacity
+		}
+
+		// When empty, the next token becomes available in the future
+		if state.Tokens < 1 {
+			state.LastRefill = state.LastRefill.Add(time.Duration((1 - state.Tokens) / perSecond * float64(time.Second)))
+			state.Tokens = 1
+		}
+		delay = state.LastRefill.Sub(now)
+		if delay > 0 && !wait {
+			return fmt.Errorf("%w: %d requests per minute, retry in %s", ErrLimitReached, r.RPM, delay.Round(time.Second))
+		}
+		state.Tokens--
+
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		return WriteFileAtomic(r.Path, data, 0600)
+	})
+	if err != nil {
+		return err
+	}
+
+	if delay > 0 {
+		if r.OnWait != nil {
+			r.OnWait(delay)
+		}
+		r.Sleep(delay)
+	}
+	return nil
+}
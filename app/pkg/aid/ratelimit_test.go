@@ -0,0 +1,112 @@
+package aid
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A rate limiter on a fake clock that records how long it slept
+func newTestLimiter(t *testing.T, rpm int) (*RateLimiter, *time.Time, *[]time.Duration) {
+	now := testTime
+	var slept []time.Duration
+	limiter := NewRateLimiter(rpm, filepath.Join(t.TempDir(), "ratelimit.json"))
+	limiter.Now = func() time.Time { return now }
+	limiter.Sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+	return limiter, &now, &slept
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter, _, slept := newTestLimiter(t, 3)
+	for i := 0; i < 3; i++ {
+		if err := limiter.Acquire(true); err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+	}
+	if len(*slept) != 0 {
+		t.Errorf("slept %v within the burst", *slept)
+	}
+
+	var waited time.Duration
+	limiter.OnWait = func(d time.Duration) { waited = d }
+	if err := limiter.Acquire(true); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if want := 20 * time.Second; len(*slept) != 1 || (*slept)[0] != want || waited != want {
+		t.Errorf("slept %v, OnWait %v, want %v for one token at 3 per minute", *slept, waited, want)
+	}
+}
+
+func TestRateLimiterNoWait(t *testing.T) {
+	limiter, _, slept := newTestLimiter(t, 1)
+	if err := limiter.Acquire(false); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	err := limiter.Acquire(false)
+	if !errors.Is(err, ErrLimitReached) || !strings.Contains(err.Error(), "retry in 1m0s") {
+		t.Errorf("err = %v, want ErrLimitReached with a retry in 1m0s", err)
+	}
+	if len(*slept) != 0 {
+		t.Errorf("slept %v without waiting", *slept)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter, now, slept := newTestLimiter(t, 2)
+	for i := 0; i < 2; i++ {
+		if err := limiter.Acquire(false); err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+	}
+	*now = now.Add(30 * time.Second)
+	if err := limiter.Acquire(false); err != nil {
+		t.Errorf("Acquire after refilling one token: %v", err)
+	}
+	if err := limiter.Acquire(false); err == nil {
+		t.Error("Acquire succeeded with an empty bucket")
+	}
+	if len(*slept) != 0 {
+		t.Errorf("slept %v", *slept)
+	}
+}
+
+func TestRateLimiterSharedState(t *testing.T) {
+	first, now, _ := newTestLimiter(t, 1)
+	if err := first.Acquire(false); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	// A second process reads the bucket the first left behind
+	second := NewRateLimiter(1, first.Path)
+	second.Now = func() time.Time { return *now }
+	if err := second.Acquire(false); err == nil {
+		t.Error("second limiter ignored the saved state")
+	}
+}
+
+func TestRateLimiterCorruptState(t *testing.T) {
+	limiter, _, _ := newTestLimiter(t, 1)
+	if err := os.WriteFile(limiter.Path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Acquire(false); err != nil {
+		t.Errorf("Acquire with a corrupt state file: %v", err)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter, _, _ := newTestLimiter(t, 0)
+	for i := 0; i < 5; i++ {
+		if err := limiter.Acquire(false); err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	}
+	if _, err := os.Stat(limiter.Path); !os.IsNotExist(err) {
+		t.Errorf("a disabled limiter wrote its state file (%v)", err)
+	}
+}
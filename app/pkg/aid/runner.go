@@ -0,0 +1,181 @@
+package aid
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Shell used to run suggested commands
+type Shell struct {
+	Name string   // Name given to the model in the prompt
+	Path string   // Interpreter executable
+	Args []string // Arguments placed before the command
+	Dir  string   // Working directory, the current one when empty
+}
+
+// Select the interpreter for the given operating system
+func SelectShell(goos string) Shell {
+	if goos == "windows" {
+		return Shell{Name: "PowerShell", Path: "powershell", Args: []string{"-NoProfile", "-Command"}}
+	}
+	return Shell{Name: "bash", Path: "bash", Args: []string{"-c"}}
+}
+
+// Build the command that runs a suggestion with the given shell
+func (s Shell) Command(command string) *exec.Cmd {
+	args := append(append([]string{}, s.Args...), command)
+	cmd := exec.Command(s.Path, args...)
+	cmd.Dir = s.Dir
+	return cmd
+}
+
+// Wrap the shell in unshare so commands run in a new network namespace
+// with no interfaces but loopback. A user namespace is created too, so no
+// root access is needed.
+func (s Shell) WithoutNetwork(unshare string) Shell {
+	args := append([]string{"--user", "--map-root-user", "--net", s.Path}, s.Args...)
+	return Shell{Name: s.Name, Path: unshare, Args: args, Dir: s.Dir}
+}
+
+// Run a command in its own process group, forwarding Ctrl+C and
+// SIGTERM to it and waiting for it to exit so output collected before
+// an interrupt is still returned. Output is also copied to live as it
+// arrives when live is non-nil. onInterrupt, when non-nil, is called
+// with the result of forwarding each signal.
+func (s Shell) Run(command string, live io.Writer, onInterrupt func(error)) (string, error) {
+	var output bytes.Buffer
+	var sink io.Writer = &output
+	if live != nil {
+		sink = io.MultiWriter(&output, live)
+	}
+	// One writer for both streams keeps stdout and stderr in order
+	err := s.run(command, sink, sink, onInterrupt)
+	return output.String(), err
+}
+
+// Run a command like Run, capturing stdout and stderr separately. Each
+// stream is also copied to its live writer when that is non-nil. The
+// streams are copied concurrently, so live writes are serialised in case
+// both live writers share one terminal.
+func (s Shell) RunSeparate(command string, liveOut, liveErr io.Writer, onInterrupt func(error)) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	var outSink, errSink io.Writer = &stdout, &stderr
+	var mu sync.Mutex
+	if liveOut != nil {
+		outSink = io.MultiWriter(&stdout, &lockedWriter{mu: &mu, w: liveOut})
+	}
+	if liveErr != nil {
+		errSink = io.MultiWriter(&stderr, &lockedWriter{mu: &mu, w: liveErr})
+	}
+	err := s.run(command, outSink, errSink, onInterrupt)
+	return stdout.String(), stderr.String(), err
+}
+
+// Returned by Run and RunSeparate when Ctrl+C or SIGTERM was forwarded
+// to the command before it exited, wrapping the command's own error
+type InterruptedError struct {
+	Err error
+}
+
+func (e *InterruptedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Writes to w while holding mu
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Start a command writing to stdout and stderr and wait for it, forwarding
+// signals to its process group
+func (s Shell) run(command string, stdout, stderr io.Writer, onInterrupt func(error)) error {
+	cmd := s.Command(command)
+	// Stdin is left unset so the command reads /dev/null instead of
+	// waiting on the terminal
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	interrupted := false
+	for {
+		select {
+		case sig := <-signals:
+			interrupted = true
+			err := signalProcessGroup(cmd, sig)
+			if onInterrupt != nil {
+				onInterrupt(err)
+			}
+		case err := <-done:
+			if interrupted && err != nil {
+				return &InterruptedError{Err: err}
+			}
+			return err
+		}
+	}
+}
+
+// Run an interactive command attached to the terminal's stdin, stdout
+// and stderr. Ctrl+C reaches the command directly, so it is caught and
+// dropped here rather than ending this process while the command runs.
+func (s Shell) RunAttached(command string) error {
+	cmd := s.Command(command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	return cmd.Run()
+}
+
+// Keep only the first head and/or last tail lines of output
+func LimitLines(output string, head, tail int) string {
+	if head <= 0 && tail <= 0 {
+		return output
+	}
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	total := len(lines)
+	if head < 0 {
+		head = 0
+	}
+	if tail < 0 {
+		tail = 0
+	}
+	if head+tail >= total {
+		return output
+	}
+
+	kept := append([]string{}, lines[:head]...)
+	kept = append(kept, fmt.Sprintf("... %d lines omitted ...", total-head-tail))
+	kept = append(kept, lines[total-tail:]...)
+	return strings.Join(kept, "\n") + "\n"
+}
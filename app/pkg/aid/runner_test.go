@@ -0,0 +1,101 @@
+package aid
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSelectShell(t *testing.T) {
+	tests := []struct {
+		goos string
+		name string
+		argv []string
+	}{
+		{"windows", "PowerShell", []string{"powershell", "-NoProfile", "-Command", "Get-ChildItem"}},
+		{"linux", "bash", []string{"bash", "-c", "Get-ChildItem"}},
+		{"darwin", "bash", []string{"bash", "-c", "Get-ChildItem"}},
+	}
+	for _, tt := range tests {
+		shell := SelectShell(tt.goos)
+		if shell.Name != tt.name {
+			t.Errorf("%s: name = %q, want %q", tt.goos, shell.Name, tt.name)
+		}
+		cmd := shell.Command("Get-ChildItem")
+		if !reflect.DeepEqual(cmd.Args, tt.argv) {
+			t.Errorf("%s: argv = %q, want %q", tt.goos, cmd.Args, tt.argv)
+		}
+	}
+}
+
+func TestShellRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash syntax")
+	}
+	output, err := SelectShell(runtime.GOOS).Run("echo out; echo err >&2", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "out\nerr\n" {
+		t.Errorf("output = %q, want both streams in order", output)
+	}
+}
+
+func TestShellRunSeparate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash syntax")
+	}
+	var liveOut, liveErr bytes.Buffer
+	stdout, stderr, err := SelectShell(runtime.GOOS).RunSeparate("echo out; echo err >&2; echo more; exit 2", &liveOut, &liveErr, nil)
+	if err == nil {
+		t.Error("err = nil, want the exit status")
+	}
+	if stdout != "out\nmore\n" || stderr != "err\n" {
+		t.Errorf("stdout = %q, stderr = %q, want the streams apart", stdout, stderr)
+	}
+	if liveOut.String() != stdout || liveErr.String() != stderr {
+		t.Errorf("live = %q and %q, want each stream copied", liveOut.String(), liveErr.String())
+	}
+
+	stdout, stderr, err = SelectShell(runtime.GOOS).RunSeparate("echo only", nil, nil, nil)
+	if err != nil || stdout != "only\n" || stderr != "" {
+		t.Errorf("without live writers = %q, %q, %v", stdout, stderr, err)
+	}
+}
+
+func TestShellRunStreams(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash syntax")
+	}
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	var output string
+	var err error
+	go func() {
+		defer close(done)
+		defer writer.Close()
+		output, err = SelectShell(runtime.GOOS).Run("echo one; sleep 1; echo two", writer, nil)
+	}()
+
+	lines := bufio.NewScanner(reader)
+	if !lines.Scan() || lines.Text() != "one" {
+		t.Fatalf("first line = %q, want one", lines.Text())
+	}
+	select {
+	case <-done:
+		t.Fatal("first line arrived only after the command finished")
+	default:
+	}
+	for lines.Scan() {
+	}
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "one\ntwo\n" {
+		t.Errorf("output = %q, want both lines captured", output)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+
+package aid
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Calls onWrite once, when the first output arrives
+type firstWrite struct {
+	once    sync.Once
+	onWrite func()
+}
+
+func (w *firstWrite) Write(p []byte) (int, error) {
+	w.once.Do(w.onWrite)
+	return len(p), nil
+}
+
+func TestShellRunInterrupted(t *testing.T) {
+	live := &firstWrite{onWrite: func() {
+		// Run is already relaying signals, so this does not stop the test
+		syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	}}
+	forwarded := make(chan error, 1)
+	done := make(chan struct{})
+	var output string
+	var err error
+	go func() {
+		defer close(done)
+		output, err = SelectShell("linux").Run("echo $$; sleep 30", live, func(err error) { forwarded <- err })
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("command still running after Ctrl+C")
+	}
+	if ferr := <-forwarded; ferr != nil {
+		t.Errorf("forwarding the signal failed: %v", ferr)
+	}
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) {
+		t.Errorf("err = %v, want an InterruptedError", err)
+	}
+
+	// The output printed before the interrupt is kept, and no process
+	// is left in the command's group
+	pid, perr := strconv.Atoi(strings.TrimSpace(output))
+	if perr != nil {
+		t.Fatalf("output = %q, want the shell's pid", output)
+	}
+	if kerr := syscall.Kill(-pid, 0); !errors.Is(kerr, syscall.ESRCH) {
+		t.Errorf("process group %d still exists (%v)", pid, kerr)
+	}
+}
@@ -0,0 +1,57 @@
+package aid
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Certificates for networks that intercept TLS or require client certificates
+type TLSFiles struct {
+	CACert     string // PEM bundle trusted alongside the system roots
+	ClientCert string // PEM client certificate for mutual TLS
+	ClientKey  string // PEM private key for ClientCert
+}
+
+// Report whether any certificate file is set
+func (f TLSFiles) Set() bool {
+	return f.CACert != "" || f.ClientCert != "" || f.ClientKey != ""
+}
+
+// Build a transport that trusts the CA bundle and presents the client
+// certificate, checking that each file exists and parses
+func NewTLSTransport(files TLSFiles) (*http.Transport, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if files.CACert != "" {
+		data, err := os.ReadFile(files.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_cert: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in ca_cert %s", files.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	if (files.ClientCert == "") != (files.ClientKey == "") {
+		return nil, fmt.Errorf("client_cert and client_key must be set together")
+	}
+	if files.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(files.ClientCert, files.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client_cert and client_key: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return transport, nil
+}
@@ -0,0 +1,106 @@
+package aid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write a self-signed certificate and its key as PEM files
+func writeCertPair(t *testing.T, dir string) (certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dingus test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writeFile(t, certPath, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeFile(t, keyPath, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+	return certPath, keyPath
+}
+
+func TestNewTLSTransportCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caPath, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+
+	transport, err := NewTLSTransport(TLSFiles{CACert: caPath})
+	if err != nil {
+		t.Fatalf("NewTLSTransport: %v", err)
+	}
+	if transport.TLSClientConfig.RootCAs == nil {
+		t.Fatal("RootCAs not set")
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the CA trusted: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := (&http.Client{}).Get(server.URL); err == nil {
+		t.Error("request without the CA succeeded")
+	}
+}
+
+func TestNewTLSTransportClientCert(t *testing.T) {
+	certPath, keyPath := writeCertPair(t, t.TempDir())
+	transport, err := NewTLSTransport(TLSFiles{ClientCert: certPath, ClientKey: keyPath})
+	if err != nil {
+		t.Fatalf("NewTLSTransport: %v", err)
+	}
+	if got := len(transport.TLSClientConfig.Certificates); got != 1 {
+		t.Errorf("%d client certificates, want 1", got)
+	}
+	if transport.TLSClientConfig.RootCAs != nil {
+		t.Error("RootCAs set without ca_cert, want the system roots")
+	}
+}
+
+func TestNewTLSTransportErrors(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCertPair(t, dir)
+	notPEM := filepath.Join(dir, "not.pem")
+	writeFile(t, notPEM, "not a certificate")
+	tests := []struct {
+		name  string
+		files TLSFiles
+		want  string
+	}{
+		{"missing ca_cert", TLSFiles{CACert: filepath.Join(dir, "missing.pem")}, "failed to read ca_cert"},
+		{"ca_cert without PEM", TLSFiles{CACert: notPEM}, "no PEM certificates found"},
+		{"cert without key", TLSFiles{ClientCert: certPath}, "must be set together"},
+		{"key without cert", TLSFiles{ClientKey: keyPath}, "must be set together"},
+		{"mismatched pair", TLSFiles{ClientCert: certPath, ClientKey: notPEM}, "failed to load client_cert and client_key"},
+	}
+	for _, tt := range tests {
+		if _, err := NewTLSTransport(tt.files); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
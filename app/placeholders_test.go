@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestFindPlaceholders(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"cp <source file> <dest>", []string{"<source file>", "<dest>"}},
+		{"tar -czf ARCHIVE.tar.gz DIR", []string{"ARCHIVE", "DIR"}},
+		{"grep PATTERN FILE && wc -l FILE", []string{"PATTERN", "FILE"}},
+		{"echo $HOME ${USER} --NAME=x", nil},
+		{"git reset --hard HEAD", nil},
+		{"curl -X POST <url>", []string{"<url>"}},
+		{"ls -la", nil},
+		{"docker run -e NODE_ENV=production node:20", nil},
+		{"env LANG=C sort names.txt", nil},
+		{`psql -c "SELECT name FROM users"`, nil},
+		{`grep -rn "TODO" .`, nil},
+		{`echo 'hello WORLD' > OUTFILE`, []string{"OUTFILE"}},
+		{`grep "<pattern>" FILE`, []string{"<pattern>", "FILE"}},
+	}
+	for _, tt := range tests {
+		if got := findPlaceholders(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findPlaceholders(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestFillPlaceholdersAndRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	e := newTestEnv(t, "cat <filename>")
+	if err := os.WriteFile(filepath.Join(e.dir, "notes.txt"), []byte("hello from notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result := e.run("y\nnotes.txt\n", "--replace-run", "show a file")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+	}
+	assertContains(t, result.stdout, "Value for <filename>", "cat notes.txt", "hello from notes")
+
+	entries := e.readHistory()
+	if len(entries) != 1 || entries[0].Command != "cat notes.txt" {
+		t.Errorf("history = %+v, want the filled command", entries)
+	}
+}
+
+func TestPlaceholdersNeedReplaceRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+	}{
+		{"without --replace-run", "y\n", []string{"say a word"}},
+		{"with --yes", "", []string{"--replace-run", "--yes", "say a word"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, "echo WORD")
+			result := e.run(tt.input, tt.args...)
+			if result.code != exitOK {
+				t.Fatalf("exit code = %d:\n%s%s", result.code, result.stdout, result.stderr)
+			}
+			assertNotContains(t, result.stdout, "Value for")
+			assertContains(t, result.stdout, "WORD")
+		})
+	}
+}
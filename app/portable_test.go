@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestPortableRule(t *testing.T) {
+	const rule = "Prefer POSIX-portable syntax"
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	e.writeConfig(`{"portable": true}`)
+	e.run("n\n", "list files")
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want two", len(e.api.requests))
+	}
+	assertNotContains(t, requestText(t, e.api.requests[0]), rule)
+	assertContains(t, requestText(t, e.api.requests[1]), rule)
+}
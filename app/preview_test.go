@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandPreview(t *testing.T) {
+	env := map[string]string{"HOME": "/home/me", "USER": "me", "DIR": "logs"}
+	getenv := func(key string) string { return env[key] }
+	tests := []struct {
+		command       string
+		want          string
+		substitutions []string
+	}{
+		{"ls $HOME", "ls /home/me", nil},
+		{"echo ${USER}/$DIR", "echo me/logs", nil},
+		{`echo "$USER"`, `echo "me"`, nil},
+		{"echo '$USER'", "echo '$USER'", nil},
+		{`echo \$USER`, `echo \$USER`, nil},
+		{"cd ~/src", "cd /home/me/src", nil},
+		{"echo $1 $UNSET.", "echo $1 .", nil},
+		{"rm -r $(ls -d $DIR)", "rm -r $(ls -d $DIR)", []string{"$(ls -d $DIR)"}},
+		{"echo `date` in $DIR", "echo `date` in logs", []string{"`date`"}},
+	}
+	for _, tt := range tests {
+		got, substitutions := expandPreview(tt.command, getenv)
+		if got != tt.want || !reflect.DeepEqual(substitutions, tt.substitutions) {
+			t.Errorf("expandPreview(%q) = %q, %q, want %q, %q", tt.command, got, substitutions, tt.want, tt.substitutions)
+		}
+	}
+}
+
+func TestPreviewKey(t *testing.T) {
+	e := newTestEnv(t, "tar czf $HOME/backup-$(date +%F).tgz .")
+	result := e.run("p\nn\n", "back up this directory")
+	assertContains(t, result.stdout,
+		"Expanded: tar czf "+e.home+"/backup-$(date +%F).tgz .",
+		"Not expanded: $(date +%F) runs only when the command runs.")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d after previewing and declining", result.code, exitDeclined)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestPromptTrimmedToBudget(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	base := countTokensApprox(e.api.prompts()[0])
+
+	var entries []aid.HistoryEntry
+	for i := 1; i <= 3; i++ {
+		// About 200 tokens each
+		entries = append(entries, aid.HistoryEntry{Command: fmt.Sprintf("make target-%d", i), Output: strings.Repeat("x", 800)})
+	}
+	e.writeHistory(entries...)
+	e.writeConfig(fmt.Sprintf(`{"max_prompt_tokens": %d}`, base+300))
+
+	result := e.run("n\n", "list files")
+	prompt := e.api.prompts()[1]
+	if countTokensApprox(prompt) > base+300 {
+		t.Errorf("prompt is %d tokens, over the budget of %d", countTokensApprox(prompt), base+300)
+	}
+	assertContains(t, prompt, "make target-3")
+	assertNotContains(t, prompt, "make target-1", "make target-2")
+	assertContains(t, result.stderr, fmt.Sprintf("Warning: the prompt was over %d tokens, so it leaves out the 2 oldest history entries.", base+300))
+	if got := len(e.readHistory()); got != 3 {
+		t.Errorf("history has %d entries, want all kept on disk", got)
+	}
+}
+
+func TestPromptDropsEnvironmentLast(t *testing.T) {
+	stubLookPath(t, "git")
+	e := newTestEnv(t, "ls")
+	e.writeHistory(aid.HistoryEntry{Command: "make all", Output: "done"})
+	e.writeConfig(`{"share_cwd": true, "max_prompt_tokens": 1}`)
+
+	result := e.run("n\n", "list files")
+	assertNotContains(t, e.api.prompts()[0], "make all", "These tools are installed")
+	assertContains(t, result.stderr, "leaves out the oldest history entry and the environment context.")
+}
+
+func TestPromptWithinBudget(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeHistory(aid.HistoryEntry{Command: "make all", Output: "done"})
+	result := e.run("n\n", "list files")
+	assertContains(t, e.api.prompts()[0], "make all")
+	assertNotContains(t, result.stderr, "Warning: the prompt was over")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestProviderKeys(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.env["OPENAI_API_KEY"] = ""
+	e.writeConfig(`{"keys": {"openai": "sk-openai", "ollama": "ollama-key"}}`)
+
+	e.run("n\n", "list files")
+	e.run("n\n", "--provider", "ollama", "list files")
+	if len(e.api.keys) != 2 || e.api.keys[0] != "sk-openai" || e.api.keys[1] != "ollama-key" {
+		t.Errorf("keys sent = %q, want each provider's own key", e.api.keys)
+	}
+}
+
+func TestPromptForSelectedProviderKey(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.env["OPENAI_API_KEY"] = ""
+	e.writeConfig(`{"keys": {"ollama": "ollama-key"}}`)
+
+	result := e.run("sk-entered\nn\n", "list files")
+	assertContains(t, result.stdout, "Enter your OpenAI API Key: ")
+	if len(e.api.keys) != 1 || e.api.keys[0] != "sk-entered" {
+		t.Errorf("keys sent = %q, want the entered key", e.api.keys)
+	}
+
+	data, err := os.ReadFile(e.configPath("config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct{ Keys map[string]string }
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Keys["openai"] != "sk-entered" || config.Keys["ollama"] != "ollama-key" {
+		t.Errorf("saved keys = %v, want both providers", config.Keys)
+	}
+}
+
+func TestLegacyKey(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.env["OPENAI_API_KEY"] = ""
+	e.writeConfig(`{"OPENAI_API_KEY": "sk-legacy"}`)
+	e.run("n\n", "list files")
+	if len(e.api.keys) != 1 || e.api.keys[0] != "sk-legacy" {
+		t.Errorf("keys sent = %q, want the legacy key", e.api.keys)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestRateLimitNoWait(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"rate_limit_rpm": 1}`)
+	if result := e.run("n\n", "--no-wait", "list files"); result.code != exitDeclined {
+		t.Fatalf("first query: exit code = %d\n%s", result.code, result.stderr)
+	}
+
+	result := e.run("n\n", "--no-wait", "list files")
+	if result.code != exitAPI {
+		t.Errorf("second query: exit code = %d, want %d", result.code, exitAPI)
+	}
+	assertContains(t, result.stderr, "client rate limit reached: 1 requests per minute")
+	if len(e.api.requests) != 1 {
+		t.Errorf("made %d API requests, want the second refused before sending", len(e.api.requests))
+	}
+}
+
+func TestRateLimitFollowUpRequests(t *testing.T) {
+	e := newTestEnv(t, "find . -name '*.log' -delete", "rm -f *.log")
+	e.writeConfig(`{"rate_limit_rpm": 1}`)
+	result := e.run("s\nn\n", "--no-wait", "delete the log files")
+	if len(e.api.requests) != 1 {
+		t.Errorf("made %d API requests, want the refinement held to the limit", len(e.api.requests))
+	}
+	assertContains(t, result.stdout, "client rate limit reached: 1 requests per minute")
+}
+
+func TestRateLimitDisabledByDefault(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	for i := 0; i < 3; i++ {
+		if result := e.run("n\n", "--no-wait", "list files"); result.code != exitDeclined {
+			t.Fatalf("query %d: exit code = %d\n%s", i+1, result.code, result.stderr)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestRawPrompt(t *testing.T) {
+	e := newTestEnv(t, "Sure! Try `ls -la`.\nIt lists hidden files too.")
+	e.writeHistory(aid.HistoryEntry{Query: "where am I", Command: "pwd", Output: "/home"})
+	result := e.run("", "--raw-prompt", "how do I list files?")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+
+	request := e.api.requests[0]
+	want := []interface{}{map[string]interface{}{"role": "user", "content": "how do I list files?"}}
+	if !reflect.DeepEqual(request["messages"], want) {
+		t.Errorf("messages = %v, want only the raw query", request["messages"])
+	}
+	if _, ok := request["tools"]; ok {
+		t.Errorf("request has tools: %v", request["tools"])
+	}
+
+	assertContains(t, result.stdout, "Sure! Try `ls -la`.\nIt lists hidden files too.\n")
+	assertNotContains(t, result.stdout, "Suggested command:", "Do you want to run this command?")
+	if entries := e.readHistory(); len(entries) != 1 {
+		t.Errorf("history = %+v, want it unchanged", entries)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestRecordOnCopy(t *testing.T) {
+	tests := []struct {
+		config  string
+		entries int
+	}{
+		{`{}`, 0},
+		{`{"record_on_copy": true}`, 1},
+	}
+	for _, tt := range tests {
+		// No clipboard tool, so the command is printed for copying
+		stubLookPath(t)
+		e := newTestEnv(t, "docker ps -a")
+		e.writeConfig(tt.config)
+		result := e.run("c\n", "list containers")
+		assertContains(t, result.stdout, "copy-me: docker ps -a")
+
+		entries := e.readHistory()
+		if len(entries) != tt.entries {
+			t.Fatalf("%s: history = %+v, want %d entries", tt.config, entries, tt.entries)
+		}
+		if tt.entries > 0 && (entries[0].Command != "docker ps -a" || entries[0].Output != "" || entries[0].Query != "list containers") {
+			t.Errorf("entry = %+v, want the copied command without output", entries[0])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactQuery(t *testing.T) {
+	const secret = "token=hunter2secret"
+	e := newTestEnv(t, "echo fetched")
+	e.writeConfig(`{"redact_query": true}`)
+	path := filepath.Join(e.dir, "prompt.txt")
+	e.run("y\n", "--save-prompt", path, "fetch the page with "+secret)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNotContains(t, string(data), "hunter2secret")
+	assertContains(t, string(data), "token=[REDACTED]")
+
+	entries := e.readHistory()
+	if len(entries) != 1 {
+		t.Fatalf("history = %+v, want one entry", entries)
+	}
+	assertNotContains(t, entries[0].Query, "hunter2secret")
+	assertContains(t, entries[0].Query, "token=[REDACTED]")
+
+	assertContains(t, requestText(t, e.api.requests[0]), secret)
+}
+
+func TestRedactQueryOff(t *testing.T) {
+	const secret = "token=hunter2secret"
+	e := newTestEnv(t, "echo fetched")
+	e.run("y\n", "fetch the page with "+secret)
+	if entries := e.readHistory(); len(entries) != 1 || entries[0].Query != "fetch the page with "+secret {
+		t.Errorf("history = %+v, want the query as typed", entries)
+	}
+}
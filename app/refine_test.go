@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRefineSimpler(t *testing.T) {
+	e := newTestEnv(t, "find . -type f -name '*.log' -print0 | xargs -0 rm -f", "rm -f *.log")
+	e.writeConfig(`{"cost_format": "raw"}`)
+	result := e.run("s\nn\n", "delete the log files")
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want a refinement", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[1], refinements["s"], "<COMMAND> find . -type f -name '*.log' -print0 | xargs -0 rm -f </COMMAND>", "delete the log files")
+	if _, structured := e.api.requests[1]["response_format"]; !structured {
+		t.Error("the refinement did not ask for a command")
+	}
+
+	// The refined command replaces the suggestion, and its cost adds to the total
+	one := calculateCost(100, 10)
+	assertContains(t, result.stdout, "Refined command: rm -f *.log",
+		fmt.Sprintf("Refinement cost: %s (total %s)", formatCost(one), formatCost(2*one)))
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+	}
+}
+
+func TestRefineMoreRobust(t *testing.T) {
+	e := newTestEnv(t, "rm *.log", "find . -maxdepth 1 -name '*.log' -exec rm -f -- {} +")
+	result := e.run("l\nn\n", "delete the log files")
+	assertContains(t, e.api.prompts()[1], refinements["l"])
+	assertContains(t, result.stdout, "Refined command: find . -maxdepth 1")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestRememberLast(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	e := newTestEnv(t, "echo first", "echo second")
+	e.writeConfig(`{"remember_last": true}`)
+	e.run("y\n", "say first")
+	e.run("y\n", "say second")
+
+	data, err := os.ReadFile(e.configPath("last.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []aid.HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Command != "echo second" {
+		t.Errorf("last.json = %+v, want only the last command", entries)
+	}
+	if _, err := os.Stat(e.configPath("history.json")); !os.IsNotExist(err) {
+		t.Errorf("history.json written in remember_last mode (%v)", err)
+	}
+	// The last command is still context for the next query
+	assertContains(t, e.api.prompts()[1], "echo first")
+
+	result := e.run("", "last")
+	assertContains(t, result.stdout, "echo second", "second")
+	assertNotContains(t, result.stdout, "echo first")
+}
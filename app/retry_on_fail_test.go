@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+// An *exec.ExitError from a real process exiting with code
+func exitError(t *testing.T, code int) error {
+	t.Helper()
+	err := aid.SelectShell(runtime.GOOS).Command(fmt.Sprintf("exit %d", code)).Run()
+	if err == nil {
+		t.Fatalf("exit %d succeeded", code)
+	}
+	return err
+}
+
+func TestRunWithRetries(t *testing.T) {
+	failure := exitError(t, 3)
+	tests := []struct {
+		name     string
+		retries  int
+		results  []error
+		wantRuns int
+		wantErr  error
+		wantOut  string
+	}{
+		{"fails twice then succeeds", 3, []error{failure, failure, nil}, 3, nil, "Succeeded on attempt 3."},
+		{"gives up", 2, []error{failure, failure, failure, nil}, 3, failure, "Failed after 3 attempts."},
+		{"no retries by default", 0, []error{failure, nil}, 1, failure, ""},
+		{"not started", 3, []error{errors.New("exec: not found"), nil}, 1, errors.New("exec: not found"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobals()
+			t.Cleanup(resetGlobals)
+			options.RetryOnFail = tt.retries
+
+			runs := 0
+			run := func(command string, live io.Writer) (string, string, error) {
+				err := tt.results[runs]
+				runs++
+				return fmt.Sprintf("attempt %d", runs), "", err
+			}
+			var slept []time.Duration
+			sleep := func(d time.Duration) { slept = append(slept, d) }
+
+			var output string
+			var err error
+			out := captureStdout(t, func() {
+				output, _, err = runWithRetries("flaky", io.Discard, run, sleep)
+			})
+			if runs != tt.wantRuns || len(slept) != tt.wantRuns-1 {
+				t.Errorf("ran %d times, slept %v, want %d runs", runs, slept, tt.wantRuns)
+			}
+			if fmt.Sprint(err) != fmt.Sprint(tt.wantErr) || output != fmt.Sprintf("attempt %d", runs) {
+				t.Errorf("result = %q, %v, want the last attempt's", output, err)
+			}
+			for _, d := range slept {
+				if d != retryOnFailDelay {
+					t.Errorf("slept %v, want %v", d, retryOnFailDelay)
+				}
+			}
+			assertContains(t, out, tt.wantOut)
+		})
+	}
+}
+
+func TestRetryOnFailInvalid(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	result := e.run("", "--retry-on-fail", "-1", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, "--retry-on-fail must not be negative")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+func TestRiskPrompt(t *testing.T) {
+	tests := []struct {
+		risk   string
+		colour string
+		typed  bool
+	}{
+		{aid.RiskSafe, colorGreen, false},
+		{aid.RiskCaution, colorYellow, false},
+		{aid.RiskDangerous, colorRed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.risk, func(t *testing.T) {
+			e := newTestEnv(t, "chmod -R g+w shared")
+			e.env["NO_COLOR"] = ""
+			e.api.risk = tt.risk
+
+			// Answering y runs the command unless a typed yes is needed
+			result := e.run("y\nno\n", "let the group edit shared")
+			assertContains(t, result.stdout, tt.colour+"Risk: "+tt.risk+".")
+			if tt.typed {
+				assertContains(t, result.stdout, "The model rated this command dangerous.", "Type 'yes' to run it:")
+				if result.code != exitDeclined {
+					t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+				}
+			} else {
+				assertNotContains(t, result.stdout, "Type 'yes'")
+			}
+		})
+	}
+}
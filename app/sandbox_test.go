@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNetworkCommands(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"curl -s https://example.com | grep title", []string{"curl"}},
+		{"git pull && npm install && git push", []string{"git", "npm"}},
+		{"sudo ping -c 1 example.com", []string{"ping"}},
+		{"ls -la | grep curl", nil},
+		{"echo wget", nil},
+	}
+	for _, tt := range tests {
+		if got := networkCommands(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("networkCommands(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestCommandShellSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("unshare is used only on Linux")
+	}
+	stubLookPath(t, "unshare")
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+
+	if shell := commandShell(); shell.Path != "bash" {
+		t.Errorf("shell = %s without sandbox_network, want bash", shell.Path)
+	}
+	options.SandboxNetwork = true
+	shell := commandShell()
+	want := []string{"--user", "--map-root-user", "--net", "bash", "-c"}
+	if shell.Path != "/usr/bin/unshare" || !reflect.DeepEqual(shell.Args, want) {
+		t.Errorf("shell = %s %v, want unshare %v", shell.Path, shell.Args, want)
+	}
+}
+
+func TestSandboxNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("unshare is used only on Linux")
+	}
+	// Stands in for unshare, recording its arguments and running the
+	// command after its options without cutting off the network
+	dir := t.TempDir()
+	record := filepath.Join(dir, "args")
+	unshare := filepath.Join(dir, "unshare")
+	script := "#!/bin/sh\necho \"$@\" > " + record + "\nwhile [ \"${1#--}\" != \"$1\" ]; do shift; done\nexec \"$@\"\n"
+	if err := os.WriteFile(unshare, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	saved := lookPath
+	t.Cleanup(func() { lookPath = saved })
+	lookPath = func(file string) (string, error) { return unshare, nil }
+
+	e := newTestEnv(t, "echo curl-ran")
+	e.writeConfig(`{"sandbox_network": true}`)
+	result := e.run("y\n", "fetch the page")
+	assertContains(t, result.stdout, "curl-ran\n")
+	args, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatalf("the command did not run through unshare: %v", err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "--user --map-root-user --net bash -c echo curl-ran" {
+		t.Errorf("unshare args = %q", got)
+	}
+
+	e = newTestEnv(t, "curl -s http://127.0.0.1:1 || true")
+	e.writeConfig(`{"sandbox_network": true}`)
+	result = e.run("y\n", "fetch the page")
+	assertContains(t, result.stdout, "Note: network access is disabled, so curl may fail.")
+}
+
+func TestSandboxNetworkUnavailable(t *testing.T) {
+	stubLookPath(t)
+	e := newTestEnv(t, "curl -s http://127.0.0.1:1 || true")
+	e.writeConfig(`{"sandbox_network": true}`)
+	result := e.run("y\n", "fetch the page")
+	assertContains(t, result.stdout, "Warning: sandbox_network is on, but unshare is not available here, so curl can reach the network.")
+
+	e = newTestEnv(t, "curl -s http://127.0.0.1:1 || true")
+	result = e.run("y\n", "fetch the page")
+	assertNotContains(t, result.stdout, "sandbox_network", "network access is disabled")
+}
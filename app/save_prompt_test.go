@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSavePrompt(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	path := filepath.Join(e.dir, "prompt.txt")
+	e.run("n\n", "--save-prompt", path, "list files")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, m := range e.api.requests[0]["messages"].([]interface{}) {
+		message := m.(map[string]interface{})
+		want = append(want, fmt.Sprintf("### %v\n%v\n", message["role"], message["content"]))
+	}
+	if string(data) != strings.Join(want, "\n") {
+		t.Errorf("saved prompt:\n%s\nwant what was sent:\n%s", data, strings.Join(want, "\n"))
+	}
+	assertContains(t, string(data), "### system\n", "### user\n", "list files")
+}
+
+func TestSavePromptRedactsKey(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	path := filepath.Join(e.dir, "prompt.txt")
+	key := e.env["OPENAI_API_KEY"]
+	e.run("n\n", "--save-prompt", path, "why is "+key+" rejected")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertNotContains(t, string(data), key)
+	assertContains(t, string(data), "[REDACTED]")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"testing"
+)
+
+// The system and user messages sent in a request
+func requestText(t *testing.T, request map[string]interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(request["messages"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Make only the named tools appear installed
+func stubLookPath(t *testing.T, installed ...string) {
+	saved := lookPath
+	t.Cleanup(func() { lookPath = saved })
+	lookPath = func(file string) (string, error) {
+		for _, name := range installed {
+			if file == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+}
+
+func TestShareCwd(t *testing.T) {
+	stubLookPath(t, "git")
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"share_cwd": true}`)
+	e.run("n\n", "list files")
+	text := requestText(t, e.api.requests[0])
+	assertContains(t, text, "The command will run in the directory "+e.dir, "These tools are installed: git.", "These tools are not installed: docker")
+}
+
+func TestShareCwdOffByDefault(t *testing.T) {
+	stubLookPath(t, "git")
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	text := requestText(t, e.api.requests[0])
+	assertNotContains(t, text, e.dir, "tools are installed")
+}
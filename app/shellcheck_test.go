@@ -0,0 +1,63 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Replace the validator with one that flags unquoted $1
+func stubValidator(t *testing.T) *[]string {
+	saved := validateCommand
+	t.Cleanup(func() { validateCommand = saved })
+	var checked []string
+	validateCommand = func(command string) ([]string, error) {
+		checked = append(checked, command)
+		if strings.Contains(command, "rm $1") {
+			return []string{"note: Double quote to prevent globbing and word splitting. [SC2086]"}, nil
+		}
+		return nil, nil
+	}
+	return &checked
+}
+
+func TestShellcheckWarnings(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shellcheck is not run on Windows")
+	}
+	tests := []struct {
+		command string
+		warns   bool
+	}{
+		{"rm $1", true},
+		{`rm "$1"`, false},
+	}
+	for _, tt := range tests {
+		checked := stubValidator(t)
+		e := newTestEnv(t, tt.command)
+		e.writeConfig(`{"shellcheck": true}`)
+		result := e.run("n\n", "remove the first argument")
+		if len(*checked) != 1 || (*checked)[0] != tt.command {
+			t.Errorf("validated %q, want %q", *checked, tt.command)
+		}
+		if got := strings.Contains(result.stdout, "shellcheck: note: Double quote"); got != tt.warns {
+			t.Errorf("%s: warning shown = %v, want %v:\n%s", tt.command, got, tt.warns, result.stdout)
+		}
+	}
+}
+
+func TestShellcheckOffByDefault(t *testing.T) {
+	checked := stubValidator(t)
+	newTestEnv(t, "rm $1").run("n\n", "remove the first argument")
+	if len(*checked) != 0 {
+		t.Errorf("validated %q without shellcheck enabled", *checked)
+	}
+}
+
+func TestShellcheckNotInstalled(t *testing.T) {
+	stubLookPath(t)
+	warnings, err := shellcheckCommand("rm $1")
+	if warnings != nil || err != nil {
+		t.Errorf("shellcheckCommand = %q, %v, want it skipped", warnings, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out strings.Builder
+	w := &prefixWriter{w: &out, prefix: "stderr: ", lineStart: true}
+	for _, chunk := range []string{"first li", "ne\nsecond\n", "", "third"} {
+		if n, err := w.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if got, want := out.String(), "stderr: first line\nstderr: second\nstderr: third"; got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+func TestLabelStreams(t *testing.T) {
+	tests := []struct {
+		stdout, stderr, want string
+	}{
+		{"out\n", "", "out\n"},
+		{"out\n", "err\n", "out\nSTDERR:\nerr\n"},
+		{"out", "err\n", "out\nSTDERR:\nerr\n"},
+		{"", "err\n", "STDERR:\nerr\n"},
+	}
+	for _, tt := range tests {
+		if got := labelStreams(tt.stdout, tt.stderr); got != tt.want {
+			t.Errorf("labelStreams(%q, %q) = %q, want %q", tt.stdout, tt.stderr, got, tt.want)
+		}
+	}
+}
+
+func TestSplitStreams(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	command := "echo to-stdout; echo to-stderr >&2"
+	e := newTestEnv(t, command)
+	outFile := filepath.Join(t.TempDir(), "out.txt")
+	result := e.run("y\n", "--split-streams", "--output-file", outFile, "write to both")
+	assertContains(t, result.stdout, "to-stdout\n", "stderr: to-stderr\n")
+
+	entries := e.readHistory()
+	if len(entries) != 1 || entries[0].Output != "to-stdout\nSTDERR:\nto-stderr\n" {
+		t.Errorf("history = %+v, want the labelled streams", entries)
+	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "to-stdout\n" {
+		t.Errorf("output file = %q, want stdout alone", data)
+	}
+
+	// Without the flag both streams are mixed and unlabelled
+	e = newTestEnv(t, command)
+	result = e.run("y\n", "write to both")
+	assertContains(t, result.stdout, "to-stdout\nto-stderr\n")
+	assertNotContains(t, result.stdout, "stderr:")
+}
+
+func TestAutoFixUsesStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses bash commands")
+	}
+	e := newTestEnv(t, "echo progress-noise; echo real-error >&2; exit 1", "echo fixed")
+	e.writeConfig(`{"split_streams": true}`)
+	e.run("y\ny\n", "--auto-fix", "build it")
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want a suggestion and a fix", len(e.api.requests))
+	}
+	fix := e.api.prompts()[1]
+	assertContains(t, fix, "real-error")
+	// The command itself is in the prompt, so look for the output line alone
+	assertNotContains(t, fix, "progress-noise\n")
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestStandalone(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	prompt := e.api.prompts()[0]
+	assertContains(t, prompt, continuationRules)
+	assertNotContains(t, prompt, standaloneRules)
+
+	e = newTestEnv(t, "ls")
+	e.writeConfig(`{"standalone": true}`)
+	e.run("n\n", "list files")
+	prompt = e.api.prompts()[0]
+	assertContains(t, prompt, standaloneRules)
+	assertNotContains(t, prompt, continuationRules, "Continue the conversation")
+}
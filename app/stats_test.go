@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionSummary(t *testing.T) {
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+	colorReset, colorBold = "", ""
+	options.NoCost = true
+
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	stats := sessionStats{Queries: 3, Run: 2, PromptTokens: 300, CompletionTokens: 30, Started: started}
+	want := "\nSession summary:\n  Queries:  3\n  Run:      2\n  Tokens:   330\n  Time:     1m30s\n"
+	if got := stats.summary(started.Add(90*time.Second + 200*time.Millisecond)); got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+}
+
+func TestInteractiveStats(t *testing.T) {
+	for _, end := range []string{"exit\n", ""} {
+		e := newTestEnv(t, "echo one", "echo two", "echo three")
+		result := e.run("say one\ny\nsay two\nn\n\nsay three\ny\n"+end, "--interactive", "--stats")
+		if result.code != exitOK {
+			t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+		}
+		assertContains(t, result.stdout,
+			"Session summary:\n  Queries:  3\n  Run:      2\n  Tokens:   330\n",
+			"  Cost:     ",
+			"  Time:     0s\n")
+	}
+}
+
+func TestInteractiveWithoutStats(t *testing.T) {
+	e := newTestEnv(t, "echo one")
+	result := e.run("say one\nn\nexit\n", "--interactive")
+	assertNotContains(t, result.stdout, "Session summary:")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWouldBlockOnStdin(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"cat", true},
+		{"cat notes.txt", false},
+		{"grep foo", true},
+		{"grep foo app.log", false},
+		{"grep -r foo", false},
+		{"grep foo < app.log", false},
+		{"sort > sorted.txt", true},
+		{"ls | sort", false},
+		{"sudo LC_ALL=C sort", true},
+		{"tr a-z A-Z", true},
+		{"echo hi; cat", true},
+		{"ls -la", false},
+	}
+	for _, tt := range tests {
+		if got := wouldBlockOnStdin(tt.command); got != tt.want {
+			t.Errorf("wouldBlockOnStdin(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestRunWithoutStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a bash command")
+	}
+	e := newTestEnv(t, "wc -l")
+	// Input after the answer must not reach the command
+	result := e.run("y\nnot for wc\n", "count lines")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d:\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, "Note: this command reads standard input, which is not connected")
+	entries := e.readHistory()
+	if len(entries) != 1 || strings.TrimSpace(entries[0].Output) != "0" {
+		t.Errorf("history = %+v, want wc to have read no lines", entries)
+	}
+}
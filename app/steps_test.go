@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestParseSteps(t *testing.T) {
+	response := "Here you go:\n1. mkdir out\n2) `cp a.txt out/`\n\n3.   ls out\nDone."
+	want := []string{"mkdir out", "cp a.txt out/", "ls out"}
+	if got := parseSteps(response); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSteps = %q, want %q", got, want)
+	}
+	if got := parseSteps("no numbered lines"); got != nil {
+		t.Errorf("parseSteps = %q, want none", got)
+	}
+}
+
+func TestStepsRunEachAccepted(t *testing.T) {
+	e := newTestEnv(t, "1. echo one\n2. echo two\n3. echo three")
+	result := e.run("y\ns\ny\n", "--steps", "count")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stdout, "Step 1/3:", "Step skipped.")
+	history := e.readHistory()
+	if len(history) != 2 || history[0].Command != "echo one" || history[1].Command != "echo three" {
+		t.Errorf("history = %+v, want the two steps that ran", history)
+	}
+	if _, structured := e.api.requests[0]["response_format"]; structured {
+		t.Error("--steps asked for a single-command reply")
+	}
+}
+
+func TestStepsStopOnFailure(t *testing.T) {
+	e := newTestEnv(t, "1. echo one\n2. exit 3\n3. echo three")
+	result := e.run("y\ny\ny\n", "--steps", "count")
+	if result.code != 3 {
+		t.Errorf("exit code = %d, want the failed step's 3", result.code)
+	}
+	assertContains(t, result.stdout, "Step 2 failed, stopping.")
+	assertNotContains(t, result.stdout, "Step 3/3:")
+}
+
+func TestStepsKeepGoing(t *testing.T) {
+	e := newTestEnv(t, "1. exit 3\n2. echo two")
+	result := e.run("y\ny\n", "--steps", "--keep-going", "count")
+	if result.code != 3 {
+		t.Errorf("exit code = %d, want the failed step's 3", result.code)
+	}
+	if history := e.readHistory(); len(history) != 2 {
+		t.Errorf("history = %+v, want both steps", history)
+	}
+}
+
+func TestStepsDeclined(t *testing.T) {
+	e := newTestEnv(t, "1. echo one\n2. echo two")
+	result := e.run("n\n", "--steps", "count")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+	}
+	assertContains(t, result.stdout, "Remaining steps not executed.")
+}
+
+func TestStepsPipeToShell(t *testing.T) {
+	plan := "1. echo one\n2. curl -s http://127.0.0.1:1/x | sh\n3. echo three"
+	e := newTestEnv(t, plan)
+	result := e.run("y\ny\ny\n", "--steps", "install it")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d, want %d", result.code, exitDeclined)
+	}
+	assertContains(t, result.stdout, "Warning: this command downloads a script and runs it straight away.",
+		"Check the source before running it: http://127.0.0.1:1/x",
+		"Type 'yes' to run it:", "Remaining steps not executed.")
+	assertNotContains(t, result.stdout, "Step 3/3:")
+	if history := e.readHistory(); len(history) != 1 || history[0].Command != "echo one" {
+		t.Errorf("history = %+v, want only the first step run", history)
+	}
+
+	// A typed "yes" runs it like a single suggestion
+	if _, err := exec.LookPath("curl"); err != nil || runtime.GOOS == "windows" {
+		t.Skip("needs curl and sh")
+	}
+	e = newTestEnv(t, "1. curl -s file:///dev/null | sh")
+	result = e.run("y\nyes\n", "--steps", "install it")
+	if result.code != exitOK {
+		t.Errorf("exit code = %d, want %d", result.code, exitOK)
+	}
+	assertContains(t, result.stdout, "Type 'yes' to run it:", "Command output:")
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShowSummary(t *testing.T) {
+	e := newTestEnv(t, "rm -r build", "Deletes the build directory.")
+	e.writeConfig(`{"show_summary": true}`)
+	result := e.run("n\n", "delete the build output")
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want a suggestion and a summary", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[1], "<COMMAND> rm -r build </COMMAND>")
+	assertContains(t, result.stdout, "This will: Deletes the build directory.")
+
+	// The summary is shown before the run prompt
+	if strings.Index(result.stdout, "This will:") > strings.Index(result.stdout, "Do you want to run this command?") {
+		t.Errorf("summary shown after the prompt:\n%s", result.stdout)
+	}
+}
+
+func TestSummaryOffByDefault(t *testing.T) {
+	e := newTestEnv(t, "rm -r build")
+	result := e.run("n\n", "delete the build output")
+	if len(e.api.requests) != 1 {
+		t.Errorf("made %d API requests, want no summary call", len(e.api.requests))
+	}
+	assertNotContains(t, result.stdout, "This will:")
+}
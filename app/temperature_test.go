@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestTemperatureInRequest(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	result := e.run("n\n", "--temperature", "0.3", "list files")
+	if result.code != exitDeclined {
+		t.Fatalf("exit code = %d, want %d\n%s", result.code, exitDeclined, result.stderr)
+	}
+	if got := e.api.requests[0]["temperature"]; got != 0.3 {
+		t.Errorf("temperature = %v, want 0.3", got)
+	}
+}
+
+func TestTemperatureOmittedByDefault(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "list files")
+	if got, ok := e.api.requests[0]["temperature"]; ok {
+		t.Errorf("temperature = %v, want it left to the API", got)
+	}
+}
+
+func TestTemperatureOutOfRange(t *testing.T) {
+	for _, value := range []string{"-0.1", "2.5"} {
+		e := newTestEnv(t, "ls")
+		result := e.run("", "--temperature", value, "list files")
+		if result.code != exitConfig {
+			t.Errorf("--temperature %s: exit code = %d, want %d", value, result.code, exitConfig)
+		}
+		assertContains(t, result.stderr, "temperature must be between 0 and 2")
+		if len(e.api.requests) != 0 {
+			t.Errorf("--temperature %s: the API was called", value)
+		}
+	}
+}
+
+func TestTemperatureFromConfig(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"temperature": 1.5}`)
+	e.run("n\n", "list files")
+	if got := e.api.requests[0]["temperature"]; got != 1.5 {
+		t.Errorf("temperature = %v, want 1.5 from the config", got)
+	}
+
+	e.run("n\n", "--temperature", "0", "list files")
+	if got := e.api.requests[1]["temperature"]; got != 0.0 {
+		t.Errorf("temperature = %v, want the flag to override the config", got)
+	}
+}
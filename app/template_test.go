@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderQuery(t *testing.T) {
+	vars := map[string]string{"n": "3", "dir": "/var/log"}
+	got, err := renderQuery("find files modified in the last {{.n}} days in {{.dir}}", vars)
+	if err != nil {
+		t.Fatalf("renderQuery: %v", err)
+	}
+	if want := "find files modified in the last 3 days in /var/log"; got != want {
+		t.Errorf("renderQuery = %q, want %q", got, want)
+	}
+	if got, err := renderQuery("print $HOME", nil); err != nil || got != "print $HOME" {
+		t.Errorf("renderQuery without placeholders = %q, %v", got, err)
+	}
+	if _, err := renderQuery("list {{.dir}", vars); err == nil || !strings.Contains(err.Error(), "invalid query template") {
+		t.Errorf("err = %v, want a template error", err)
+	}
+}
+
+func TestQueryArgs(t *testing.T) {
+	e := newTestEnv(t, "find /var/log -mtime -3")
+	e.run("n\n", "--arg", "n=3", "--arg", "dir=/var/log", "find files modified in the last {{.n}} days in {{.dir}}")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want one", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[0], "find files modified in the last 3 days in /var/log")
+}
+
+func TestQueryArgMissing(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	result := e.run("", "--arg", "n=3", "find files modified in the last {{.n}} days in {{.dir}}")
+	if result.code != exitUsage {
+		t.Errorf("exit code = %d, want %d", result.code, exitUsage)
+	}
+	assertContains(t, result.stderr, "query placeholder not set", "dir")
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests, want none", len(e.api.requests))
+	}
+}
+
+func TestQueryArgMalformed(t *testing.T) {
+	result := newTestEnv(t).run("", "--arg", "dir", "list {{.dir}}")
+	if result.code != exitUsage {
+		t.Errorf("exit code = %d, want %d", result.code, exitUsage)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCACert(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	server := httptest.NewTLSServer(e.api)
+	t.Cleanup(server.Close)
+	e.env["OPENAI_BASE_URL"] = server.URL
+	caPath := filepath.Join(e.dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e.writeConfig(`{"retries": 0}`)
+	result := e.run("n\n", "list files")
+	if result.code != exitAPI {
+		t.Errorf("exit code = %d without ca_cert, want %d", result.code, exitAPI)
+	}
+
+	e.writeConfig(`{"retries": 0, "ca_cert": "` + filepath.ToSlash(caPath) + `"}`)
+	result = e.run("n\n", "list files")
+	if result.code != exitDeclined {
+		t.Errorf("exit code = %d with ca_cert, want %d:\n%s", result.code, exitDeclined, result.stderr)
+	}
+	assertContains(t, result.stdout, "Suggested command: ls")
+}
+
+func TestCACertInvalid(t *testing.T) {
+	e := newTestEnv(t, "ls")
+	e.writeConfig(`{"client_cert": "client.pem"}`)
+	result := e.run("n\n", "list files")
+	if result.code != exitConfig {
+		t.Errorf("exit code = %d, want %d", result.code, exitConfig)
+	}
+	assertContains(t, result.stderr, "client_cert and client_key must be set together")
+	if len(e.api.requests) != 0 {
+		t.Errorf("made %d API requests", len(e.api.requests))
+	}
+}
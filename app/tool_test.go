@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToolConstraintInPrompt(t *testing.T) {
+	e := newTestEnv(t, "git log --oneline")
+	e.run("n\n", "--tool", "git", "show recent commits")
+	if len(e.api.requests) != 1 {
+		t.Fatalf("made %d API requests, want one", len(e.api.requests))
+	}
+	request, _ := json.Marshal(e.api.requests[0])
+	assertContains(t, string(request), "Only suggest a git command")
+}
+
+func TestToolRetriesMismatch(t *testing.T) {
+	e := newTestEnv(t, "ls -la", "git ls-files")
+	result := e.run("n\n", "--tool", "git", "list tracked files")
+	if len(e.api.requests) != 2 {
+		t.Fatalf("made %d API requests, want a retry", len(e.api.requests))
+	}
+	assertContains(t, e.api.prompts()[1], `The previous suggestion "ls -la" did not start with git`)
+	assertContains(t, result.stdout, "Suggestion did not use git, asking again...", "git ls-files")
+	assertNotContains(t, result.stdout, "still does not start with git")
+}
+
+func TestToolRetriesOnce(t *testing.T) {
+	e := newTestEnv(t, "ls -la")
+	result := e.run("n\n", "--tool", "git", "list tracked files")
+	if len(e.api.requests) != 2 {
+		t.Errorf("made %d API requests, want one retry", len(e.api.requests))
+	}
+	assertContains(t, result.stdout, "Warning: the suggestion still does not start with git.")
+}
+
+func TestCommandUsesTool(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"git status", true},
+		{"/usr/bin/git status", true},
+		{"gitk --all", false},
+		{"echo git", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := commandUsesTool(tt.command, "git"); got != tt.want {
+			t.Errorf("commandUsesTool(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
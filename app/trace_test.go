@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTraceBreakdown(t *testing.T) {
+	e := newTestEnv(t, "echo hi")
+	result := e.run("y\n", "--trace", "say hi")
+	if result.code != exitOK {
+		t.Fatalf("exit code = %d\n%s", result.code, result.stderr)
+	}
+	assertContains(t, result.stderr, "Timing breakdown:", "config load", "history load", "prompt build",
+		"suggestion api round-trip", "command execution", "total")
+	assertNotContains(t, result.stdout, "Timing breakdown:")
+}
+
+func TestTraceOffByDefault(t *testing.T) {
+	result := newTestEnv(t, "echo hi").run("n\n", "say hi")
+	assertNotContains(t, result.stderr+result.stdout, "Timing breakdown:")
+}
+
+func TestTracerReport(t *testing.T) {
+	tracer := Tracer{Phases: []TracePhase{{"config load", time.Millisecond}, {"prompt build", 2 * time.Millisecond}}}
+	var out bytes.Buffer
+	tracer.Report(&out)
+	want := "Timing breakdown:\n" +
+		"  config load              1ms\n" +
+		"  prompt build             2ms\n" +
+		"  total                    3ms\n"
+	if out.String() != want {
+		t.Errorf("report = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestSplitTrailingProse(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		command string
+		prose   string
+	}{
+		{"prose on the same line", "ls -la This will list all files.", "ls -la", "This will list all files."},
+		{"prose on the next line", "ls -la\nThis lists hidden files too.", "ls -la", "This lists hidden files too."},
+		{"note line", "df -h\nNote: sizes are in powers of 1024.", "df -h", "Note: sizes are in powers of 1024."},
+		{"echoed sentence", "echo Done. It worked.", "echo Done. It worked.", ""},
+		{"backslash continuation", "docker run \\\n  --rm alpine", "docker run \\\n  --rm alpine", ""},
+		{"separate commands", "mkdir build\ncd build", "mkdir build\ncd build", ""},
+		{"pipe continuation", "cat notes |\nSort by name.", "cat notes |\nSort by name.", ""},
+		{"here-document", "cat <<EOF > notes\nThis is a note for later.\nEOF", "cat <<EOF > notes\nThis is a note for later.\nEOF", ""},
+	}
+	for _, tt := range tests {
+		command, prose := splitTrailingProse(tt.text)
+		if command != tt.command || prose != tt.prose {
+			t.Errorf("%s: splitTrailingProse = %q, %q, want %q, %q", tt.name, command, prose, tt.command, tt.prose)
+		}
+	}
+}
+
+func TestTrailingTextDebug(t *testing.T) {
+	e := newTestEnv(t, "ls -la\nThis will list all files.")
+	result := e.run("n\n", "--debug", "list files")
+	assertContains(t, result.stdout, "Suggested command: ls -la\n")
+	assertContains(t, result.stderr, `debug: discarded trailing text from the model: "This will list all files."`)
+
+	e = newTestEnv(t, "ls -la\nThis will list all files.")
+	result = e.run("n\n", "list files")
+	assertNotContains(t, result.stderr, "debug:")
+}
+
+func TestKeepTrailingText(t *testing.T) {
+	e := newTestEnv(t, "ls -la This will list all files.")
+	e.writeConfig(`{"keep_trailing_text": true}`)
+	result := e.run("n\n", "list files")
+	assertContains(t, result.stdout, "Suggested command: ls -la This will list all files.\n")
+}
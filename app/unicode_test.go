@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"app/dingus-copilot/pkg/aid"
+)
+
+// Output mixing one-, two-, three- and four-byte characters
+const emojiOutput = "build ✅ done 🚀🚀 in 3s — café ünïcode 👩‍💻 ok\n"
+
+func TestTruncateUTF8(t *testing.T) {
+	for n := 0; n <= len(emojiOutput)+1; n++ {
+		head, tail := truncateUTF8(emojiOutput, n), tailUTF8(emojiOutput, n)
+		if !utf8.ValidString(head) || len(head) > n || !strings.HasPrefix(emojiOutput, head) {
+			t.Errorf("truncateUTF8(%d) = %q", n, head)
+		}
+		if !utf8.ValidString(tail) || len(tail) > n || !strings.HasSuffix(emojiOutput, tail) {
+			t.Errorf("tailUTF8(%d) = %q", n, tail)
+		}
+		if n >= utf8.UTFMax && (len(head) <= n-utf8.UTFMax || len(tail) <= n-utf8.UTFMax) {
+			t.Errorf("cut %d bytes to %d and %d, more than one character", n, len(head), len(tail))
+		}
+	}
+}
+
+func TestCappedWriterUTF8(t *testing.T) {
+	for limit := 1; limit < len(emojiOutput); limit++ {
+		var out strings.Builder
+		w := &cappedWriter{w: &out, limit: limit}
+		// One byte per write splits every multi-byte character across writes
+		for i := 0; i < len(emojiOutput); i++ {
+			if n, err := w.Write([]byte{emojiOutput[i]}); n != 1 || err != nil {
+				t.Fatalf("Write = %d, %v", n, err)
+			}
+		}
+		if got := out.String(); !utf8.ValidString(got) || len(got) > limit || !strings.HasPrefix(emojiOutput, got) {
+			t.Errorf("limit %d: wrote %q", limit, got)
+		}
+		if !w.truncated {
+			t.Errorf("limit %d: not marked truncated", limit)
+		}
+	}
+}
+
+func TestCapDisplayUTF8(t *testing.T) {
+	resetGlobals()
+	t.Cleanup(resetGlobals)
+	for limit := 1; limit < len(emojiOutput); limit++ {
+		options.DisplayMaxBytes = limit
+		if got := capDisplay(emojiOutput); !utf8.ValidString(got) {
+			t.Errorf("display_max_bytes %d: %q", limit, got)
+		}
+	}
+}
+
+func TestPadRightRunes(t *testing.T) {
+	if got := padRight("café", 6); got != "café  " {
+		t.Errorf("padRight = %q, want two spaces of padding", got)
+	}
+}
+
+func TestHistoryOutputUTF8(t *testing.T) {
+	for words := 1; words <= len(strings.Fields(emojiOutput)); words++ {
+		h := &aid.CommandHistory{MaxSize: 1, MaxWords: words, Now: time.Now}
+		h.Add("", "make", emojiOutput)
+		if got := h.Entries[0].Output; !utf8.ValidString(got) || got == aid.BinaryOutputPlaceholder {
+			t.Errorf("MaxWords %d: output = %q", words, got)
+		}
+	}
+	if got := aid.LimitLines(strings.Repeat(emojiOutput, 5), 1, 1); !utf8.ValidString(got) {
+		t.Errorf("LimitLines = %q", got)
+	}
+}
+
+func TestClipboardContextUTF8(t *testing.T) {
+	// Starts the kept tail part way through a four-byte character
+	stubClipboard(t, strings.Repeat("🚀", maxClipboardBytes/4+1)+"\n", nil)
+	e := newTestEnv(t, "ls")
+	e.run("n\n", "--from-clipboard", "what is this")
+	assertNotContains(t, e.api.prompts()[0], "�")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serve a latest release with the given tag, restoring the real URL afterwards
+func stubReleases(t *testing.T, tag string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": %q, "html_url": "https://example.com/releases/%s"}`, tag, tag)
+	}))
+	t.Cleanup(server.Close)
+	savedURL, savedVersion := releasesURL, version
+	t.Cleanup(func() { releasesURL, version = savedURL, savedVersion })
+	releasesURL = server.URL
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		latest  string
+		want    string
+	}{
+		{"newer", "v1.2.0", "v1.10.0", "A new version is available: v1.10.0 (you have v1.2.0).\nDownload it from https://example.com/releases/v1.10.0\nAutomatic installation is not supported yet"},
+		{"same", "v1.2.0", "v1.2.0", "dingus-copilot v1.2.0 is up to date."},
+		{"older", "v1.3.0", "v1.2.9", "dingus-copilot v1.3.0 is up to date."},
+		{"development build", "dev", "v1.2.0", "The latest release is v1.2.0; this is a development build."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubReleases(t, tt.latest)
+			version = tt.current
+			result := newTestEnv(t).run("", "update")
+			if result.code != exitOK {
+				t.Errorf("exit code = %d, want %d", result.code, exitOK)
+			}
+			assertContains(t, result.stdout, tt.want)
+		})
+	}
+}
+
+func TestUpdateCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		latest  string
+		want    string
+	}{
+		{"newer", "v1.2.0", "v1.10.0", "A new version is available: v1.10.0 (you have v1.2.0).\n"},
+		{"same", "v1.2.0", "v1.2.0", "dingus-copilot v1.2.0 is up to date.\n"},
+		{"older", "v1.3.0", "v1.2.9", "dingus-copilot v1.3.0 is up to date.\n"},
+		{"development build", "dev", "v1.2.0", "The latest release is v1.2.0; this is a development build.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubReleases(t, tt.latest)
+			version = tt.current
+			e := newTestEnv(t)
+			result := e.run("", "update", "--check")
+			if result.code != exitOK {
+				t.Errorf("exit code = %d, want %d", result.code, exitOK)
+			}
+			if result.stdout != tt.want {
+				t.Errorf("stdout = %q, want only %q", result.stdout, tt.want)
+			}
+			if len(e.api.requests) != 0 {
+				t.Errorf("made %d API requests, want update --check handled locally", len(e.api.requests))
+			}
+		})
+	}
+}
+
+func TestUpdateOffline(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	saved := releasesURL
+	t.Cleanup(func() { releasesURL = saved })
+	releasesURL = server.URL
+
+	for _, args := range [][]string{{"update"}, {"update", "--check"}} {
+		result := newTestEnv(t).run("", args...)
+		if result.code != exitOK || result.stdout != "" || result.stderr != "" {
+			t.Errorf("%q: exit code %d, stdout %q, stderr %q, want a quiet skip", args, result.code, result.stdout, result.stderr)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.10.0", "1.9.2", 1},
+		{"1.2", "v1.2.0", 0},
+		{"v2.0.0-rc1", "v2.0.0", 0},
+		{"v0.9", "v1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateQuery(t *testing.T) {
+	e := newTestEnv(t, "sudo apt update")
+	e.run("n\n", "update", "my", "packages")
+	e.run("n\n", "update", "--check", "disk")
+	if len(e.api.requests) != 2 {
+		t.Errorf("made %d API requests, want both queries sent", len(e.api.requests))
+	}
+}
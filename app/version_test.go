@@ -0,0 +1,33 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	savedVersion, savedCommit, savedDate := version, commit, buildDate
+	t.Cleanup(func() { version, commit, buildDate = savedVersion, savedCommit, savedDate })
+	version, commit, buildDate = "v1.4.2", "abc1234", "2026-01-02"
+
+	for _, args := range [][]string{{"--version"}, {"version"}} {
+		e := newTestEnv(t)
+		result := e.run("", args...)
+		if result.code != exitOK {
+			t.Errorf("%s: exit code = %d, want %d", args[0], result.code, exitOK)
+		}
+		want := "dingus-copilot v1.4.2 (commit abc1234, built 2026-01-02, " + runtime.GOOS + "/" + runtime.GOARCH + ")\n"
+		if result.stdout != want {
+			t.Errorf("%s: stdout = %q, want %q", args[0], result.stdout, want)
+		}
+		if len(e.api.requests) != 0 {
+			t.Errorf("%s: made %d API requests", args[0], len(e.api.requests))
+		}
+	}
+}
+
+func TestVersionDefaults(t *testing.T) {
+	if version != "dev" || commit != "unknown" || buildDate != "unknown" {
+		t.Errorf("build metadata = %s, %s, %s, want dev and unknown without -ldflags", version, commit, buildDate)
+	}
+}